@@ -0,0 +1,1220 @@
+package checker
+
+import (
+	"atlas/diagnostic"
+	"atlas/lexer"
+	"atlas/parser"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Type of integer literals. A literal fits both signed and unsigned integers and takes
+// the type of the other side of the operation. When nothing constrains it, it defaults
+// to an unsigned integer like the compiled constant. Declarations of literals without
+// annotation keep this type until a use gives them one, see inferLiteral.
+const integerLiteral parser.DataType = -1
+
+// Type of expressions of integer literals with a negation, like `-1`. They take the type of
+// the other side of the operation too, but unsigned integers cannot hold them and they
+// default to a signed integer like the value of the negation.
+const signedLiteral parser.DataType = -3
+
+// Types of the checked expressions that could not be determined because of a previous error
+const unknown = parser.INFERED
+
+// Type of the calls of functions returning nothing, like `print`. Such calls can only be used
+// as statements.
+const noValue parser.DataType = -2
+
+// Codes of the diagnostics reported by the checker
+const (
+	TYPE_MISMATCH        = "T001"
+	INVALID_OPERAND      = "T002"
+	UNDEFINED_SYMBOL     = "T003"
+	REDECLARED_SYMBOL    = "T004"
+	INVALID_FUNCTION_USE = "T005"
+	WRONG_ARGUMENT_COUNT = "T006"
+	MISSING_RETURN       = "T007"
+	LITERAL_OVERFLOW     = "T008"
+	UNINFERRED_TYPE      = "T009"
+)
+
+// Type of the channels created without a declared type, until their first use gives them one
+var pendingChannel = parser.ChannelOf(parser.INFERED)
+
+// Type of the empty array literal, which fits arrays of any type
+var emptyArray = parser.ArrayOf(parser.INFERED)
+
+// Type of the empty map literal, which fits maps of any type
+var emptyMap = parser.MapOf(parser.INFERED, parser.INFERED)
+
+type signature struct {
+	argsTypes  []parser.DataType
+	returnType parser.DataType
+	native     bool // Function of the host, taking any arguments and returning a value of any type
+}
+
+type symbol struct {
+	dataType  parser.DataType
+	signature *signature   // Set when the symbol is a function
+	token     *lexer.Token // Name in the declaration
+
+	// Set while the symbol is declared with a literal and has no type yet, with the values it
+	// was given, which take its type once it has one
+	declaration *parser.DeclarationStatement
+	values      []parser.Expression
+}
+
+type scope struct {
+	outer   *scope
+	symbols map[string]*symbol
+	pending []*symbol // Declarations of literals without a type yet, in order
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{
+		outer:   outer,
+		symbols: make(map[string]*symbol),
+	}
+}
+
+func (s *scope) resolve(name string) (*symbol, bool) {
+	sym, ok := s.symbols[name]
+	if !ok && s.outer != nil {
+		return s.outer.resolve(name)
+	}
+	return sym, ok
+}
+
+// Scope where name is declared, nil if it is not
+func (s *scope) owner(name string) *scope {
+	if _, ok := s.symbols[name]; ok {
+		return s
+	}
+	if s.outer != nil {
+		return s.outer.owner(name)
+	}
+	return nil
+}
+
+// Semantic pass run between parsing and compilation. It infers the type of declarations
+// without annotation and checks that every typed construct is used consistently.
+type Checker struct {
+	Errors []diagnostic.Diagnostic
+
+	scope      *scope
+	returnType *parser.DataType               // Return type of the function being checked, nil at top level
+	references map[*parser.Identifier]*symbol // Uses of the declarations of literals without a type yet
+
+	allowNatives bool
+	natives      []string
+}
+
+func New() *Checker {
+	return &Checker{
+		Errors:     []diagnostic.Diagnostic{},
+		scope:      newScope(nil),
+		references: map[*parser.Identifier]*symbol{},
+	}
+}
+
+// Copies a checker at top level, so that declarations checked by the copy do not change the
+// original. Used to drop the declarations of a REPL input that fails.
+func (checker *Checker) Copy() *Checker {
+	global := newScope(nil)
+	for name, sym := range checker.scope.symbols {
+		global.symbols[name] = sym
+	}
+	return &Checker{
+		Errors:       []diagnostic.Diagnostic{},
+		scope:        global,
+		references:   map[*parser.Identifier]*symbol{},
+		allowNatives: checker.allowNatives,
+		natives:      append([]string{}, checker.natives...),
+	}
+}
+
+// Lets the program call functions it does not declare, provided by the host embedding the
+// language. Their arguments and values are not checked.
+func (checker *Checker) AllowNatives() {
+	checker.allowNatives = true
+}
+
+// Functions of the host called by the program, in the order of their first call
+func (checker *Checker) Natives() []string {
+	return checker.natives
+}
+
+func (checker *Checker) Check(program *parser.Program) {
+	for _, stmt := range program.Statements {
+		checker.checkStatement(stmt)
+	}
+	// Compiled now, the declarations at top level cannot wait for the next program of a REPL
+	checker.settlePending()
+	clear(checker.references)
+}
+
+func (checker *Checker) reportError(code string, token *lexer.Token, format string, args ...any) {
+	checker.Errors = append(checker.Errors, diagnostic.NewError(code, token, format, args...))
+}
+
+func (checker *Checker) enterScope() {
+	checker.scope = newScope(checker.scope)
+}
+
+func (checker *Checker) leaveScope() {
+	checker.settlePending()
+	checker.scope = checker.scope.outer
+}
+
+func (checker *Checker) define(name *parser.Identifier, sym *symbol) {
+	if previous, ok := checker.scope.symbols[name.Value]; ok {
+		redeclared := diagnostic.NewError(REDECLARED_SYMBOL, name.Token, "`%s` is already declared in this scope", name.Value)
+		checker.Errors = append(checker.Errors, redeclared.WithNote(previous.token, "Previous declaration of `%s`", name.Value))
+	}
+	sym.token = name.Token
+	checker.scope.symbols[name.Value] = sym
+}
+
+func (checker *Checker) resolveVariable(name *parser.Identifier) (*symbol, bool) {
+	sym, ok := checker.scope.resolve(name.Value)
+	if !ok && isBuiltin(name.Value) {
+		checker.reportError(INVALID_FUNCTION_USE, name.Token, "Function `%s` cannot be used as a value", name.Value)
+		return nil, false
+	}
+	if !ok {
+		checker.reportError(UNDEFINED_SYMBOL, name.Token, "Undefined symbol `%s`", name.Value)
+		return nil, false
+	}
+	if sym.signature != nil {
+		checker.reportError(INVALID_FUNCTION_USE, name.Token, "Function `%s` cannot be used as a value", name.Value)
+		return nil, false
+	}
+	return sym, true
+}
+
+func (checker *Checker) checkStatement(statement parser.Statement) {
+	switch node := statement.(type) {
+	case *parser.DeclarationStatement:
+		valueType := checker.checkExpression(node.Value)
+		if valueType == noValue {
+			checker.reportError(TYPE_MISMATCH, node.Value.GetToken(), "Expression has no value to declare `%s` with", node.Name.Value)
+			valueType = unknown
+		}
+		sym := &symbol{}
+		switch {
+		case node.Type == parser.INFERED && isLiteral(valueType):
+			// Typed by its first use needing a type, or by default when its scope ends
+			node.Type = valueType
+			sym.declaration, sym.values = node, []parser.Expression{node.Value}
+			checker.scope.pending = append(checker.scope.pending, sym)
+		case node.Type == parser.INFERED:
+			checker.checkInferable(node.Value, valueType)
+			node.Type = defaultType(valueType)
+			checker.settleLiterals(node.Value, node.Type)
+		default:
+			checker.checkAssignable(node.Type, node.Value, valueType, fmt.Sprintf("`%s`", node.Name.Value))
+		}
+		sym.dataType = node.Type
+		checker.define(node.Name, sym)
+	case *parser.AssignmentStatement:
+		valueType := checker.checkExpression(node.Value)
+		sym, ok := checker.resolveVariable(node.Name)
+		switch {
+		case !ok:
+		case sym.dataType == pendingChannel && valueType.Kind() == parser.CHANNEL:
+			checker.inferChannel(node.Name, valueType)
+		case sym.declaration != nil && isLiteral(valueType):
+			// Settled with the declaration, a negative literal makes it signed
+			if valueType == signedLiteral {
+				sym.dataType, sym.declaration.Type = signedLiteral, signedLiteral
+			}
+			sym.values = append(sym.values, node.Value)
+		case sym.declaration != nil && fits(valueType, sym.dataType):
+			checker.inferLiteral(sym, valueType)
+		default:
+			if sym.declaration != nil {
+				checker.inferLiteral(sym, defaultType(sym.dataType))
+			}
+			checker.checkAssignable(sym.dataType, node.Value, valueType, fmt.Sprintf("`%s`", node.Name.Value))
+		}
+	case *parser.IndexAssignmentStatement:
+		elementType, collectionKind := checker.checkIndex(node.Target)
+		valueType := checker.checkExpression(node.Value)
+		destination := "array element"
+		if collectionKind == parser.MAP {
+			destination = "map value"
+		}
+		checker.checkAssignable(elementType, node.Value, valueType, destination)
+	case *parser.InputStatement:
+		checker.resolveVariable(node.Name)
+	case *parser.IfStatement:
+		for i, condition := range node.Conditions {
+			checker.checkCondition(condition)
+			checker.checkBlock(node.Consequences[i])
+		}
+		checker.checkBlock(node.Else)
+	case *parser.LoopStatement:
+		checker.checkCondition(node.Condition)
+		checker.checkBlock(node.Block)
+	case *parser.FunctionDeclarationStatement:
+		checker.checkFunctionDeclaration(node)
+	case *parser.ReturnStatement:
+		valueType := checker.checkExpression(node.Expression)
+		if checker.returnType != nil {
+			checker.checkAssignable(*checker.returnType, node.Expression, valueType, "return value")
+		}
+	case *parser.ExpressionStatement:
+		checker.checkExpression(node.Expression)
+	case *parser.SendStatement:
+		channelType := checker.checkChannel(node.Token, node.Channel)
+		valueType := checker.checkExpression(node.Value)
+		if channelType == pendingChannel && valueType != unknown && valueType != noValue {
+			checker.checkInferable(node.Value, valueType)
+			checker.settleLiterals(node.Value, defaultType(valueType))
+			checker.inferChannel(node.Channel, parser.ChannelOf(defaultType(valueType)))
+		} else if channelType != unknown {
+			checker.checkAssignable(channelType.Element(), node.Value, valueType, "value sent on the channel")
+		}
+	case *parser.CloseStatement:
+		checker.checkChannel(node.Token, node.Channel)
+	}
+}
+
+func (checker *Checker) checkBlock(block *parser.StatementsBlock) {
+	if block == nil {
+		return
+	}
+	checker.enterScope()
+	for _, stmt := range block.Statements {
+		checker.checkStatement(stmt)
+	}
+	checker.leaveScope()
+}
+
+func (checker *Checker) checkCondition(condition parser.Expression) {
+	conditionType := checker.checkExpression(condition)
+	if conditionType != unknown && conditionType != parser.BOOL {
+		checker.reportError(TYPE_MISMATCH, condition.GetToken(), "Condition must be %s, found %s", parser.BOOL, typeName(conditionType))
+	}
+}
+
+func (checker *Checker) checkFunctionDeclaration(node *parser.FunctionDeclarationStatement) {
+	returnType := unknown
+	if node.ReturnType != nil {
+		returnType = *node.ReturnType
+	}
+
+	// Defined before the body so that the function can call itself
+	checker.define(node.Name, &symbol{
+		signature: &signature{argsTypes: node.ArgsTypes, returnType: returnType},
+	})
+
+	if node.Body == nil {
+		return
+	}
+
+	outerReturnType := checker.returnType
+	checker.returnType = &returnType
+	checker.enterScope()
+
+	for i, arg := range node.ArgsNames {
+		checker.define(arg, &symbol{dataType: node.ArgsTypes[i]})
+	}
+	for _, stmt := range node.Body.Statements {
+		checker.checkStatement(stmt)
+	}
+
+	checker.leaveScope()
+	checker.returnType = outerReturnType
+
+	if !alwaysReturns(node.Body) {
+		checker.reportError(MISSING_RETURN, node.Token, "Function `%s` does not return a value on every path", node.Name.Value)
+	}
+}
+
+// Checks if every path through the block ends with a return statement
+func alwaysReturns(block *parser.StatementsBlock) bool {
+	if block == nil || len(block.Statements) == 0 {
+		return false
+	}
+	switch last := block.Statements[len(block.Statements)-1].(type) {
+	case *parser.ReturnStatement:
+		return true
+	case *parser.IfStatement:
+		if last.Else == nil || !alwaysReturns(last.Else) {
+			return false
+		}
+		for _, consequence := range last.Consequences {
+			if !alwaysReturns(consequence) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func (checker *Checker) checkExpression(expression parser.Expression) parser.DataType {
+	switch node := expression.(type) {
+	case *parser.UnsignedIntegerLiteralExpression:
+		return integerLiteral
+	case *parser.FloatLiteralExpression:
+		return parser.FLOAT
+	case *parser.StringLiteralExpression:
+		return parser.STRING
+	case *parser.BooleanLiteralExpression:
+		return parser.BOOL
+	case *parser.ArrayLiteralExpression:
+		return checker.checkArrayLiteral(node)
+	case *parser.MapLiteralExpression:
+		return checker.checkMapLiteral(node)
+	case *parser.IndexExpression:
+		elementType, _ := checker.checkIndex(node)
+		return elementType
+	case *parser.Identifier:
+		sym, ok := checker.resolveVariable(node)
+		if !ok {
+			return unknown
+		}
+		if sym.declaration != nil {
+			checker.references[node] = sym
+		}
+		return sym.dataType
+	case *parser.PrefixExpression:
+		return checker.checkPrefixExpression(node)
+	case *parser.InfixExpression:
+		return checker.checkInfixExpression(node)
+	case *parser.CallExpression:
+		return checker.checkCallExpression(node)
+	case *parser.SpawnExpression:
+		if name, ok := node.Call.Function.(*parser.Identifier); ok && checker.isBuiltinCall(name) {
+			checker.reportError(INVALID_FUNCTION_USE, name.Token, "Built-in function `%s` cannot be spawned", name.Value)
+			return unknown
+		}
+		returnType := checker.checkCallExpression(node.Call)
+		if returnType == unknown {
+			return unknown
+		}
+		return parser.FutureOf(returnType)
+	case *parser.AwaitExpression:
+		return checker.checkAwaitExpression(node)
+	case *parser.ConversionExpression:
+		return checker.checkConversion(node)
+	case *parser.ChannelExpression:
+		if node.Capacity != nil {
+			capacityType := checker.checkExpression(node.Capacity)
+			if capacityType != unknown && !isInteger(capacityType) {
+				checker.reportError(TYPE_MISMATCH, node.Capacity.GetToken(), "Channel capacity must be an integer, found %s", typeName(capacityType))
+			}
+		}
+		return pendingChannel
+	case *parser.RecvExpression:
+		channelType := checker.checkChannel(node.Token, node.Channel)
+		if channelType == unknown {
+			return unknown
+		}
+		if channelType == pendingChannel {
+			checker.reportError(UNINFERRED_TYPE, node.Channel.GetToken(), "Cannot infer the type of the values of this channel, annotate its declaration")
+			return unknown
+		}
+		node.ElementType = channelType.Element()
+		return node.ElementType
+	}
+	return unknown
+}
+
+// Finds the common type of the elements of an array literal. Like operands, integer literals
+// take the type of the other elements.
+func (checker *Checker) checkArrayLiteral(node *parser.ArrayLiteralExpression) parser.DataType {
+	elementsTypes := make([]parser.DataType, len(node.Elements))
+	for i, element := range node.Elements {
+		elementsTypes[i] = checker.checkExpression(element)
+	}
+
+	result := parser.INFERED
+	for i, elementType := range elementsTypes {
+		if elementType == unknown {
+			return unknown
+		}
+		if elementType == noValue {
+			checker.reportError(TYPE_MISMATCH, node.Elements[i].GetToken(), "Expression has no value to store in an array")
+			return unknown
+		}
+		if i == 0 {
+			result = elementType
+			continue
+		}
+		unified, ok := unifyElements(result, elementType)
+		if !ok {
+			checker.reportError(TYPE_MISMATCH, node.Elements[i].GetToken(), "Mismatched types %s and %s in array literal", typeName(result), typeName(elementType))
+			return unknown
+		}
+		result = unified
+	}
+
+	for i, elementType := range elementsTypes {
+		if elementType != result {
+			checker.settleLiterals(node.Elements[i], result)
+		}
+	}
+	if result.Kind() == parser.CHANNEL {
+		for i, elementType := range elementsTypes {
+			if elementType == pendingChannel {
+				checker.inferChannel(node.Elements[i], result)
+			}
+		}
+	}
+	return parser.ArrayOf(result)
+}
+
+// Finds the common types of the keys and of the values of a map literal, like for the elements
+// of array literals
+func (checker *Checker) checkMapLiteral(node *parser.MapLiteralExpression) parser.DataType {
+	keysTypes := make([]parser.DataType, len(node.Keys))
+	valuesTypes := make([]parser.DataType, len(node.Values))
+	for i := range node.Keys {
+		keysTypes[i] = checker.checkExpression(node.Keys[i])
+		valuesTypes[i] = checker.checkExpression(node.Values[i])
+	}
+
+	keyType, valueType := parser.INFERED, parser.INFERED
+	for i := range node.Keys {
+		if keysTypes[i] == unknown || valuesTypes[i] == unknown {
+			return unknown
+		}
+		if keysTypes[i] == noValue || valuesTypes[i] == noValue {
+			checker.reportError(TYPE_MISMATCH, node.Keys[i].GetToken(), "Expression has no value to store in a map")
+			return unknown
+		}
+		if !isHashable(keysTypes[i]) {
+			checker.reportError(TYPE_MISMATCH, node.Keys[i].GetToken(), "Map keys must be integers, booleans or strings, found %s", typeName(keysTypes[i]))
+			return unknown
+		}
+		if i == 0 {
+			keyType, valueType = keysTypes[i], valuesTypes[i]
+			continue
+		}
+		unified, ok := unifyElements(keyType, keysTypes[i])
+		if !ok {
+			checker.reportError(TYPE_MISMATCH, node.Keys[i].GetToken(), "Mismatched types %s and %s for the keys of map literal", typeName(keyType), typeName(keysTypes[i]))
+			return unknown
+		}
+		keyType = unified
+		unified, ok = unifyElements(valueType, valuesTypes[i])
+		if !ok {
+			checker.reportError(TYPE_MISMATCH, node.Values[i].GetToken(), "Mismatched types %s and %s for the values of map literal", typeName(valueType), typeName(valuesTypes[i]))
+			return unknown
+		}
+		valueType = unified
+	}
+
+	for i := range node.Keys {
+		if keysTypes[i] != keyType {
+			checker.settleLiterals(node.Keys[i], keyType)
+		}
+		if valuesTypes[i] != valueType {
+			checker.settleLiterals(node.Values[i], valueType)
+		}
+	}
+	if valueType.Kind() == parser.CHANNEL {
+		for i, elementType := range valuesTypes {
+			if elementType == pendingChannel {
+				checker.inferChannel(node.Values[i], valueType)
+			}
+		}
+	}
+	return parser.MapOf(keyType, valueType)
+}
+
+// Common type of two elements of an array or map literal, where literals and values without a
+// type yet fit the type of the other element
+func unifyElements(left parser.DataType, right parser.DataType) (parser.DataType, bool) {
+	switch {
+	case left == right:
+		return left, true
+	case fits(left, right):
+		return left, true
+	case fits(right, left):
+		return right, true
+	case left.Kind() == parser.ARRAY && right.Kind() == parser.ARRAY:
+		element, ok := unifyElements(left.Element(), right.Element())
+		return parser.ArrayOf(element), ok
+	case left.Kind() == parser.MAP && right.Kind() == parser.MAP:
+		key, keyOk := unifyElements(left.Key(), right.Key())
+		element, ok := unifyElements(left.Element(), right.Element())
+		return parser.MapOf(key, element), keyOk && ok
+	}
+	return unknown, false
+}
+
+// Checks if values of type valueType fit in a destination of type target, when valueType is
+// the type of a literal or of a value whose type is not known yet
+func fits(target parser.DataType, valueType parser.DataType) bool {
+	switch {
+	case target == valueType:
+		return true
+	case valueType == integerLiteral:
+		return isNumber(target)
+	case valueType == signedLiteral:
+		return target == parser.INT || target == parser.FLOAT
+	case valueType == pendingChannel:
+		return target.Kind() == parser.CHANNEL
+	case valueType.Kind() == parser.ARRAY && target.Kind() == parser.ARRAY:
+		return valueType == emptyArray || fits(target.Element(), valueType.Element())
+	case valueType.Kind() == parser.MAP && target.Kind() == parser.MAP:
+		return valueType == emptyMap || fits(target.Key(), valueType.Key()) && fits(target.Element(), valueType.Element())
+	}
+	return false
+}
+
+// Returns the type of the element read by an index expression, and the kind of the indexed
+// array or map
+func (checker *Checker) checkIndex(node *parser.IndexExpression) (parser.DataType, parser.TypeKind) {
+	leftType := checker.checkExpression(node.Left)
+	indexType := checker.checkExpression(node.Index)
+	if leftType == unknown {
+		return unknown, parser.BASIC
+	}
+	switch leftType.Kind() {
+	case parser.ARRAY:
+		if indexType != unknown && !isInteger(indexType) {
+			checker.reportError(TYPE_MISMATCH, node.Index.GetToken(), "Array index must be an integer, found %s", typeName(indexType))
+		}
+	case parser.MAP:
+		checker.checkAssignable(leftType.Key(), node.Index, indexType, "map key")
+	default:
+		checker.reportError(INVALID_OPERAND, node.Token, "Indexing cannot be applied to %s", typeName(checker.settledType(node.Left, leftType)))
+		return unknown, parser.BASIC
+	}
+	return leftType.Element(), leftType.Kind()
+}
+
+// Reports the arrays and maps whose elements have no type yet, which cannot be declared
+// without annotation
+func (checker *Checker) checkInferable(value parser.Expression, valueType parser.DataType) {
+	for dataType := valueType; dataType.Kind() == parser.ARRAY || dataType.Kind() == parser.MAP; dataType = dataType.Element() {
+		if dataType == emptyArray || dataType == emptyMap || dataType.Element() == pendingChannel {
+			collection := "elements of this array"
+			if dataType.Kind() == parser.MAP {
+				collection = "values of this map"
+			}
+			checker.reportError(UNINFERRED_TYPE, value.GetToken(), "Cannot infer the type of the %s, annotate its declaration", collection)
+			return
+		}
+	}
+}
+
+// Checks the channel operand of the channel keyword at token, returning its type or unknown
+func (checker *Checker) checkChannel(token *lexer.Token, channel parser.Expression) parser.DataType {
+	channelType := checker.checkExpression(channel)
+	if channelType == unknown {
+		return unknown
+	}
+	if channelType.Kind() != parser.CHANNEL {
+		checker.reportError(INVALID_OPERAND, token, "`%s` cannot be applied to %s", token.Value, typeName(checker.settledType(channel, channelType)))
+		return unknown
+	}
+	return channelType
+}
+
+// Gives its type to the channel created without one that expression refers to
+func (checker *Checker) inferChannel(expression parser.Expression, channelType parser.DataType) {
+	name, ok := expression.(*parser.Identifier)
+	if !ok {
+		return
+	}
+	owner := checker.scope.owner(name.Value)
+	if owner == nil {
+		return
+	}
+	// Replaced rather than changed, the symbol may be shared with the checker this one was copied from
+	inferred := *owner.symbols[name.Value]
+	inferred.dataType = channelType
+	owner.symbols[name.Value] = &inferred
+}
+
+func (checker *Checker) checkAwaitExpression(node *parser.AwaitExpression) parser.DataType {
+	futureType := checker.checkExpression(node.Future)
+	if futureType == unknown {
+		return unknown
+	}
+	if futureType.Kind() != parser.FUTURE {
+		checker.reportError(INVALID_OPERAND, node.Token, "Operator `await` cannot be applied to %s", typeName(checker.settledType(node.Future, futureType)))
+		return unknown
+	}
+	return futureType.Element()
+}
+
+// Conversions apply between numbers and booleans. Literals take the target type directly, the
+// ones a signed integer cannot hold are reported like in declarations.
+func (checker *Checker) checkConversion(node *parser.ConversionExpression) parser.DataType {
+	valueType := checker.checkExpression(node.Value)
+	if valueType == unknown {
+		return unknown
+	}
+	if !isNumber(valueType) && valueType != parser.BOOL {
+		checker.reportError(TYPE_MISMATCH, node.Value.GetToken(), "Cannot convert %s to %s", typeName(valueType), typeName(node.Type))
+		return unknown
+	}
+	// Variables keep a type of their own, only the literals converted alone take the target type
+	checker.settleReferences(node.Value)
+	if checker.isUnsettled(node.Value) && node.Type != parser.BOOL {
+		checker.settleLiterals(node.Value, node.Type)
+	}
+	return node.Type
+}
+
+func (checker *Checker) checkPrefixExpression(node *parser.PrefixExpression) parser.DataType {
+	rightType := checker.checkExpression(node.Right)
+	if rightType == unknown {
+		return unknown
+	}
+
+	switch node.Operator {
+	case "!":
+		if rightType != parser.BOOL {
+			checker.reportError(INVALID_OPERAND, node.Token, "Operator `!` cannot be applied to %s", typeName(rightType))
+			return unknown
+		}
+		return parser.BOOL
+	case "-":
+		if rightType == parser.FLOAT {
+			return parser.FLOAT
+		}
+		if !isInteger(rightType) {
+			checker.reportError(INVALID_OPERAND, node.Token, "Operator `-` cannot be applied to %s", typeName(rightType))
+			return unknown
+		}
+		// Negation always yields a signed integer, literals settle to one by default
+		if isLiteral(rightType) {
+			return signedLiteral
+		}
+		return parser.INT
+	case "~":
+		if !isInteger(rightType) {
+			checker.reportError(INVALID_OPERAND, node.Token, "Operator `~` cannot be applied to %s", typeName(rightType))
+			return unknown
+		}
+		return rightType
+	}
+	return unknown
+}
+
+func (checker *Checker) checkInfixExpression(node *parser.InfixExpression) parser.DataType {
+	leftType := checker.checkExpression(node.Left)
+	rightType := checker.checkExpression(node.Right)
+	if leftType == unknown || rightType == unknown {
+		return unknown
+	}
+
+	switch node.Operator {
+	case "+", "-", "*", "/", "&", "|", "^":
+		operandsType, ok := checker.unifyOperands(node, leftType, rightType)
+		if !ok {
+			return unknown
+		}
+		// Strings are concatenated with `+`
+		if operandsType == parser.STRING && node.Operator == "+" {
+			return parser.STRING
+		}
+		if operandsType == parser.FLOAT && isArithmetic(node.Operator) {
+			return parser.FLOAT
+		}
+		if !isInteger(operandsType) {
+			checker.reportError(INVALID_OPERAND, node.Token, "Operator `%s` cannot be applied to %s", node.Operator, typeName(operandsType))
+			return unknown
+		}
+		return operandsType
+	case "==", "!=":
+		operandsType, ok := checker.unifyOperands(node, leftType, rightType)
+		if !ok {
+			return unknown
+		}
+		// Arrays and maps are compared by reference at runtime, which is rarely what is meant
+		if operandsType.Kind() == parser.FUTURE || operandsType.Kind() == parser.ARRAY || operandsType.Kind() == parser.MAP || operandsType == noValue {
+			checker.reportError(INVALID_OPERAND, node.Token, "Operator `%s` cannot be applied to %s", node.Operator, typeName(operandsType))
+			return unknown
+		}
+		return parser.BOOL
+	case "<", "<=", ">", ">=":
+		operandsType, ok := checker.unifyOperands(node, leftType, rightType)
+		if !ok {
+			return unknown
+		}
+		if !isNumber(operandsType) && operandsType != parser.STRING {
+			checker.reportError(INVALID_OPERAND, node.Token, "Operator `%s` cannot be applied to %s", node.Operator, typeName(operandsType))
+			return unknown
+		}
+		return parser.BOOL
+	case "<<", ">>":
+		// The shift count can be any integer, the result has the type of the shifted value
+		if !isInteger(leftType) || !isInteger(rightType) {
+			checker.reportError(INVALID_OPERAND, node.Token, "Operator `%s` cannot be applied to %s and %s", node.Operator, typeName(leftType), typeName(rightType))
+			return unknown
+		}
+		return leftType
+	case "&&", "||":
+		if leftType != parser.BOOL || rightType != parser.BOOL {
+			checker.reportError(INVALID_OPERAND, node.Token, "Operator `%s` cannot be applied to %s and %s", node.Operator, typeName(leftType), typeName(rightType))
+			return unknown
+		}
+		return parser.BOOL
+	}
+	return unknown
+}
+
+// Finds the common type of both operands of a binary operator. Like in the VM, integers mixed
+// with floats are promoted to floats.
+func (checker *Checker) unifyOperands(node *parser.InfixExpression, leftType parser.DataType, rightType parser.DataType) (parser.DataType, bool) {
+	if leftType == rightType {
+		return leftType, true
+	}
+	if isLiteral(leftType) && fits(rightType, leftType) {
+		checker.settleLiterals(node.Left, rightType)
+		return rightType, true
+	}
+	if isLiteral(rightType) && fits(leftType, rightType) {
+		checker.settleLiterals(node.Right, leftType)
+		return leftType, true
+	}
+	if promotesToFloat(leftType, rightType) {
+		return parser.FLOAT, true
+	}
+	checker.reportError(TYPE_MISMATCH, node.Token, "Mismatched types %s and %s for operator `%s`", typeName(leftType), typeName(rightType), node.Operator)
+	return unknown, false
+}
+
+func (checker *Checker) checkCallExpression(node *parser.CallExpression) parser.DataType {
+	argsTypes := make([]parser.DataType, len(node.Arguments))
+	for i, arg := range node.Arguments {
+		argsTypes[i] = checker.checkExpression(arg)
+	}
+
+	name, ok := node.Function.(*parser.Identifier)
+	if !ok {
+		checker.reportError(INVALID_FUNCTION_USE, node.Token, "Only named functions can be called")
+		return unknown
+	}
+	sym, ok := checker.scope.resolve(name.Value)
+	if !ok && isBuiltin(name.Value) {
+		return checker.checkBuiltinCall(node, name, argsTypes)
+	}
+	if !ok && checker.allowNatives {
+		sym, ok = checker.declareNative(name), true
+	}
+	if !ok {
+		checker.reportError(UNDEFINED_SYMBOL, name.Token, "Undefined function `%s`", name.Value)
+		return unknown
+	}
+	if sym.signature == nil {
+		checker.reportError(INVALID_FUNCTION_USE, name.Token, "`%s` is not a function", name.Value)
+		return unknown
+	}
+	if sym.signature.native {
+		return unknown
+	}
+
+	if len(node.Arguments) != len(sym.signature.argsTypes) {
+		checker.reportError(WRONG_ARGUMENT_COUNT, node.Token, "Function `%s` expects %d arguments, found %d", name.Value, len(sym.signature.argsTypes), len(node.Arguments))
+	} else {
+		for i, arg := range node.Arguments {
+			checker.checkAssignable(sym.signature.argsTypes[i], arg, argsTypes[i], fmt.Sprintf("argument %d of `%s`", i+1, name.Value))
+		}
+	}
+
+	return sym.signature.returnType
+}
+
+// Checks if name refers to a built-in function, which declarations of the program shadow
+func (checker *Checker) isBuiltinCall(name *parser.Identifier) bool {
+	_, declared := checker.scope.resolve(name.Value)
+	return !declared && isBuiltin(name.Value)
+}
+
+// Functions built into the language, see compiler.BUILTINS
+func isBuiltin(name string) bool {
+	switch name {
+	case "print", "println", "len", "abs", "min", "max", "assert", "panic", "delete", "has", "keys":
+		return true
+	}
+	return false
+}
+
+// Checks a call of a built-in function. Their signatures are more flexible than the ones of
+// declared functions: some take any number of arguments or arguments of several types.
+func (checker *Checker) checkBuiltinCall(node *parser.CallExpression, name *parser.Identifier, argsTypes []parser.DataType) parser.DataType {
+	for i, argType := range argsTypes {
+		if argType == noValue {
+			checker.reportError(INVALID_OPERAND, node.Arguments[i].GetToken(), "`%s` cannot be applied to %s", name.Value, typeName(argType))
+			return unknown
+		}
+	}
+
+	switch name.Value {
+	case "print", "println":
+		return noValue
+	case "min", "max":
+		if len(argsTypes) == 0 {
+			checker.reportError(WRONG_ARGUMENT_COUNT, node.Token, "Function `%s` expects at least 1 argument, found 0", name.Value)
+			return unknown
+		}
+		return checker.unifyNumberArguments(node, name, argsTypes)
+	case "delete", "has":
+		if len(argsTypes) != 2 {
+			checker.reportError(WRONG_ARGUMENT_COUNT, node.Token, "Function `%s` expects 2 arguments, found %d", name.Value, len(argsTypes))
+			return unknown
+		}
+		mapType := argsTypes[0]
+		if mapType != unknown && mapType.Kind() != parser.MAP {
+			checker.reportError(INVALID_OPERAND, node.Arguments[0].GetToken(), "`%s` cannot be applied to %s", name.Value, typeName(mapType))
+			return unknown
+		}
+		if mapType != unknown {
+			checker.checkAssignable(mapType.Key(), node.Arguments[1], argsTypes[1], fmt.Sprintf("argument 2 of `%s`", name.Value))
+		}
+		if name.Value == "has" {
+			return parser.BOOL
+		}
+		return noValue
+	}
+
+	if len(argsTypes) != 1 {
+		checker.reportError(WRONG_ARGUMENT_COUNT, node.Token, "Function `%s` expects 1 arguments, found %d", name.Value, len(argsTypes))
+		return unknown
+	}
+	argType := argsTypes[0]
+	switch name.Value {
+	case "len":
+		if argType != unknown && argType != parser.STRING && argType.Kind() != parser.CHANNEL && argType.Kind() != parser.ARRAY && argType.Kind() != parser.MAP {
+			checker.reportError(INVALID_OPERAND, node.Arguments[0].GetToken(), "`len` cannot be applied to %s", typeName(checker.settledType(node.Arguments[0], argType)))
+			return unknown
+		}
+		return parser.UINT
+	case "abs":
+		return checker.unifyNumberArguments(node, name, argsTypes)
+	case "assert":
+		checker.checkAssignable(parser.BOOL, node.Arguments[0], argType, "argument 1 of `assert`")
+		return noValue
+	case "panic":
+		return noValue
+	case "keys":
+		if argType == unknown {
+			return unknown
+		}
+		if argType.Kind() != parser.MAP {
+			checker.reportError(INVALID_OPERAND, node.Arguments[0].GetToken(), "`keys` cannot be applied to %s", typeName(checker.settledType(node.Arguments[0], argType)))
+			return unknown
+		}
+		return parser.ArrayOf(argType.Key())
+	}
+	return unknown
+}
+
+// Finds the common type of the number arguments of a built-in function, like the operands of
+// arithmetic operators
+func (checker *Checker) unifyNumberArguments(node *parser.CallExpression, name *parser.Identifier, argsTypes []parser.DataType) parser.DataType {
+	// A float among the arguments promotes all the integers, wherever it is
+	result := integerLiteral
+	if slices.Contains(argsTypes, parser.FLOAT) {
+		result = parser.FLOAT
+	}
+	for i, argType := range argsTypes {
+		switch {
+		case argType == unknown:
+			return unknown
+		case !isNumber(argType):
+			checker.reportError(INVALID_OPERAND, node.Arguments[i].GetToken(), "`%s` cannot be applied to %s", name.Value, typeName(argType))
+			return unknown
+		case argType == result || fits(result, argType):
+		case fits(argType, result):
+			result = argType
+		case promotesToFloat(result, argType):
+		default:
+			checker.reportError(TYPE_MISMATCH, node.Arguments[i].GetToken(), "Mismatched types %s and %s for `%s`", typeName(result), typeName(argType), name.Value)
+			return unknown
+		}
+	}
+	// Promoted integers keep their own type, the VM converts them
+	for i, argType := range argsTypes {
+		if isLiteral(argType) {
+			checker.settleLiterals(node.Arguments[i], result)
+		}
+	}
+	return result
+}
+
+// Declares a function of the host at top level, where the compiler gives it a global
+func (checker *Checker) declareNative(name *parser.Identifier) *symbol {
+	global := checker.scope
+	for global.outer != nil {
+		global = global.outer
+	}
+	sym := &symbol{signature: &signature{returnType: unknown, native: true}, token: name.Token}
+	global.symbols[name.Value] = sym
+	checker.natives = append(checker.natives, name.Value)
+	return sym
+}
+
+// Checks that a value of type valueType can be stored in a destination of type target
+func (checker *Checker) checkAssignable(target parser.DataType, value parser.Expression, valueType parser.DataType, destination string) {
+	if target == unknown || valueType == unknown || target == valueType {
+		return
+	}
+	if valueType == pendingChannel && target.Kind() == parser.CHANNEL {
+		checker.inferChannel(value, target)
+		return
+	}
+	if isLiteral(valueType) && fits(target, valueType) {
+		checker.settleLiterals(value, target)
+		return
+	}
+	if valueType.Kind() == parser.ARRAY && fits(target, valueType) {
+		// The elements of the literal are checked in turn, for the literals overflowing them
+		if literal, ok := value.(*parser.ArrayLiteralExpression); ok {
+			for _, element := range literal.Elements {
+				checker.checkAssignable(target.Element(), element, valueType.Element(), destination)
+			}
+		}
+		return
+	}
+	if valueType.Kind() == parser.MAP && fits(target, valueType) {
+		if literal, ok := value.(*parser.MapLiteralExpression); ok {
+			for i := range literal.Keys {
+				checker.checkAssignable(target.Key(), literal.Keys[i], valueType.Key(), destination)
+				checker.checkAssignable(target.Element(), literal.Values[i], valueType.Element(), destination)
+			}
+		}
+		return
+	}
+	checker.reportError(TYPE_MISMATCH, value.GetToken(), "Cannot use %s as %s for %s", typeName(checker.settledType(value, valueType)), typeName(target), destination)
+}
+
+func isInteger(dataType parser.DataType) bool {
+	return dataType == parser.INT || dataType == parser.UINT || isLiteral(dataType)
+}
+
+// Checks if one number is a float and the other an integer, promoted to a float when both are
+// operands or arguments of min and max
+func promotesToFloat(left parser.DataType, right parser.DataType) bool {
+	return left == parser.FLOAT && isInteger(right) || isInteger(left) && right == parser.FLOAT
+}
+
+func isLiteral(dataType parser.DataType) bool {
+	return dataType == integerLiteral || dataType == signedLiteral
+}
+
+func isNumber(dataType parser.DataType) bool {
+	return isInteger(dataType) || dataType == parser.FLOAT
+}
+
+// Operators applying to floats as well as integers, unlike bitwise ones
+func isArithmetic(operator string) bool {
+	switch operator {
+	case "+", "-", "*", "/":
+		return true
+	}
+	return false
+}
+
+// Makes the integer literals of an expression of literals, found to be a value of type target,
+// compile to signed integers or floats when target is or holds them. Bitwise operators have no
+// float version, and literals above the range of signed integers are reported.
+func (checker *Checker) settleLiterals(expression parser.Expression, target parser.DataType) {
+	switch node := expression.(type) {
+	case *parser.UnsignedIntegerLiteralExpression:
+		if target == parser.INT && node.Value > math.MaxInt64 {
+			checker.reportError(LITERAL_OVERFLOW, node.Token, "Literal %d overflows %s", node.Value, typeName(target))
+			return
+		}
+		if target == parser.INT || target == parser.FLOAT {
+			node.Type = target
+		}
+	case *parser.InfixExpression:
+		switch {
+		case target == parser.INT:
+			// The shift count keeps its own type
+			checker.settleLiterals(node.Left, target)
+			if node.Operator != "<<" && node.Operator != ">>" {
+				checker.settleLiterals(node.Right, target)
+			}
+		case target == parser.FLOAT && !isArithmetic(node.Operator):
+			checker.reportError(INVALID_OPERAND, node.Token, "Operator `%s` cannot be applied to %s", node.Operator, typeName(target))
+		case target == parser.FLOAT:
+			checker.settleLiterals(node.Left, target)
+			checker.settleLiterals(node.Right, target)
+		}
+	case *parser.Identifier:
+		sym, ok := checker.references[node]
+		switch {
+		case !ok || target == unknown || isLiteral(target):
+		case sym.declaration != nil && fits(target, sym.dataType):
+			checker.inferLiteral(sym, target)
+		case sym.dataType != target && !(target == parser.FLOAT && isInteger(sym.dataType)):
+			// Given another type by a use checked after this one
+			checker.reportError(TYPE_MISMATCH, node.Token, "Cannot use %s `%s` as %s", typeName(sym.dataType), node.Value, typeName(target))
+		}
+	case *parser.PrefixExpression:
+		literal, ok := node.Right.(*parser.UnsignedIntegerLiteralExpression)
+		switch {
+		case node.Operator == "~" && target == parser.FLOAT:
+			checker.reportError(INVALID_OPERAND, node.Token, "Operator `~` cannot be applied to %s", typeName(target))
+		case node.Operator == "-" && target == parser.INT && ok && literal.Value == -math.MinInt64:
+			// The lowest signed integer, the compiler folds its negation
+		case node.Operator == "-" && !checker.isUnsettled(node.Right):
+			// The negation of a value with a type is a signed integer whatever its type
+		case node.Operator == "-" || node.Operator == "~":
+			checker.settleLiterals(node.Right, target)
+		}
+	case *parser.CallExpression:
+		// min, max and abs of literals, the other calls have a type of their own
+		if name, ok := node.Function.(*parser.Identifier); ok && checker.isBuiltinCall(name) {
+			for _, arg := range node.Arguments {
+				checker.settleLiterals(arg, target)
+			}
+		}
+	case *parser.ArrayLiteralExpression:
+		if target.Kind() == parser.ARRAY {
+			for _, element := range node.Elements {
+				checker.settleLiterals(element, target.Element())
+			}
+		}
+	case *parser.MapLiteralExpression:
+		if target.Kind() == parser.MAP {
+			for i := range node.Keys {
+				checker.settleLiterals(node.Keys[i], target.Key())
+				checker.settleLiterals(node.Values[i], target.Element())
+			}
+		}
+	}
+}
+
+// Checks if an expression still has the type of a literal, which settling it changes
+func (checker *Checker) isUnsettled(expression parser.Expression) bool {
+	switch node := expression.(type) {
+	case *parser.UnsignedIntegerLiteralExpression:
+		return true
+	case *parser.Identifier:
+		sym, ok := checker.references[node]
+		return ok && sym.declaration != nil
+	case *parser.PrefixExpression:
+		return checker.isUnsettled(node.Right)
+	case *parser.InfixExpression:
+		if node.Operator == "<<" || node.Operator == ">>" {
+			return checker.isUnsettled(node.Left)
+		}
+		return checker.isUnsettled(node.Left) && checker.isUnsettled(node.Right)
+	case *parser.CallExpression:
+		name, ok := node.Function.(*parser.Identifier)
+		if !ok || !checker.isBuiltinCall(name) {
+			return false
+		}
+		for _, arg := range node.Arguments {
+			if !checker.isUnsettled(arg) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Gives its type to a declaration of a literal without annotation, and to the values it was
+// given. Symbols still waiting for a type are never shared with the checker this one was
+// copied from, they are changed in place.
+func (checker *Checker) inferLiteral(sym *symbol, dataType parser.DataType) {
+	declaration, values := sym.declaration, sym.values
+	sym.dataType, sym.declaration, sym.values = dataType, nil, nil
+	declaration.Type = dataType
+	for _, value := range values {
+		checker.settleLiterals(value, dataType)
+	}
+}
+
+// Gives their default type to the declarations of literals without a type yet that expression
+// uses, when the use cannot give them one
+func (checker *Checker) settleReferences(expression parser.Expression) {
+	switch node := expression.(type) {
+	case *parser.Identifier:
+		if sym, ok := checker.references[node]; ok && sym.declaration != nil {
+			checker.inferLiteral(sym, defaultType(sym.dataType))
+		}
+	case *parser.PrefixExpression:
+		checker.settleReferences(node.Right)
+	case *parser.InfixExpression:
+		checker.settleReferences(node.Left)
+		checker.settleReferences(node.Right)
+	case *parser.CallExpression:
+		for _, arg := range node.Arguments {
+			checker.settleReferences(arg)
+		}
+	}
+}
+
+// Type of an operand that cannot be used, with the default type of a variable declared with a
+// literal rather than the type of the literal
+func (checker *Checker) settledType(expression parser.Expression, dataType parser.DataType) parser.DataType {
+	checker.settleReferences(expression)
+	if name, ok := expression.(*parser.Identifier); ok {
+		if sym, ok := checker.references[name]; ok {
+			return sym.dataType
+		}
+	}
+	return dataType
+}
+
+// Gives their default type to the declarations of literals of the scope no use gave one
+func (checker *Checker) settlePending() {
+	for _, sym := range checker.scope.pending {
+		if sym.declaration != nil {
+			checker.inferLiteral(sym, defaultType(sym.dataType))
+		}
+	}
+	checker.scope.pending = nil
+}
+
+// Checks if values of the type can be map keys
+func isHashable(dataType parser.DataType) bool {
+	return isInteger(dataType) || dataType == parser.BOOL || dataType == parser.STRING
+}
+
+// Type given to a declaration without annotation
+func defaultType(dataType parser.DataType) parser.DataType {
+	if dataType == integerLiteral {
+		return parser.UINT
+	}
+	if dataType == signedLiteral {
+		return parser.INT
+	}
+	if dataType.Kind() == parser.ARRAY {
+		return parser.ArrayOf(defaultType(dataType.Element()))
+	}
+	if dataType.Kind() == parser.MAP {
+		return parser.MapOf(defaultType(dataType.Key()), defaultType(dataType.Element()))
+	}
+	return dataType
+}
+
+func typeName(dataType parser.DataType) string {
+	switch dataType {
+	case integerLiteral:
+		return "Integer literal"
+	case signedLiteral:
+		return "Signed integer literal"
+	case noValue:
+		return "No value"
+	case emptyArray:
+		return "Empty array"
+	case emptyMap:
+		return "Empty map"
+	}
+	// Arrays and maps of literals have an element type of the checker
+	if dataType.Kind() == parser.ARRAY {
+		return "Array of " + typeName(dataType.Element())
+	}
+	if dataType.Kind() == parser.MAP {
+		return "Map of " + typeName(dataType.Key()) + " to " + typeName(dataType.Element())
+	}
+	return dataType.String()
+}
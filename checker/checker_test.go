@@ -0,0 +1,383 @@
+package checker
+
+import (
+	"atlas/parser"
+	"strings"
+	"testing"
+)
+
+func checkProgram(t *testing.T, input string) (*Checker, *parser.Program) {
+	t.Helper()
+
+	pars := parser.New(&input)
+	program := pars.Parse()
+	if len(pars.Errors) > 0 {
+		t.Fatalf("parsing failed: %v", pars.Errors)
+	}
+
+	check := New()
+	check.Check(&program)
+	return check, &program
+}
+
+func TestValidPrograms(t *testing.T) {
+	tests := []string{
+		"var a: int = 5; var b: uint = 5; var c: bool = true;",
+		"var a: int = 5; a = a * 2 - 1;",
+		"var a = -5; var b: int = a;",
+		"var a: uint = 1; if a > 0 { a = 0; }",
+		`fun fibonacci(n: int): int {
+			if n <= 1 {
+				return n;
+			}
+			return fibonacci(n - 1) + fibonacci(n - 2);
+		}
+		var result: int = fibonacci(10);`,
+		"fun sign(n: int): int { if n > 0 { return 1; } else if n < 0 { return -1; } else { return 0; } }",
+		"var a: bool = 1 == 2; var b = !a;",
+		"var number = 10; if (number & 1) == 0 { number = number | 1; }",
+		"var a: int = 6; var b: uint = 2; var c: int = (a ^ 3) << b;",
+		"var a = 1 < 2 && 2 < 3 || !true;",
+		"fun square(a: int): int { return a * a; } var h = spawn square(3); var b: int = await h + 1;",
+		"var c = chan(); send(c, 1); var v: uint = recv(c);",
+		"var c: chan bool = chan(1); send(c, true); close(c); var v = !recv(c);",
+		"fun first(c: chan int): int { return recv(c); } var c = chan(1); send(c, -1); var h = spawn first(c);",
+		"var c = chan(); var d: chan int = c; var v: int = recv(c);",
+		"println(1, true); print(); var c: chan int = chan(2); var n: uint = len(c);",
+		"var a: int = -3; var b: int = abs(a) + min(a, 1, 2) - max(4, a); var c: uint = max(1, 2);",
+		"assert(1 < 2); if false { panic(1); }",
+		`var s: string = "a" + "b"; var t = s; var b: bool = s < t && s != "c"; var n: uint = len(s);`,
+		`fun shout(s: string): string { return s + "!"; } var c: chan string = chan(1); send(c, shout("hey"));`,
+		"fun len(a: bool): bool { return a; } var b: bool = len(true);",
+		"var a = [1, 2, 3]; a[0] = a[1] + a[2]; var n: uint = len(a) + a[len(a) - 1];",
+		"var a: []int = [1, -2]; var b: [][]int = [[], [3], a]; b[1][0] = -1; var c: int = b[2][1];",
+		"fun sum(a: []uint): uint { return a[0] + a[1]; } var s = sum([1, 2]); var e: []bool = [];",
+		"var c = chan(); var a: []chan int = [c, chan()]; send(a[0], -1); var v: int = recv(c);",
+		`var words = ["a", "b"]; words[1] = words[0] + "!"; var i: int = 1; println(words[i]);`,
+		`var ages = {"ann": 31, "bob": 27}; ages["eve"] = ages["ann"] + 1; delete(ages, "bob"); var n: uint = len(ages);`,
+		`var m: map[int][]string = {-1: ["a"], 2: []}; var k: []int = keys(m); var found: bool = has(m, k[0]); var e: map[bool]uint = {};`,
+		"var f: float = 1; var g = f * 2 + 0.5 / f; var b: bool = g < 3 && -g != 1.5; var h: float = max(f, 2, g);",
+		"fun area(r: float): float { return 3.14159 * r * r; } var a = area(2); var c: chan float = chan(1); send(c, 1);",
+		"var a: []float = [1, 2 + 3, 4.5]; var m: map[string]float = {\"x\": 1}; a[0] = 2; m[\"y\"] = 3;",
+		"fun count(m: map[string]uint, key: string): uint { if has(m, key) { return m[key]; } return 0; } var c = count({}, \"a\");",
+		"var u: uint = 3; var i: int = int(u) - 5; var f: float = float(i) / 2; var b: bool = bool(u) && !bool(f);",
+		"var i: int = int(2.9) + int(true); var u: uint = uint(i) << 2; var f = float(1) + float(u);",
+		"var i: int = 9223372036854775807; var m: map[int]int = {1: 2}; m[3] = i; var j = int(5) + i;",
+		"var f = 1.5; var i: int = 1; var u: uint = 2; var g: float = f + i * 2 - u; var b: bool = i < f; var m: float = min(i, u, f);",
+		"var f: float = -1; var x: int = ~5; var y: int = -9223372036854775808; var z: float = -(1 + 2) * f;",
+		"var i: int = 1; var j = i + -1; var a: []float = [-1, 2.5]; var m = min(-1, i); var n: uint = ~0 >> 1;",
+		"fun g(): int { var k = 3; return k; }",
+		"var i = 0; var n: int = 3; loop i < n { i = i + 1; } var j = 1; var k = j * 2; var f: float = k;",
+		"var u: uint = 1; var k = 1; var i: int = int(k) + 2; var v = u + k; var w = -k;",
+	}
+
+	for _, input := range tests {
+		check, _ := checkProgram(t, input)
+		if len(check.Errors) > 0 {
+			t.Errorf("unexpected errors for %q: %v", input, check.Errors)
+		}
+	}
+}
+
+func TestTypeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var a: bool = 5;", "Cannot use Integer literal as Boolean for `a` at line 1, column 15"},
+		{"var a: int = 1; var b: uint = 1; var c = a + b;", "Mismatched types Integer and Unsigned integer for operator `+`"},
+		{"var a = true; a = 1;", "Cannot use Integer literal as Boolean for `a`"},
+		{"if 1 { }", "Condition must be Boolean, found Integer literal"},
+		{"loop 1 + 1 { }", "Condition must be Boolean, found Integer literal"},
+		{"var a = !5;", "Operator `!` cannot be applied to Integer literal"},
+		{"var a = -true;", "Operator `-` cannot be applied to Boolean"},
+		{"var a = true > false;", "Operator `>` cannot be applied to Boolean"},
+		{"var a: int = 18446744073709551615;", "Literal 18446744073709551615 overflows Integer"},
+		{"fun f(a: int): int { return a; } var b = f(true);", "Cannot use Boolean as Integer for argument 1 of `f`"},
+		{"fun f(a: int): int { return a; } var b = f();", "Function `f` expects 1 arguments, found 0"},
+		{"fun f(a: int): bool { return a; }", "Cannot use Integer as Boolean for return value"},
+		{"fun f(a: int): int { if a > 0 { return a; } }", "Function `f` does not return a value on every path"},
+		{"fun f(): int { return 1; } var a = f;", "Function `f` cannot be used as a value"},
+		{"var a: int = 1; var b: uint = 2; var c = a & b;", "Mismatched types Integer and Unsigned integer for operator `&`"},
+		{"var a = true | false;", "Operator `|` cannot be applied to Boolean"},
+		{"var a = 1 << true;", "Operator `<<` cannot be applied to Integer literal and Boolean"},
+		{"var a = 1 && true;", "Operator `&&` cannot be applied to Integer literal and Boolean"},
+		{"var a = ~false;", "Operator `~` cannot be applied to Boolean"},
+		{"var a = b;", "Undefined symbol `b`"},
+		{"var a = g(1);", "Undefined function `g`"},
+		{"var a = await 1;", "Operator `await` cannot be applied to Integer literal"},
+		{"fun f(): int { return 1; } var h = spawn f(); var b: int = h;", "Cannot use Future of Integer as Integer for `b`"},
+		{"fun f(): int { return 1; } var h = spawn f(); var b: bool = await h;", "Cannot use Integer as Boolean for `b`"},
+		{"fun f(): int { return 1; } var h = spawn f(); var b = h == h;", "Operator `==` cannot be applied to Future of Integer"},
+		{"fun f(a: int): int { return a; } var h = spawn f();", "Function `f` expects 1 arguments, found 0"},
+		{"var c = chan(); var v = recv(c);", "Cannot infer the type of the values of this channel, annotate its declaration"},
+		{"var c: chan int = chan(); send(c, true);", "Cannot use Boolean as Integer for value sent on the channel"},
+		{"var c = chan(); send(c, 1); send(c, false);", "Cannot use Boolean as Unsigned integer for value sent on the channel"},
+		{"var a = 1; send(a, 1);", "`send` cannot be applied to Unsigned integer"},
+		{"var c = chan(true);", "Channel capacity must be an integer, found Boolean"},
+		{"var c: chan int = chan(); var d: chan uint = c;", "Cannot use Channel of Integer as Channel of Unsigned integer for `d`"},
+		{`var s: string = 1;`, "Cannot use Integer literal as String for `s`"},
+		{`var a = "a" - "b";`, "Operator `-` cannot be applied to String"},
+		{`var a = "a" + 1;`, "Mismatched types String and Integer literal for operator `+`"},
+		{`var a = -"a";`, "Operator `-` cannot be applied to String"},
+		{"var a = println(1);", "Expression has no value to declare `a` with"},
+		{"var a: uint = 1 + print(1);", "Mismatched types Integer literal and No value for operator `+`"},
+		{"print(print(1));", "`print` cannot be applied to No value"},
+		{"var a = len(1);", "`len` cannot be applied to Integer literal"},
+		{"var a = len();", "Function `len` expects 1 arguments, found 0"},
+		{"var a = abs(true);", "`abs` cannot be applied to Boolean"},
+		{"var a = min();", "Function `min` expects at least 1 argument, found 0"},
+		{"var a: int = 1; var b: uint = 2; var c = max(a, 3, b);", "Mismatched types Integer and Unsigned integer for `max`"},
+		{"assert(1);", "Cannot use Integer literal as Boolean for argument 1 of `assert`"},
+		{"var p = print;", "Function `print` cannot be used as a value"},
+		{"var h = spawn println(1);", "Built-in function `println` cannot be spawned"},
+		{"fun f(): int { return print(1); }", "Cannot use No value as Integer for return value"},
+		{"var a = [1, true];", "Mismatched types Integer literal and Boolean in array literal"},
+		{"var a: []int = [1, 2]; var b = [a, [true]];", "Mismatched types Array of Integer and Array of Boolean in array literal"},
+		{"var a: []bool = [1, 2];", "Cannot use Array of Integer literal as Array of Boolean for `a`"},
+		{"var a: []int = [1, 9223372036854775808];", "Literal 9223372036854775808 overflows Integer"},
+		{"var a: []uint = [1]; var b: []int = a;", "Cannot use Array of Unsigned integer as Array of Integer for `b`"},
+		{"var a = [];", "Cannot infer the type of the elements of this array, annotate its declaration"},
+		{"var a = [[]];", "Cannot infer the type of the elements of this array, annotate its declaration"},
+		{"var a = 1; var b = a[0];", "Indexing cannot be applied to Unsigned integer"},
+		{"var a = [1]; var b = a[true];", "Array index must be an integer, found Boolean"},
+		{"var a = [1]; a[0] = false;", "Cannot use Boolean as Unsigned integer for array element"},
+		{"var a = [1]; var b = a == a;", "Operator `==` cannot be applied to Array of Unsigned integer"},
+		{"var a = [print(1)];", "Expression has no value to store in an array"},
+		{"var a = [1] + [2];", "Operator `+` cannot be applied to Array of Integer literal"},
+		{`var m = {"a": 1, 2: 3};`, "Mismatched types String and Integer literal for the keys of map literal"},
+		{`var m = {"a": 1, "b": true};`, "Mismatched types Integer literal and Boolean for the values of map literal"},
+		{"var m = {[1]: true};", "Map keys must be integers, booleans or strings, found Array of Integer literal"},
+		{`var m: map[string]bool = {"a": 1};`, "Cannot use Map of String to Integer literal as Map of String to Boolean for `m`"},
+		{`var m: map[int]bool = {9223372036854775808: true};`, "Literal 9223372036854775808 overflows Integer"},
+		{"var m = {};", "Cannot infer the type of the values of this map, annotate its declaration"},
+		{`var m = {"a": []};`, "Cannot infer the type of the elements of this array, annotate its declaration"},
+		{`var m = {"a": 1}; var v = m[1];`, "Cannot use Integer literal as String for map key"},
+		{`var m = {"a": 1}; m["b"] = "c";`, "Cannot use String as Unsigned integer for map value"},
+		{`var m = {"a": 1}; var b = m == m;`, "Operator `==` cannot be applied to Map of String to Unsigned integer"},
+		{`var m = {"a": print(1)};`, "Expression has no value to store in a map"},
+		{`var m = {"a": 1}; delete(m, true);`, "Cannot use Boolean as String for argument 2 of `delete`"},
+		{"var a = [1]; var b = has(a, 0);", "`has` cannot be applied to Array of Unsigned integer"},
+		{`var m = {"a": 1}; var b = has(m);`, "Function `has` expects 2 arguments, found 1"},
+		{"var k = keys([1]);", "`keys` cannot be applied to Array of Integer literal"},
+		{"var f = 1.5; var i: int = 1; var g = f & i;", "Operator `&` cannot be applied to Float"},
+		{"var f = 1.5; var i: int = 1; var g: int = f + i;", "Cannot use Float as Integer for `g`"},
+		{"var f: float = 2; var i: int = f;", "Cannot use Float as Integer for `i`"},
+		{"var f = 1.5 & 1.5;", "Operator `&` cannot be applied to Float"},
+		{"var f = 1.5 << 1;", "Operator `<<` cannot be applied to Float and Integer literal"},
+		{"var f = ~1.5;", "Operator `~` cannot be applied to Float"},
+		{"var f: float = 1 | 2;", "Operator `|` cannot be applied to Float"},
+		{"var f = 1.5 + (1 ^ 2);", "Operator `^` cannot be applied to Float"},
+		{"var m = {1.5: true};", "Map keys must be integers, booleans or strings, found Float"},
+		{`var i = int("1");`, "Cannot convert String to Integer"},
+		{"var b = bool([1]);", "Cannot convert Array of Integer literal to Boolean"},
+		{"var u = uint(chan());", "Cannot convert Channel to Unsigned integer"},
+		{"var u = 1; var i: int = int(u) + u;", "Mismatched types Integer and Unsigned integer for operator `+`"},
+		{"var i = int(9223372036854775808);", "Literal 9223372036854775808 overflows Integer"},
+		{"var i: int = 1 + 18446744073709551615;", "Literal 18446744073709551615 overflows Integer"},
+		{"var m: map[int]bool = {9223372036854775808: true};", "Literal 9223372036854775808 overflows Integer"},
+		{"var u: uint = -1;", "Cannot use Signed integer literal as Unsigned integer for `u`"},
+		{"var u: uint = 1; var v = u + -1;", "Mismatched types Unsigned integer and Signed integer literal for operator `+`"},
+		{"var f: float = ~1;", "Operator `~` cannot be applied to Float"},
+		{"var x: int = -9223372036854775809;", "Literal 9223372036854775809 overflows Integer"},
+		{"var k = 3; var u: uint = k; var i: int = k;", "Cannot use Unsigned integer as Integer for `i`"},
+		{"var k = 3; var j = k + 1; var u: uint = k; var i: int = j;", "Cannot use Unsigned integer `k` as Integer"},
+		{"var k = -1; var u: uint = k;", "Cannot use Integer as Unsigned integer for `u`"},
+		{"var k = 1; var s: string = k;", "Cannot use Unsigned integer as String for `s`"},
+		{`var k = 1; k = "a";`, "Cannot use String as Unsigned integer for `k`"},
+	}
+
+	for _, tt := range tests {
+		check, _ := checkProgram(t, tt.input)
+		found := false
+		for _, err := range check.Errors {
+			if strings.Contains(err.String(), tt.expected) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("expected error %q for %q. got=%v", tt.expected, tt.input, check.Errors)
+		}
+	}
+}
+
+func TestReportsEveryError(t *testing.T) {
+	check, _ := checkProgram(t, "var a: bool = 1; var b: int = true; if 2 { }")
+	if len(check.Errors) != 3 {
+		t.Errorf("expected 3 errors. got=%v", check.Errors)
+	}
+}
+
+func TestRedeclarationNote(t *testing.T) {
+	check, _ := checkProgram(t, "var a = 1;\nvar a = 2;")
+	if len(check.Errors) != 1 {
+		t.Fatalf("expected 1 error. got=%v", check.Errors)
+	}
+
+	err := check.Errors[0]
+	if err.Code != REDECLARED_SYMBOL || err.Span.Start.Row != 2 {
+		t.Errorf("wrong error. got=%s %s", err.Code, err)
+	}
+	if len(err.Notes) != 1 || err.Notes[0].Span == nil || err.Notes[0].Span.Start.Row != 1 {
+		t.Errorf("note does not point at the previous declaration. got=%+v", err.Notes)
+	}
+}
+
+func TestInferDeclarationTypes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected parser.DataType
+	}{
+		{"var a = 1;", parser.UINT},
+		{"var a = -1;", parser.INT},
+		{"var a = 1 > 2;", parser.BOOL},
+		{"var b: int = 1; var a = b + 1;", parser.INT},
+		{"var a = [[1], []];", parser.ArrayOf(parser.ArrayOf(parser.UINT))},
+		{"var a = [-1, 2];", parser.ArrayOf(parser.INT)},
+		{`var a = {"x": [1], "y": []};`, parser.MapOf(parser.STRING, parser.ArrayOf(parser.UINT))},
+		{"var a = {1: true, -2: false};", parser.MapOf(parser.INT, parser.BOOL)},
+		{`var m = {"x": 1}; var a = keys(m);`, parser.ArrayOf(parser.STRING)},
+		{"var a = 1.5;", parser.FLOAT},
+		{"var a = 2 * 1.5;", parser.FLOAT},
+		{"var a = [1, 2.5];", parser.ArrayOf(parser.FLOAT)},
+		{"var a = -1.5;", parser.FLOAT},
+		{"var a = max(1, 2.5);", parser.FLOAT},
+		{"var i: int = 1; var a = i / 2.0;", parser.FLOAT},
+		{"var u: uint = 1; var f = 0.5; var a = max(u, f);", parser.FLOAT},
+		{"var a = ~5;", parser.UINT},
+		{"var a = -(2 * 3) + 1;", parser.INT},
+		{"var a = min(-1, 2);", parser.INT},
+		{"var c = chan(1); send(c, -1); var a = recv(c);", parser.INT},
+	}
+
+	for _, tt := range tests {
+		check, program := checkProgram(t, tt.input)
+		if len(check.Errors) > 0 {
+			t.Fatalf("unexpected errors for %q: %v", tt.input, check.Errors)
+		}
+		last := program.Statements[len(program.Statements)-1].(*parser.DeclarationStatement)
+		if last.Type != tt.expected {
+			t.Errorf("wrong inferred type for %q. expected=%s, got=%s", tt.input, tt.expected, last.Type)
+		}
+	}
+}
+
+// Declarations of literals without annotation take the type of their first use needing one
+func TestInferDeclarationsFromUses(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected parser.DataType
+	}{
+		{"fun g(): int { var k = 3; return k; }", parser.INT},
+		{"var k = 3; var i: int = k;", parser.INT},
+		{"var k = 3; println(k); var f = k * 1.5;", parser.FLOAT},
+		{"var k = 3; println(k);", parser.UINT},
+		{"var k = -3; var f: float = k;", parser.FLOAT},
+		{"var k = 3; k = -1;", parser.INT},
+		{"var k = 3; var j = k + 1; var i: int = j;", parser.INT},
+		{"var k = 0; var n: int = 5; loop k < n { k = k + 1; }", parser.INT},
+		{"var k = 1; fun f(x: int): int { return x + k; }", parser.INT},
+		{"var k = 1; if true { var i: int = 2; i = k; }", parser.INT},
+		{"var k = 1; var i: int = int(k);", parser.UINT},
+	}
+
+	for _, tt := range tests {
+		check, program := checkProgram(t, tt.input)
+		if len(check.Errors) > 0 {
+			t.Fatalf("unexpected errors for %q: %v", tt.input, check.Errors)
+		}
+		first := program.Statements[0]
+		if function, ok := first.(*parser.FunctionDeclarationStatement); ok {
+			first = function.Body.Statements[0]
+		}
+		declaration := first.(*parser.DeclarationStatement)
+		if declaration.Type != tt.expected {
+			t.Errorf("wrong inferred type for %q. expected=%s, got=%s", tt.input, tt.expected, declaration.Type)
+		}
+		literal, ok := declaration.Value.(*parser.UnsignedIntegerLiteralExpression)
+		if ok && tt.expected != parser.UINT && literal.Type != tt.expected {
+			t.Errorf("wrong literal type for %q. expected=%s, got=%s", tt.input, tt.expected, literal.Type)
+		}
+	}
+}
+
+// Integer literals compile to the type the checker found them to have, unsigned by default
+func TestLiteralTypes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected parser.DataType
+	}{
+		{"var a = 1;", parser.INFERED},
+		{"var a: uint = 1;", parser.INFERED},
+		{"var a: int = 1;", parser.INT},
+		{"var a: float = 1;", parser.FLOAT},
+		{"var i: int = 2; var a = i * 1;", parser.INT},
+		{"var a = int(1);", parser.INT},
+		{"var a = bool(1);", parser.INFERED},
+		{"var a = -1;", parser.INT},
+		{"var a: float = -1;", parser.FLOAT},
+		{"var a: int = ~5;", parser.INT},
+		{"var a = ~5;", parser.INFERED},
+		{"fun f(x: int): int { return x; } var a = f(1);", parser.INT},
+	}
+
+	for _, tt := range tests {
+		check, program := checkProgram(t, tt.input)
+		if len(check.Errors) > 0 {
+			t.Fatalf("unexpected errors for %q: %v", tt.input, check.Errors)
+		}
+		var literal *parser.UnsignedIntegerLiteralExpression
+		findLiteral(program, func(found *parser.UnsignedIntegerLiteralExpression) { literal = found })
+		if literal == nil {
+			t.Fatalf("no integer literal in %q", tt.input)
+		}
+		if literal.Type != tt.expected {
+			t.Errorf("wrong literal type for %q. expected=%s, got=%s", tt.input, tt.expected, literal.Type)
+		}
+	}
+}
+
+// Calls found on the integer literals of the last declaration of the program
+func findLiteral(program *parser.Program, found func(*parser.UnsignedIntegerLiteralExpression)) {
+	last := program.Statements[len(program.Statements)-1].(*parser.DeclarationStatement)
+	var walk func(expression parser.Expression)
+	walk = func(expression parser.Expression) {
+		switch node := expression.(type) {
+		case *parser.UnsignedIntegerLiteralExpression:
+			found(node)
+		case *parser.InfixExpression:
+			walk(node.Left)
+			walk(node.Right)
+		case *parser.CallExpression:
+			for _, arg := range node.Arguments {
+				walk(arg)
+			}
+		case *parser.ConversionExpression:
+			walk(node.Value)
+		case *parser.PrefixExpression:
+			walk(node.Right)
+		}
+	}
+	walk(last.Value)
+}
+
+func TestNatives(t *testing.T) {
+	input := "fun twice(n: uint): uint { return double(double(n)); } var a = log(twice(1), true); double(2);"
+	pars := parser.New(&input)
+	program := pars.Parse()
+
+	check := New()
+	check.AllowNatives()
+	check.Check(&program)
+	if len(check.Errors) > 0 {
+		t.Fatalf("unexpected errors: %v", check.Errors)
+	}
+	if strings.Join(check.Natives(), " ") != "double log" {
+		t.Errorf("wrong natives. got=%v", check.Natives())
+	}
+
+	check, _ = checkProgram(t, "double(2);")
+	if len(check.Errors) != 1 || check.Errors[0].Code != UNDEFINED_SYMBOL {
+		t.Errorf("natives allowed by default. got=%v", check.Errors)
+	}
+}
@@ -1,2 +1,96 @@
 package cli
 
+import (
+	"atlas/diagnostic"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Writes diagnostics with the source line they point at, the span underlined with carets:
+//
+//	error[P001]: Expected Semicolon, found Identifier
+//	 --> main.atl:2:11
+//	  |
+//	2 | var b = 1 c
+//	  |           ^
+func RenderDiagnostics(out io.Writer, file string, source string, diagnostics []diagnostic.Diagnostic) {
+	sourceLines := strings.Split(source, "\n")
+
+	for i, diag := range diagnostics {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintf(out, "%s[%s]: %s\n", diag.Severity, diag.Code, diag.Message)
+		renderExcerpt(out, file, sourceLines, diag.Span)
+
+		for _, note := range diag.Notes {
+			if note.Span == nil {
+				fmt.Fprintf(out, "  = note: %s\n", note.Message)
+				continue
+			}
+			fmt.Fprintf(out, "note: %s\n", note.Message)
+			renderExcerpt(out, file, sourceLines, *note.Span)
+		}
+	}
+}
+
+func renderExcerpt(out io.Writer, file string, sourceLines []string, span diagnostic.Span) {
+	row := span.Start.Row
+	gutter := len(fmt.Sprint(row))
+	padding := strings.Repeat(" ", gutter)
+
+	fmt.Fprintf(out, "%s--> %s:%d:%d\n", padding, file, row, span.Start.Col)
+	if row < 1 || row > len(sourceLines) {
+		return
+	}
+
+	line := strings.TrimRight(sourceLines[row-1], "\r")
+	fmt.Fprintf(out, "%s |\n", padding)
+	fmt.Fprintf(out, "%d | %s\n", row, line)
+	fmt.Fprintf(out, "%s | %s%s\n", padding, indentTo(line, span.Start.Col), strings.Repeat("^", underlineWidth(line, span)))
+}
+
+// Blanks the characters before col, keeping tabs so that the underline stays aligned
+func indentTo(line string, col int) string {
+	var indent strings.Builder
+	for i := 0; i < col-1 && i < len(line); i++ {
+		if line[i] == '\t' {
+			indent.WriteByte('\t')
+		} else {
+			indent.WriteByte(' ')
+		}
+	}
+	return indent.String()
+}
+
+// Spans running over several lines are underlined up to the end of their first line
+func underlineWidth(line string, span diagnostic.Span) int {
+	end := span.End.Col
+	if span.End.Row != span.Start.Row {
+		end = len(line) + 1
+	}
+	if end <= span.Start.Col {
+		return 1
+	}
+	return end - span.Start.Col
+}
+
+type jsonDiagnostic struct {
+	File string `json:"file"`
+	diagnostic.Diagnostic
+}
+
+// Writes diagnostics as a JSON array, for editors and other tools
+func RenderDiagnosticsJSON(out io.Writer, file string, diagnostics []diagnostic.Diagnostic) error {
+	entries := make([]jsonDiagnostic, len(diagnostics))
+	for i, diag := range diagnostics {
+		entries[i] = jsonDiagnostic{File: file, Diagnostic: diag}
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(entries)
+}
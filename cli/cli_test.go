@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"atlas/diagnostic"
+	"atlas/lexer"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRenderDiagnostics(t *testing.T) {
+	source := "var a: int = 1;\nif true {\n\tvar a = tru;\n}"
+	declaration := &lexer.Token{Type: lexer.IDENTIFIER, Value: "a", Row: 1, Col: 5}
+	use := &lexer.Token{Type: lexer.IDENTIFIER, Value: "tru", Row: 3, Col: 10}
+
+	diagnostics := []diagnostic.Diagnostic{
+		diagnostic.NewError("T003", use, "Undefined symbol `%s`", "tru").WithNote(declaration, "Declared here").WithNote(nil, "Did you mean `true`?"),
+	}
+
+	var out strings.Builder
+	RenderDiagnostics(&out, "main.atl", source, diagnostics)
+
+	expected := `error[T003]: Undefined symbol ` + "`tru`" + `
+ --> main.atl:3:10
+  |
+3 | 	var a = tru;
+  | 	        ^^^
+note: Declared here
+ --> main.atl:1:5
+  |
+1 | var a: int = 1;
+  |     ^
+  = note: Did you mean ` + "`true`" + `?
+`
+	if out.String() != expected {
+		t.Errorf("wrong rendering. expected=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestRenderDiagnosticsJSON(t *testing.T) {
+	token := &lexer.Token{Type: lexer.SEMICOLON, Value: ";", Row: 2, Col: 7}
+	diagnostics := []diagnostic.Diagnostic{diagnostic.NewError("P002", token, "Expected expression, found %s", token.Type)}
+
+	var out strings.Builder
+	err := RenderDiagnosticsJSON(&out, "main.atl", diagnostics)
+	if err != nil {
+		t.Fatalf("could not render: %s", err)
+	}
+
+	var decoded []map[string]any
+	err = json.Unmarshal([]byte(out.String()), &decoded)
+	if err != nil {
+		t.Fatalf("output is not valid JSON: %s\n%s", err, out.String())
+	}
+	if len(decoded) != 1 {
+		t.Fatalf("wrong number of diagnostics. got=%d", len(decoded))
+	}
+
+	entry := decoded[0]
+	if entry["file"] != "main.atl" || entry["severity"] != "error" || entry["code"] != "P002" || entry["message"] != "Expected expression, found Semicolon" {
+		t.Errorf("wrong diagnostic. got=%v", entry)
+	}
+	start := entry["span"].(map[string]any)["start"].(map[string]any)
+	if start["row"] != 2.0 || start["col"] != 7.0 {
+		t.Errorf("wrong span start. got=%v", start)
+	}
+}
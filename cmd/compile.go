@@ -1,14 +1,8 @@
 package cmd
 
 import (
-	"atlas/compiler"
-	"atlas/parser"
-	"bufio"
-	"bytes"
-	"encoding/gob"
 	"fmt"
 	"os"
-	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -20,69 +14,46 @@ var compileCmd = &cobra.Command{
 	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		outputFile, _ := cmd.Flags().GetString("output")
+		strip, _ := cmd.Flags().GetBool("strip")
 
-		var pars *parser.Parser
-
-		if len(args) == 1 {
-			newParser, err := parser.NewFromFile(args[0])
-			if err != nil {
-				fmt.Println("Could not create parser: ", err)
-				return
-			}
+		format, err := readFormatFlag(cmd)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
 
-			pars = newParser
-		} else {
-			var codeBuffer strings.Builder
-	
-			scanner := bufio.NewScanner(os.Stdin)
-			for scanner.Scan() {
-				line := scanner.Text()
-				codeBuffer.WriteString(line)
-			}
-			
-			if err := scanner.Err(); err != nil {
-				fmt.Fprintln(os.Stderr, "Error reading stdin:", err)
-				return
-			}
-	
-			code := codeBuffer.String()
-	
-			pars = parser.New(&code)
+		code, sourceFile, err := readSource(args)
+		if err != nil {
+			fmt.Println("Could not read source: ", err)
+			return
 		}
 
-		comp := compiler.New()
+		byteCode, ok := compileSource(code, sourceFile, format)
+		if !ok {
+			return
+		}
 
-		program := pars.Parse()
+		if strip {
+			byteCode.Debug = nil
+		}
 
-		if len(pars.Errors) > 0 {
-			fmt.Println("Parsing failed")
-			for _, err := range pars.Errors {
-				fmt.Println(err)
-			}
+		data, err := byteCode.MarshalBinary()
+		if err != nil {
+			fmt.Println("Could not serialize bytecode: ", err)
 			return
 		}
 
-		err := comp.Compile(&program)
+		err = os.WriteFile(outputFile, data, 0644)
 		if err != nil {
-			fmt.Println(err)
+			fmt.Println("Could not write bytecode: ", err)
 			return
 		}
-
-		byteCode := comp.ByteCode()
-
-		compiler.RegisterObjectsToGob()
-
-		var bytesBuffer bytes.Buffer
-		var encoder = gob.NewEncoder(&bytesBuffer)
-		encoder.Encode(byteCode)
-
-		file, _ := os.Create(outputFile)
-		file.Write(bytesBuffer.Bytes())
-		file.Close()
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(compileCmd)
+	addFormatFlag(compileCmd)
 	compileCmd.Flags().StringP("output", "o", "compiled.atlb", "Output file of the compiled bytecode")
-}
\ No newline at end of file
+	compileCmd.Flags().Bool("strip", false, "Do not include debug information in the bytecode")
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"atlas/remote"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var coordinatorCmd = &cobra.Command{
+	Use:   "coordinator",
+	Short: "Schedules bytecode jobs across a pool of workers",
+	Long: `Starts a coordinator accepting worker registrations and bytecode jobs over TCP. Each job is placed on the registered worker running the fewest jobs, and its status, output and result are sent back to the submitter.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		address, _ := cmd.Flags().GetString("listen")
+
+		coordinator, err := remote.NewCoordinator(address)
+		if err != nil {
+			fmt.Println("Could not start coordinator: ", err)
+			return
+		}
+
+		fmt.Printf("Coordinator listening on %s\n", coordinator.Addr())
+		err = coordinator.Serve()
+		if err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(coordinatorCmd)
+	coordinatorCmd.Flags().String("listen", "localhost:7000", "Address the coordinator listens on")
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"atlas/compiler"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var disasmCmd = &cobra.Command{
+	Use:   "disasm",
+	Short: "Prints a human readable listing of a bytecode file",
+	Long: `Prints the constant pool and the instructions of every function of a bytecode file. When the file contains debug information, instructions are shown under the source line they were compiled from.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		byteCodeFilePath := args[0]
+
+		data, err := os.ReadFile(byteCodeFilePath)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		var byteCode compiler.ByteCode
+		err = byteCode.UnmarshalBinary(data)
+		if err != nil {
+			fmt.Printf("Could not load bytecode from %s: %s\n", byteCodeFilePath, err)
+			return
+		}
+
+		fmt.Print(byteCode.Disassemble())
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(disasmCmd)
+}
@@ -2,11 +2,11 @@ package cmd
 
 import (
 	"atlas/compiler"
+	"atlas/remote"
 	"atlas/vm"
-	"bytes"
-	"encoding/gob"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -24,20 +24,20 @@ var executeCmd = &cobra.Command{
 			return
 		}
 
-		compiler.RegisterObjectsToGob()
-
-		var bytesBuffer bytes.Buffer
-		bytesBuffer.Write(data) 
-		decoder := gob.NewDecoder(&bytesBuffer)
-
 		var byteCode compiler.ByteCode
-		err = decoder.Decode(&byteCode)
+		err = byteCode.UnmarshalBinary(data)
 		if err != nil {
-			fmt.Println("Could not deserialize bytecode: ", err)
+			fmt.Printf("Could not load bytecode from %s: %s\n", byteCodeFilePath, err)
+			return
+		}
+
+		remoteAddress, _ := cmd.Flags().GetString("remote")
+		if remoteAddress != "" {
+			executeRemotely(remoteAddress, byteCode)
 			return
 		}
 
-		vm := vm.New(byteCode)
+		vm := vm.New(byteCode, vmOptions(cmd)...)
 		err = vm.Run()
 		if err != nil {
 			fmt.Println(err)
@@ -46,6 +46,59 @@ var executeCmd = &cobra.Command{
 	},
 }
 
+func executeRemotely(address string, byteCode compiler.ByteCode) {
+	client, err := remote.Dial(address)
+	if err != nil {
+		fmt.Printf("Could not connect to %s: %s\n", address, err)
+		return
+	}
+	defer client.Close()
+
+	// Progress reported by coordinators goes to stderr, apart from the output of the program
+	client.OnStatus = func(status remote.JobStatus) {
+		if status.State == remote.JOB_RUNNING {
+			fmt.Fprintf(os.Stderr, "Job %d running on %s\n", status.Job, status.Worker)
+		}
+	}
+
+	err = client.Execute(byteCode, os.Stdout)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+}
+
+func addVMFlags(cmd *cobra.Command) {
+	cmd.Flags().String("spawn-on", "", "Address of a worker or coordinator to run spawned calls on instead of tasks of the VM")
+	cmd.Flags().Int64("seed", 0, "Seed picking the order in which tasks run, to reproduce an interleaving")
+	cmd.Flags().Int("max-instructions", 0, "Stops the program after this many instructions, 0 for no limit")
+	cmd.Flags().Duration("timeout", 0, "Stops the program after running for this long, 0 for no limit")
+}
+
+// Options of the VM running the program, as set by the flags added by addVMFlags
+func vmOptions(cmd *cobra.Command) []vm.Option {
+	options := []vm.Option{vm.WithInput(os.Stdin)}
+	if cmd.Flags().Changed("seed") {
+		seed, _ := cmd.Flags().GetInt64("seed")
+		options = append(options, vm.WithSeed(seed))
+	}
+
+	maxInstructions, _ := cmd.Flags().GetInt("max-instructions")
+	options = append(options, vm.WithMaxInstructions(maxInstructions))
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	if timeout > 0 {
+		options = append(options, vm.WithDeadline(time.Now().Add(timeout)))
+	}
+
+	address, _ := cmd.Flags().GetString("spawn-on")
+	if address != "" {
+		options = append(options, vm.WithExecutor(&remote.Executor{Address: address}))
+	}
+	return options
+}
+
 func init() {
 	rootCmd.AddCommand(executeCmd)
+	executeCmd.Flags().String("remote", "", "Address of a worker or coordinator to run the bytecode on instead of running it locally")
+	addVMFlags(executeCmd)
 }
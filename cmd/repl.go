@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"atlas/repl"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var replCmd = &cobra.Command{
+	Use:   "repl",
+	Short: "Starts an interactive Atlas session",
+	Long: `Reads statements from stdin and runs them one after another. Declarations are kept between inputs and the values of expressions are echoed. Type :help to list the REPL commands.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		repl.Start(os.Stdin, os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(replCmd)
+}
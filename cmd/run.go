@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"atlas/vm"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run [file]",
+	Short: "Compiles and executes Atlas code",
+	Long: `Compiles code from provided file and executes it right away, without writing bytecode to disk. If a file is not provided, the code run is the content of stdin.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		format, err := readFormatFlag(cmd)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		code, sourceFile, err := readSource(args)
+		if err != nil {
+			fmt.Println("Could not read source: ", err)
+			return
+		}
+
+		byteCode, ok := compileSource(code, sourceFile, format)
+		if !ok {
+			return
+		}
+
+		vm := vm.New(byteCode, vmOptions(cmd)...)
+		err = vm.Run()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+	addFormatFlag(runCmd)
+	addVMFlags(runCmd)
+}
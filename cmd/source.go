@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"atlas/checker"
+	"atlas/cli"
+	"atlas/compiler"
+	"atlas/diagnostic"
+	"atlas/parser"
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Formats of the diagnostics printed when compilation fails
+const (
+	FORMAT_TEXT = "text"
+	FORMAT_JSON = "json"
+)
+
+// Reads the code of the file given in args, or the content of stdin when there is none
+func readSource(args []string) (string, string, error) {
+	if len(args) == 1 {
+		content, err := os.ReadFile(args[0])
+		if err != nil {
+			return "", "", err
+		}
+		return string(content), args[0], nil
+	}
+
+	var codeBuffer strings.Builder
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := scanner.Text()
+		codeBuffer.WriteString(line)
+		codeBuffer.WriteRune('\n')
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", "", fmt.Errorf("error reading stdin: %w", err)
+	}
+
+	return codeBuffer.String(), "<stdin>", nil
+}
+
+// Adds the flag choosing the format of diagnostics to a command compiling source
+func addFormatFlag(cmd *cobra.Command) {
+	cmd.Flags().String("format", FORMAT_TEXT, "Format of the diagnostics, text or json")
+}
+
+func readFormatFlag(cmd *cobra.Command) (string, error) {
+	format, _ := cmd.Flags().GetString("format")
+	if format != FORMAT_TEXT && format != FORMAT_JSON {
+		return "", fmt.Errorf("unknown diagnostics format `%s`, expected %s or %s", format, FORMAT_TEXT, FORMAT_JSON)
+	}
+	return format, nil
+}
+
+// Parses, type checks and compiles code. Errors are printed in format and reported by returning false.
+func compileSource(code string, sourceFile string, format string) (compiler.ByteCode, bool) {
+	pars := parser.New(&code)
+
+	comp := compiler.New()
+
+	program := pars.Parse()
+
+	if len(pars.Errors) > 0 {
+		printDiagnostics(code, sourceFile, format, pars.Errors)
+		return compiler.ByteCode{}, false
+	}
+
+	check := checker.New()
+	check.Check(&program)
+
+	if len(check.Errors) > 0 {
+		printDiagnostics(code, sourceFile, format, check.Errors)
+		return compiler.ByteCode{}, false
+	}
+
+	err := comp.Compile(&program)
+	var compileError *compiler.Error
+	if errors.As(err, &compileError) {
+		printDiagnostics(code, sourceFile, format, []diagnostic.Diagnostic{compileError.Diagnostic})
+		return compiler.ByteCode{}, false
+	}
+	if err != nil {
+		fmt.Println(err)
+		return compiler.ByteCode{}, false
+	}
+
+	byteCode := comp.ByteCode()
+	byteCode.Debug.File = sourceFile
+	byteCode.Debug.Source = code
+
+	return byteCode, true
+}
+
+func printDiagnostics(code string, sourceFile string, format string, diagnostics []diagnostic.Diagnostic) {
+	if format == FORMAT_JSON {
+		err := cli.RenderDiagnosticsJSON(os.Stdout, sourceFile, diagnostics)
+		if err != nil {
+			fmt.Println("Could not write diagnostics: ", err)
+		}
+		return
+	}
+	cli.RenderDiagnostics(os.Stdout, sourceFile, code, diagnostics)
+}
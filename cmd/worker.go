@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"atlas/remote"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var workerCmd = &cobra.Command{
+	Use:   "worker",
+	Short: "Runs bytecode jobs submitted by remote clients",
+	Long: `Starts a worker node accepting bytecode jobs over TCP. Every job runs in its own VM and its output is streamed back to the client.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		address, _ := cmd.Flags().GetString("listen")
+
+		worker, err := remote.NewWorker(address)
+		if err != nil {
+			fmt.Println("Could not start worker: ", err)
+			return
+		}
+		worker.MaxInstructions, _ = cmd.Flags().GetInt("max-instructions")
+		worker.Timeout, _ = cmd.Flags().GetDuration("timeout")
+
+		fmt.Printf("Worker listening on %s\n", worker.Addr())
+
+		coordinatorAddress, _ := cmd.Flags().GetString("coordinator")
+		if coordinatorAddress != "" {
+			advertisedAddress, _ := cmd.Flags().GetString("advertise")
+			if advertisedAddress == "" {
+				advertisedAddress = worker.Addr().String()
+			}
+
+			err = worker.Register(coordinatorAddress, advertisedAddress)
+			if err != nil {
+				fmt.Println(err)
+				worker.Close()
+				return
+			}
+			fmt.Printf("Registered to coordinator %s as %s\n", coordinatorAddress, advertisedAddress)
+		}
+
+		err = worker.Serve()
+		if err != nil {
+			fmt.Println(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(workerCmd)
+	workerCmd.Flags().String("listen", "localhost:7070", "Address the worker listens on")
+	workerCmd.Flags().String("coordinator", "", "Address of a coordinator to join")
+	workerCmd.Flags().String("advertise", "", "Address the coordinator sends jobs to, the listening address by default")
+	workerCmd.Flags().Int("max-instructions", 0, "Instructions a job or call may run before it is stopped, 0 for no limit")
+	workerCmd.Flags().Duration("timeout", 0, "Time a job or call may run before it is stopped, 0 for no limit")
+}
@@ -0,0 +1,268 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+var ErrAssertion = errors.New("assertion failed")
+
+// Functions every program can call without declaring them. BUILTIN_GET refers to them by
+// their index in this table, new ones are appended so that compiled programs keep working.
+var BUILTINS = []*Builtin{
+	{Name: "print", Function: builtinPrint},
+	{Name: "println", Function: builtinPrintln},
+	{Name: "len", Function: builtinLen},
+	{Name: "abs", Function: builtinAbs},
+	{Name: "min", Function: builtinMin},
+	{Name: "max", Function: builtinMax},
+	{Name: "assert", Function: builtinAssert},
+	{Name: "panic", Function: builtinPanic},
+	{Name: "delete", Function: builtinDelete},
+	{Name: "has", Function: builtinHas},
+	{Name: "keys", Function: builtinKeys},
+}
+
+// Index of the built-in function called name in BUILTINS
+func LookupBuiltin(name string) (int, bool) {
+	for index, builtin := range BUILTINS {
+		if builtin.Name == name {
+			return index, true
+		}
+	}
+	return 0, false
+}
+
+func checkArgsCount(name string, args []Object, expected int) error {
+	if len(args) != expected {
+		return fmt.Errorf("wrong number of arguments when calling `%s`: expected %d, got %d", name, expected, len(args))
+	}
+	return nil
+}
+
+// Writes the values separated by spaces
+func builtinPrint(output io.Writer, args []Object) (Object, error) {
+	values := make([]string, len(args))
+	for i, arg := range args {
+		values[i] = arg.Inspect()
+	}
+	_, err := io.WriteString(output, strings.Join(values, " "))
+	return Null, err
+}
+
+func builtinPrintln(output io.Writer, args []Object) (Object, error) {
+	_, err := builtinPrint(output, args)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.WriteString(output, "\n")
+	return Null, err
+}
+
+// Number of bytes of a string, of elements of an array, of pairs of a map or of values waiting
+// in a channel
+func builtinLen(output io.Writer, args []Object) (Object, error) {
+	err := checkArgsCount("len", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	switch arg := args[0].(type) {
+	case *String:
+		return &UnsignedInteger{Value: uint64(len(arg.Value))}, nil
+	case *Array:
+		return &UnsignedInteger{Value: uint64(len(arg.Elements))}, nil
+	case *Map:
+		return &UnsignedInteger{Value: uint64(len(arg.Pairs))}, nil
+	case *Channel:
+		if arg.IsProxy() {
+			return nil, fmt.Errorf("cannot take the length of a channel living on another node")
+		}
+		return &UnsignedInteger{Value: uint64(arg.Len())}, nil
+	}
+	return nil, fmt.Errorf("cannot take the length of a value of type `%s`", args[0].Type())
+}
+
+func builtinAbs(output io.Writer, args []Object) (Object, error) {
+	err := checkArgsCount("abs", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	switch arg := args[0].(type) {
+	case *UnsignedInteger:
+		return arg, nil
+	case *Float:
+		return &Float{Value: math.Abs(arg.Value)}, nil
+	case *Integer:
+		if arg.Value == math.MinInt64 {
+			return nil, fmt.Errorf("overflow error when trying to apply `abs` on `%d`", arg.Value)
+		}
+		if arg.Value < 0 {
+			return &Integer{Value: -arg.Value}, nil
+		}
+		return arg, nil
+	}
+	return nil, fmt.Errorf("cannot apply `abs` on a value of type `%s`", args[0].Type())
+}
+
+func builtinMin(output io.Writer, args []Object) (Object, error) {
+	return extremum("min", args, func(left int, right int) bool { return left < right })
+}
+
+func builtinMax(output io.Writer, args []Object) (Object, error) {
+	return extremum("max", args, func(left int, right int) bool { return left > right })
+}
+
+// Finds the number of args that wins every comparison with better. Like arithmetic, the
+// result is a float when any number is, and unsigned only when all the integers are.
+func extremum(name string, args []Object, better func(left int, right int) bool) (Object, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("wrong number of arguments when calling `%s`: expected at least 1, got 0", name)
+	}
+	signed, floating := false, false
+	for _, arg := range args {
+		if !IsObjectNumber(arg) && arg.Type() != FLOAT {
+			return nil, fmt.Errorf("cannot apply `%s` on a value of type `%s`", name, arg.Type())
+		}
+		signed = signed || arg.Type() == INTEGER
+		floating = floating || arg.Type() == FLOAT
+	}
+
+	if floating {
+		best, _ := FloatValue(args[0])
+		for _, arg := range args[1:] {
+			value, _ := FloatValue(arg)
+			if better(compareOrdered(value, best), 0) {
+				best = value
+			}
+		}
+		return &Float{Value: best}, nil
+	}
+
+	best := args[0]
+	for _, arg := range args[1:] {
+		if better(CompareIntegers(arg, best), 0) {
+			best = arg
+		}
+	}
+	if unsigned, ok := best.(*UnsignedInteger); ok && signed {
+		if unsigned.Value > math.MaxInt64 {
+			return nil, fmt.Errorf("overflow error when converting `%d` to a signed integer", unsigned.Value)
+		}
+		return &Integer{Value: int64(unsigned.Value)}, nil
+	}
+	return best, nil
+}
+
+// Compares two integer objects by their values, whatever their signedness: -1 when left is
+// lower, 0 when equal, 1 when greater
+func CompareIntegers(left Object, right Object) int {
+	leftNegative := left.Type() == INTEGER && left.(*Integer).Value < 0
+	rightNegative := right.Type() == INTEGER && right.(*Integer).Value < 0
+	switch {
+	case leftNegative && !rightNegative:
+		return -1
+	case !leftNegative && rightNegative:
+		return 1
+	case leftNegative && rightNegative:
+		return compareOrdered(left.(*Integer).Value, right.(*Integer).Value)
+	}
+	return compareOrdered(magnitude(left), magnitude(right))
+}
+
+func magnitude(integer Object) uint64 {
+	if signed, ok := integer.(*Integer); ok {
+		return uint64(signed.Value)
+	}
+	return integer.(*UnsignedInteger).Value
+}
+
+func compareOrdered[T int64 | uint64 | float64](left T, right T) int {
+	switch {
+	case left < right:
+		return -1
+	case left > right:
+		return 1
+	}
+	return 0
+}
+
+// Fails the program with ErrAssertion when the condition is false
+func builtinAssert(output io.Writer, args []Object) (Object, error) {
+	err := checkArgsCount("assert", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	condition, ok := args[0].(*Boolean)
+	if !ok {
+		return nil, fmt.Errorf("cannot assert a value of type `%s`", args[0].Type())
+	}
+	if !condition.Value {
+		return nil, ErrAssertion
+	}
+	return Null, nil
+}
+
+// Fails the program with the value as message
+func builtinPanic(output io.Writer, args []Object) (Object, error) {
+	err := checkArgsCount("panic", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("panic: %s", args[0].Inspect())
+}
+
+// Removes the pair of the key from the map, if there is one
+func builtinDelete(output io.Writer, args []Object) (Object, error) {
+	hashMap, hashKey, err := mapAndKey("delete", args)
+	if err != nil {
+		return nil, err
+	}
+	delete(hashMap.Pairs, hashKey)
+	return Null, nil
+}
+
+// Checks if the map has a pair for the key
+func builtinHas(output io.Writer, args []Object) (Object, error) {
+	hashMap, hashKey, err := mapAndKey("has", args)
+	if err != nil {
+		return nil, err
+	}
+	_, ok := hashMap.Pairs[hashKey]
+	return ParseBooleanFromNative(ok), nil
+}
+
+// Array of the keys of the map in order, to iterate over its pairs
+func builtinKeys(output io.Writer, args []Object) (Object, error) {
+	err := checkArgsCount("keys", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	hashMap, ok := args[0].(*Map)
+	if !ok {
+		return nil, fmt.Errorf("cannot apply `keys` on a value of type `%s`", args[0].Type())
+	}
+	keys := []Object{}
+	for _, pair := range hashMap.SortedPairs() {
+		keys = append(keys, pair.Key)
+	}
+	return &Array{Elements: keys}, nil
+}
+
+func mapAndKey(name string, args []Object) (*Map, HashKey, error) {
+	err := checkArgsCount(name, args, 2)
+	if err != nil {
+		return nil, HashKey{}, err
+	}
+	hashMap, ok := args[0].(*Map)
+	if !ok {
+		return nil, HashKey{}, fmt.Errorf("cannot apply `%s` on a value of type `%s`", name, args[0].Type())
+	}
+	key, ok := args[1].(Hashable)
+	if !ok {
+		return nil, HashKey{}, fmt.Errorf("cannot use a value of type `%s` as map key", args[1].Type())
+	}
+	return hashMap, key.HashKey(), nil
+}
@@ -1,24 +1,57 @@
 package compiler
 
 import (
+	"atlas/lexer"
 	"atlas/parser"
-	"fmt"
+	"math"
 )
 
-type Compiler struct {
+// Instructions being emitted for the program or for a function body
+type CompilationScope struct {
 	instructions Instructions
-	constants    []Object
-	symbolTable  *SymbolTable
+	lines        LineTable
+}
+
+type Compiler struct {
+	constants   []Object
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	position      *lexer.Token      // Token of the node being compiled, recorded in line tables
+	functionLines map[int]LineTable // Line tables of compiled functions by constant index
 }
 
 func New() Compiler {
-	return Compiler{
+	mainScope := CompilationScope{
 		instructions: Instructions{},
-		symbolTable:  NewSymbolTable(),
 	}
+
+	return Compiler{
+		symbolTable:   NewSymbolTable(),
+		scopes:        []CompilationScope{mainScope},
+		scopeIndex:    0,
+		functionLines: make(map[int]LineTable),
+	}
+}
+
+// Creates a compiler continuing a previous compilation: symbols and constants already known are
+// kept, like between the inputs of the REPL
+func NewWithState(symbolTable *SymbolTable, constants []Object) Compiler {
+	compiler := New()
+	compiler.symbolTable = symbolTable
+	compiler.constants = constants
+	return compiler
 }
 
 func (compiler *Compiler) Compile(program parser.Node) error {
+	if token := program.GetToken(); token != nil {
+		outerPosition := compiler.position
+		compiler.position = token
+		defer func() { compiler.position = outerPosition }()
+	}
+
 	switch node := program.(type) {
 	case *parser.Program:
 		for _, stmt := range node.Statements {
@@ -28,35 +61,57 @@ func (compiler *Compiler) Compile(program parser.Node) error {
 			}
 		}
 	case *parser.StatementsBlock:
-		for _, stmt := range node.Statements {
-			err := compiler.Compile(stmt)
-			if err != nil {
-				return err
-			}
+		compiler.enterBlock()
+		err := compiler.compileStatements(node)
+		compiler.leaveBlock()
+		if err != nil {
+			return err
 		}
 	case *parser.DeclarationStatement:
 		err := compiler.Compile(node.Value)
 		if err != nil {
 			return err
 		}
-		symbol := compiler.symbolTable.Define(node.Name.Value)
-		compiler.emit(GLOBAL_SET, symbol.Index)
+		// Defined after the value so that `var x = x;` can refer to an outer `x`
+		symbol, err := compiler.define(node.Name)
+		if err != nil {
+			return err
+		}
+		compiler.emitSet(symbol)
 	case *parser.AssignmentStatement:
 		err := compiler.Compile(node.Value)
 		if err != nil {
 			return err
 		}
 		symbol, ok := compiler.symbolTable.Resolve(node.Name.Value)
-		if ok {
-			compiler.emit(GLOBAL_SET, symbol.Index)
-		} else {
-			return fmt.Errorf("cannot assign new value to undeclared variable `%s`", node.Name.Value)
+		if !ok {
+			return errorAt(UNDEFINED_SYMBOL, node.Name.Token, "cannot assign new value to undeclared variable `%s`", node.Name.Value)
+		}
+		if symbol.Scope == BuiltinScope {
+			return errorAt(INVALID_TARGET, node.Name.Token, "cannot assign new value to built-in function `%s`", node.Name.Value)
+		}
+		compiler.emitSet(symbol)
+	case *parser.IndexAssignmentStatement:
+		err := compiler.Compile(node.Target.Left)
+		if err != nil {
+			return err
+		}
+		err = compiler.Compile(node.Target.Index)
+		if err != nil {
+			return err
 		}
+		err = compiler.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		// Out of bounds errors point at the index
+		compiler.position = node.Target.Token
+		compiler.emit(INDEX_SET)
 	case *parser.IfStatement:
 		blockEndJumpPositions := []int{}
 		lastBlockIndex := len(node.Consequences) - 1
 		for i, conseq := range node.Consequences {
-			err := compiler.Compile(node.Conditions[0])
+			err := compiler.Compile(node.Conditions[i])
 			if err != nil {
 				return err
 			}
@@ -73,7 +128,7 @@ func (compiler *Compiler) Compile(program parser.Node) error {
 				blockEndJumpPositions = append(blockEndJumpPositions, jump)
 			}
 
-			postConsequence := len(compiler.instructions)
+			postConsequence := len(compiler.currentInstructions())
 			compiler.changeOperand(jumpOpPosition, postConsequence)
 		}
 		if node.Else != nil {
@@ -83,16 +138,16 @@ func (compiler *Compiler) Compile(program parser.Node) error {
 			}
 		}
 		for _, blockEndJumpPosition := range blockEndJumpPositions {
-			postIf := len(compiler.instructions)
+			postIf := len(compiler.currentInstructions())
 			compiler.changeOperand(blockEndJumpPosition, postIf)
 		}
 	case *parser.LoopStatement:
-		offsetPreCondition := len(compiler.instructions)
+		offsetPreCondition := len(compiler.currentInstructions())
 		err := compiler.Compile(node.Condition)
 		if err != nil {
 			return err
 		}
-		offsetPostCondition := len(compiler.instructions)
+		offsetPostCondition := len(compiler.currentInstructions())
 		offset := offsetPostCondition - offsetPreCondition
 
 		jumpOpPosition := compiler.emit(JNT, 0)
@@ -104,28 +159,142 @@ func (compiler *Compiler) Compile(program parser.Node) error {
 
 		compiler.emit(JUMP, jumpOpPosition - offset)
 
-		postBlock := len(compiler.instructions)
+		postBlock := len(compiler.currentInstructions())
 		compiler.changeOperand(jumpOpPosition, postBlock)
 	case *parser.InputStatement:
 		symbol, ok := compiler.symbolTable.Resolve(node.Name.Value)
-		if ok {
-			compiler.emit(IN, symbol.Index)
-		} else {
-			return fmt.Errorf("cannot assign new value to undeclared variable `%s`", node.Name.Value)
+		if !ok {
+			return errorAt(UNDEFINED_SYMBOL, node.Name.Token, "cannot assign new value to undeclared variable `%s`", node.Name.Value)
+		}
+		if symbol.Scope == BuiltinScope {
+			return errorAt(INVALID_TARGET, node.Name.Token, "cannot assign new value to built-in function `%s`", node.Name.Value)
+		}
+		// IN reads a value of the same type as the current one
+		compiler.emitGet(symbol)
+		compiler.emit(IN)
+		compiler.emitSet(symbol)
+	case *parser.FunctionDeclarationStatement:
+		if compiler.symbolTable.Outer != nil {
+			return errorAt(NESTED_FUNCTION, node.Token, "function `%s` must be declared at top level", node.Name.Value)
+		}
+		if node.Body == nil {
+			return errorAt(MISSING_BODY, node.Token, "function `%s` has no body", node.Name.Value)
+		}
+
+		// Defined before compiling the body so that the function can call itself
+		symbol, err := compiler.define(node.Name)
+		if err != nil {
+			return err
+		}
+
+		compiler.enterScope()
+		err = compiler.compileFunctionBody(node)
+		numLocals := compiler.symbolTable.NumLocals()
+		instructions, lines := compiler.leaveScope()
+		if err != nil {
+			return err
 		}
+
+		function := &CompiledFunction{
+			Name:          node.Name.Value,
+			Instructions:  instructions,
+			NumLocals:     numLocals,
+			NumParameters: len(node.ArgsNames),
+		}
+		constantIndex := compiler.registerConstant(function)
+		compiler.functionLines[constantIndex] = lines
+		compiler.emit(CONST, constantIndex)
+		compiler.emitSet(symbol)
 	case *parser.ReturnStatement:
 		err := compiler.Compile(node.Expression)
 		if err != nil {
 			return err
 		}
-		compiler.emit(OUT)
+		if compiler.scopeIndex > 0 {
+			compiler.emit(RETURN_VALUE)
+		} else {
+			compiler.emit(OUT)
+		}
 	case *parser.ExpressionStatement:
 		err := compiler.Compile(node.Expression)
 		if err != nil {
 			return err
 		}
-		// compiler.emit(POP)
+		compiler.emit(POP)
+	case *parser.CallExpression:
+		err := compiler.Compile(node.Function)
+		if err != nil {
+			return err
+		}
+		for _, arg := range node.Arguments {
+			err := compiler.Compile(arg)
+			if err != nil {
+				return err
+			}
+		}
+		compiler.emit(CALL, len(node.Arguments))
+	case *parser.SpawnExpression:
+		err := compiler.Compile(node.Call.Function)
+		if err != nil {
+			return err
+		}
+		for _, arg := range node.Call.Arguments {
+			err := compiler.Compile(arg)
+			if err != nil {
+				return err
+			}
+		}
+		compiler.emit(SPAWN, len(node.Call.Arguments))
+	case *parser.AwaitExpression:
+		err := compiler.Compile(node.Future)
+		if err != nil {
+			return err
+		}
+		compiler.emit(AWAIT)
+	case *parser.ChannelExpression:
+		if node.Capacity != nil {
+			err := compiler.Compile(node.Capacity)
+			if err != nil {
+				return err
+			}
+		} else {
+			compiler.emit(CONST, compiler.registerConstant(&UnsignedInteger{Value: 0}))
+		}
+		compiler.emit(MAKE_CHANNEL)
+	case *parser.RecvExpression:
+		err := compiler.Compile(node.Channel)
+		if err != nil {
+			return err
+		}
+		zero, ok := zeroValue(node.ElementType)
+		if !ok {
+			compiler.emit(RECV, NO_ZERO_VALUE)
+		} else {
+			compiler.emit(RECV, compiler.registerConstant(zero))
+		}
+	case *parser.SendStatement:
+		err := compiler.Compile(node.Channel)
+		if err != nil {
+			return err
+		}
+		err = compiler.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		compiler.emit(SEND)
+	case *parser.CloseStatement:
+		err := compiler.Compile(node.Channel)
+		if err != nil {
+			return err
+		}
+		compiler.emit(CLOSE)
 	case *parser.PrefixExpression:
+		// The lowest signed integer has no positive counterpart to negate at runtime
+		if literal, ok := node.Right.(*parser.UnsignedIntegerLiteralExpression); ok && node.Operator == "-" && literal.Type != parser.FLOAT && literal.Value == -math.MinInt64 {
+			integer := Integer{Value: math.MinInt64}
+			compiler.emit(CONST, compiler.registerConstant(&integer))
+			return nil
+		}
 		err := compiler.Compile(node.Right)
 		if err != nil {
 			return err
@@ -135,10 +304,25 @@ func (compiler *Compiler) Compile(program parser.Node) error {
 			compiler.emit(BANG)
 		case "-":
 			compiler.emit(MINUS)
+		case "~":
+			compiler.emit(BIT_NOT)
 		default:
-			return fmt.Errorf("unknown operator %s", node.Operator)
+			return errorAt(UNSUPPORTED_NODE, node.Token, "unknown operator %s", node.Operator)
 		}
+	case *parser.ConversionExpression:
+		err := compiler.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		tag, ok := CONVERSION_TAGS[node.Type]
+		if !ok {
+			return errorAt(UNSUPPORTED_NODE, node.Token, "cannot convert a value to %s", node.Type)
+		}
+		compiler.emit(CONVERT, int(tag))
 	case *parser.InfixExpression:
+		if node.Operator == "&&" || node.Operator == "||" {
+			return compiler.compileLogicalExpression(node)
+		}
 		if node.Operator == "<" || node.Operator == "<=" {
 			err := compiler.Compile(node.Right)
 			if err != nil {
@@ -185,12 +369,73 @@ func (compiler *Compiler) Compile(program parser.Node) error {
 			compiler.emit(GT)
 		case ">=":
 			compiler.emit(GEQ)
+		case "&":
+			compiler.emit(BIT_AND)
+		case "|":
+			compiler.emit(BIT_OR)
+		case "^":
+			compiler.emit(BIT_XOR)
+		case "<<":
+			compiler.emit(SHL)
+		case ">>":
+			compiler.emit(SHR)
 		default:
-			return fmt.Errorf("unknown operator %s", node.Operator)
+			return errorAt(UNSUPPORTED_NODE, node.Token, "unknown operator %s", node.Operator)
 		}
 	case *parser.UnsignedIntegerLiteralExpression:
-		integer := UnsignedInteger{Value: node.Value}
-		compiler.emit(CONST, compiler.registerConstant(&integer))
+		// Integer literals used as signed integers or floats have that type from the start
+		if node.Type == parser.FLOAT {
+			float := Float{Value: float64(node.Value)}
+			compiler.emit(CONST, compiler.registerConstant(&float))
+		} else if node.Type == parser.INT {
+			integer := Integer{Value: int64(node.Value)}
+			compiler.emit(CONST, compiler.registerConstant(&integer))
+		} else {
+			integer := UnsignedInteger{Value: node.Value}
+			compiler.emit(CONST, compiler.registerConstant(&integer))
+		}
+	case *parser.FloatLiteralExpression:
+		float := Float{Value: node.Value}
+		compiler.emit(CONST, compiler.registerConstant(&float))
+	case *parser.StringLiteralExpression:
+		str := String{Value: node.Value}
+		compiler.emit(CONST, compiler.registerConstant(&str))
+	case *parser.ArrayLiteralExpression:
+		if len(node.Elements) > math.MaxUint16 {
+			return errorAt(LIMIT_EXCEEDED, node.Token, "too many elements in array literal: %d, at most %d are allowed", len(node.Elements), math.MaxUint16)
+		}
+		for _, element := range node.Elements {
+			err := compiler.Compile(element)
+			if err != nil {
+				return err
+			}
+		}
+		compiler.emit(ARRAY, len(node.Elements))
+	case *parser.MapLiteralExpression:
+		if len(node.Keys) > math.MaxUint16 {
+			return errorAt(LIMIT_EXCEEDED, node.Token, "too many pairs in map literal: %d, at most %d are allowed", len(node.Keys), math.MaxUint16)
+		}
+		for i, key := range node.Keys {
+			err := compiler.Compile(key)
+			if err != nil {
+				return err
+			}
+			err = compiler.Compile(node.Values[i])
+			if err != nil {
+				return err
+			}
+		}
+		compiler.emit(MAP, len(node.Keys))
+	case *parser.IndexExpression:
+		err := compiler.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+		err = compiler.Compile(node.Index)
+		if err != nil {
+			return err
+		}
+		compiler.emit(INDEX_GET)
 	case *parser.BooleanLiteralExpression:
 		if node.Value {
 			compiler.emit(TRUE)
@@ -200,13 +445,130 @@ func (compiler *Compiler) Compile(program parser.Node) error {
 	case *parser.Identifier:
 		symbol, ok := compiler.symbolTable.Resolve(node.Value)
 		if !ok {
-			return fmt.Errorf("undefined symbol %s", node.Value)
+			return errorAt(UNDEFINED_SYMBOL, node.Token, "undefined symbol %s", node.Value)
 		}
-		compiler.emit(GLOBAL_GET, symbol.Index)
+		compiler.emitGet(symbol)
 	}
 	return nil
 }
 
+func (compiler *Compiler) emitGet(symbol Symbol) int {
+	switch symbol.Scope {
+	case LocalScope:
+		return compiler.emit(LOCAL_GET, symbol.Index)
+	case BuiltinScope:
+		return compiler.emit(BUILTIN_GET, symbol.Index)
+	}
+	return compiler.emit(GLOBAL_GET, symbol.Index)
+}
+
+func (compiler *Compiler) emitSet(symbol Symbol) int {
+	if symbol.Scope == LocalScope {
+		return compiler.emit(LOCAL_SET, symbol.Index)
+	}
+	return compiler.emit(GLOBAL_SET, symbol.Index)
+}
+
+// Compiles && and || so that the right operand is only evaluated when it decides the result
+func (compiler *Compiler) compileLogicalExpression(node *parser.InfixExpression) error {
+	err := compiler.Compile(node.Left)
+	if err != nil {
+		return err
+	}
+
+	jumpOpPosition := compiler.emit(JNT, 0)
+
+	if node.Operator == "&&" {
+		err = compiler.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+		endJumpPosition := compiler.emit(JUMP, 0)
+
+		compiler.changeOperand(jumpOpPosition, len(compiler.currentInstructions()))
+		compiler.emit(FALSE)
+		compiler.changeOperand(endJumpPosition, len(compiler.currentInstructions()))
+	} else {
+		compiler.emit(TRUE)
+		endJumpPosition := compiler.emit(JUMP, 0)
+
+		compiler.changeOperand(jumpOpPosition, len(compiler.currentInstructions()))
+		err = compiler.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+		compiler.changeOperand(endJumpPosition, len(compiler.currentInstructions()))
+	}
+	return nil
+}
+
+func (compiler *Compiler) compileStatements(block *parser.StatementsBlock) error {
+	for _, stmt := range block.Statements {
+		err := compiler.Compile(stmt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Compiles the parameters and the body of a function in the scope entered for it
+func (compiler *Compiler) compileFunctionBody(node *parser.FunctionDeclarationStatement) error {
+	for _, arg := range node.ArgsNames {
+		_, err := compiler.define(arg)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Parameters and body share the same scope
+	err := compiler.compileStatements(node.Body)
+	if err != nil {
+		return err
+	}
+	// Reached only when the body falls through without returning
+	compiler.emit(RETURN)
+	return nil
+}
+
+// Defines a new symbol in the current scope. Names can shadow outer scopes but not be declared twice in the same one.
+func (compiler *Compiler) define(name *parser.Identifier) (Symbol, error) {
+	if compiler.symbolTable.IsDefinedInScope(name.Value) {
+		return Symbol{}, errorAt(REDECLARED_SYMBOL, name.Token, "`%s` is already declared in this scope", name.Value)
+	}
+	symbol := compiler.symbolTable.Define(name.Value)
+	if symbol.Scope == LocalScope && symbol.Index > math.MaxUint8 {
+		return Symbol{}, errorAt(LIMIT_EXCEEDED, name.Token, "too many local variables, cannot declare `%s`", name.Value)
+	}
+	return symbol, nil
+}
+
+// Object tags of the types values can be converted to, operands of CONVERT
+var CONVERSION_TAGS = map[parser.DataType]byte{
+	parser.INT:   TAG_INTEGER,
+	parser.UINT:  TAG_UNSIGNED_INTEGER,
+	parser.FLOAT: TAG_FLOAT,
+	parser.BOOL:  TAG_BOOLEAN,
+}
+
+// Value received from a closed channel of elements of dataType. Integer literals default to
+// unsigned integers, composite types have no zero value.
+func zeroValue(dataType parser.DataType) (Object, bool) {
+	switch dataType {
+	case parser.INFERED, parser.UINT:
+		return &UnsignedInteger{Value: 0}, true
+	case parser.INT:
+		return &Integer{Value: 0}, true
+	case parser.FLOAT:
+		return &Float{Value: 0}, true
+	case parser.BOOL:
+		return False, true
+	case parser.STRING:
+		return &String{Value: ""}, true
+	}
+	return nil, false
+}
+
 func (compiler *Compiler) registerConstant(obj Object) int {
 	compiler.constants = append(compiler.constants, obj)
 	return len(compiler.constants) - 1
@@ -215,30 +577,77 @@ func (compiler *Compiler) registerConstant(obj Object) int {
 func (compiler *Compiler) emit(opCode OpCode, operands ...int) int {
 	instruction := MakeInstruction(opCode, operands...)
 	position := compiler.addInstruction(instruction)
+	if compiler.position != nil {
+		compiler.scopes[compiler.scopeIndex].lines.add(position, compiler.position.Row, compiler.position.Col)
+	}
 	return position
 }
 
 func (compiler *Compiler) addInstruction(instruction []byte) int {
-	newInstPosition := len(compiler.instructions)
-	compiler.instructions = append(compiler.instructions, instruction...)
+	newInstPosition := len(compiler.currentInstructions())
+	compiler.scopes[compiler.scopeIndex].instructions = append(compiler.currentInstructions(), instruction...)
 	return newInstPosition
 }
 
 func (c *Compiler) replaceInstruction(position int, newInstruction []byte) {
+	instructions := c.currentInstructions()
 	for i := 0; i < len(newInstruction); i++ {
-		c.instructions[position+i] = newInstruction[i]
+		instructions[position+i] = newInstruction[i]
 	}
 }
 
 func (compiler *Compiler) changeOperand(opPosition int, operand int) {
-	op := OpCode(compiler.instructions[opPosition])
+	op := OpCode(compiler.currentInstructions()[opPosition])
 	newInstruction := MakeInstruction(op, operand)
 	compiler.replaceInstruction(opPosition, newInstruction)
 }
 
+func (compiler *Compiler) currentInstructions() Instructions {
+	return compiler.scopes[compiler.scopeIndex].instructions
+}
+
+// Starts compiling a function body with its own instructions and symbols
+func (compiler *Compiler) enterScope() {
+	scope := CompilationScope{
+		instructions: Instructions{},
+	}
+	compiler.scopes = append(compiler.scopes, scope)
+	compiler.scopeIndex++
+
+	compiler.symbolTable = NewEnclosedSymbolTable(compiler.symbolTable)
+}
+
+// Starts a block whose declarations are not visible once it ends
+func (compiler *Compiler) enterBlock() {
+	compiler.symbolTable = NewBlockSymbolTable(compiler.symbolTable)
+}
+
+func (compiler *Compiler) leaveBlock() {
+	compiler.symbolTable.ReleaseLocals()
+	compiler.symbolTable = compiler.symbolTable.Outer
+}
+
+// Ends the current function body and returns its instructions with their source positions
+func (compiler *Compiler) leaveScope() (Instructions, LineTable) {
+	instructions := compiler.currentInstructions()
+	lines := compiler.scopes[compiler.scopeIndex].lines
+
+	compiler.scopes = compiler.scopes[:len(compiler.scopes)-1]
+	compiler.scopeIndex--
+
+	compiler.symbolTable = compiler.symbolTable.Outer
+
+	return instructions, lines
+}
+
 func (compiler *Compiler) ByteCode() ByteCode {
 	return ByteCode{
-		Instructions: compiler.instructions,
+		Instructions: compiler.currentInstructions(),
 		Constants:    compiler.constants,
+		NumLocals:    compiler.symbolTable.NumLocals(),
+		Debug: &DebugInfo{
+			Lines:         compiler.scopes[compiler.scopeIndex].lines,
+			FunctionLines: compiler.functionLines,
+		},
 	}
 }
@@ -0,0 +1,103 @@
+package compiler
+
+import (
+	"atlas/diagnostic"
+	"atlas/parser"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func compileProgram(input string) (*Compiler, error) {
+	pars := parser.New(&input)
+	program := pars.Parse()
+
+	comp := New()
+	err := comp.Compile(&program)
+	return &comp, err
+}
+
+func TestScopeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var a = 1; var a = 2;", "`a` is already declared in this scope"},
+		{"if true { var a = 1; var a = 2; }", "`a` is already declared in this scope"},
+		{"fun f(a: int): int { var a = 1; return a; }", "`a` is already declared in this scope"},
+		{"fun f(a: int, a: int): int { return a; }", "`a` is already declared in this scope"},
+		{"if true { var a = 1; } a = 2;", "cannot assign new value to undeclared variable `a`"},
+		{"loop false { var a = 1; } var b = a;", "undefined symbol a"},
+		{"if true { fun f(): int { return 1; } }", "function `f` must be declared at top level"},
+	}
+
+	for _, tt := range tests {
+		_, err := compileProgram(tt.input)
+		if err == nil {
+			t.Fatalf("expected error for %q", tt.input)
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+// Errors carry a diagnostic, rendered like the ones of the parser and of the checker
+func TestErrorDiagnostics(t *testing.T) {
+	_, err := compileProgram("if true {\n\tfun f(): int { return 1; }\n}")
+	var compileError *Error
+	if !errors.As(err, &compileError) {
+		t.Fatalf("expected a compiler error. got=%v", err)
+	}
+	diag := compileError.Diagnostic
+	if diag.Code != NESTED_FUNCTION || diag.Span.Start != (diagnostic.Position{Row: 2, Col: 2}) {
+		t.Errorf("wrong diagnostic. got=%+v", diag)
+	}
+	if err.Error() != "function `f` must be declared at top level at line 2, column 2" {
+		t.Errorf("wrong message. got=%q", err.Error())
+	}
+}
+
+func TestFailedFunctionLeavesItsScope(t *testing.T) {
+	comp, err := compileProgram("fun f(a: uint): uint { fun g(): uint { return a; } return a; }")
+	if err == nil {
+		t.Fatalf("expected a compiler error")
+	}
+	if comp.scopeIndex != 0 || comp.symbolTable.Outer != nil {
+		t.Fatalf("compiler left in the scope of the function. scope=%d", comp.scopeIndex)
+	}
+
+	input := "var a = 1;"
+	program := parser.New(&input).Parse()
+	err = comp.Compile(&program)
+	if err != nil {
+		t.Fatalf("compilation failed: %s", err)
+	}
+	if !strings.Contains(comp.ByteCode().Instructions.String(), "GLOBAL_SET") {
+		t.Errorf("declaration not compiled to a global. got=\n%s", comp.ByteCode().Instructions)
+	}
+}
+
+func TestBlockLocals(t *testing.T) {
+	input := `
+	var a = 1;
+	if true {
+		var a = 2;
+		var b = a;
+	} else {
+		var c = 3;
+	}`
+
+	comp, err := compileProgram(input)
+	if err != nil {
+		t.Fatalf("compilation failed: %s", err)
+	}
+
+	byteCode := comp.ByteCode()
+	if byteCode.NumLocals != 2 {
+		t.Errorf("wrong number of main frame locals. expected=2, got=%d", byteCode.NumLocals)
+	}
+	if !strings.Contains(byteCode.Instructions.String(), "LOCAL_SET 1") {
+		t.Errorf("block declaration not compiled to local. got=\n%s", byteCode.Instructions)
+	}
+}
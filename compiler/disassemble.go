@@ -0,0 +1,131 @@
+package compiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Human readable listing of the constant pool and of the instructions of every function.
+// Jump targets get labels and, when debug information exists, instructions are grouped
+// under the source line they were compiled from.
+func (byteCode *ByteCode) Disassemble() string {
+	var out strings.Builder
+
+	if byteCode.Debug != nil && byteCode.Debug.File != "" {
+		fmt.Fprintf(&out, "Source: %s\n\n", byteCode.Debug.File)
+	}
+
+	fmt.Fprintf(&out, "Constants (%d):\n", len(byteCode.Constants))
+	for i, constant := range byteCode.Constants {
+		fmt.Fprintf(&out, "  %04d %-18s %s\n", i, constant.Type(), constant.Inspect())
+	}
+
+	var mainLines LineTable
+	if byteCode.Debug != nil {
+		mainLines = byteCode.Debug.Lines
+	}
+	fmt.Fprintf(&out, "\nmain (%d locals):\n", byteCode.NumLocals)
+	byteCode.disassembleInstructions(&out, byteCode.Instructions, mainLines)
+
+	for i, constant := range byteCode.Constants {
+		function, ok := constant.(*CompiledFunction)
+		if !ok {
+			continue
+		}
+
+		var lines LineTable
+		if byteCode.Debug != nil {
+			lines = byteCode.Debug.FunctionLines[i]
+		}
+		fmt.Fprintf(&out, "\n%s (constant %d, %d parameters, %d locals):\n", function.Name, i, function.NumParameters, function.NumLocals)
+		byteCode.disassembleInstructions(&out, function.Instructions, lines)
+	}
+
+	return out.String()
+}
+
+func (byteCode *ByteCode) disassembleInstructions(out *strings.Builder, instructions Instructions, lines LineTable) {
+	labels := jumpLabels(instructions)
+
+	var sourceLines []string
+	if byteCode.Debug != nil && byteCode.Debug.Source != "" {
+		sourceLines = strings.Split(byteCode.Debug.Source, "\n")
+	}
+
+	lastRow := 0
+	i := 0
+	for i < len(instructions) {
+		if label, ok := labels[i]; ok {
+			fmt.Fprintf(out, "  %s:\n", label)
+		}
+
+		if line, ok := lines.Lookup(i); ok && line.Row != lastRow {
+			lastRow = line.Row
+			if line.Row-1 < len(sourceLines) {
+				fmt.Fprintf(out, "  @ %d: %s\n", line.Row, strings.TrimSpace(sourceLines[line.Row-1]))
+			} else {
+				fmt.Fprintf(out, "  @ %d\n", line.Row)
+			}
+		}
+
+		definition, err := LookupOperation(instructions[i])
+		if err != nil {
+			fmt.Fprintf(out, "    %04d Error: %s\n", i, err)
+			i++
+			continue
+		}
+
+		operands, read := ReadInstructionOperands(definition, instructions[i+1:])
+		text := instructions.formatInstruction(definition, operands)
+		switch OpCode(instructions[i]) {
+		case JUMP, JNT:
+			text += " -> " + labels[operands[0]]
+		case CONST, RECV:
+			if operands[0] < len(byteCode.Constants) {
+				text += " (" + byteCode.Constants[operands[0]].Inspect() + ")"
+			}
+		case BUILTIN_GET:
+			if operands[0] < len(BUILTINS) {
+				text += " (" + BUILTINS[operands[0]].Name + ")"
+			}
+		}
+
+		fmt.Fprintf(out, "    %04d %s\n", i, text)
+		i += 1 + read
+	}
+
+	// Jumps can target the offset right after the last instruction
+	if label, ok := labels[len(instructions)]; ok {
+		fmt.Fprintf(out, "  %s:\n", label)
+	}
+}
+
+// Names the targets of jump instructions L1, L2... in the order of their offsets
+func jumpLabels(instructions Instructions) map[int]string {
+	targets := []int{}
+	seen := make(map[int]bool)
+
+	i := 0
+	for i < len(instructions) {
+		definition, err := LookupOperation(instructions[i])
+		if err != nil {
+			i++
+			continue
+		}
+		operands, read := ReadInstructionOperands(definition, instructions[i+1:])
+		op := OpCode(instructions[i])
+		if (op == JUMP || op == JNT) && !seen[operands[0]] {
+			seen[operands[0]] = true
+			targets = append(targets, operands[0])
+		}
+		i += 1 + read
+	}
+
+	sort.Ints(targets)
+	labels := make(map[int]string, len(targets))
+	for i, target := range targets {
+		labels[target] = fmt.Sprintf("L%d", i+1)
+	}
+	return labels
+}
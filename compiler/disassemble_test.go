@@ -0,0 +1,49 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	input := `var a = 1;
+if a > 0 {
+	a = 2;
+}
+fun f(n: int): int { return n; }`
+
+	comp, err := compileProgram(input)
+	if err != nil {
+		t.Fatalf("compilation failed: %s", err)
+	}
+	byteCode := comp.ByteCode()
+	byteCode.Debug.Source = input
+
+	listing := byteCode.Disassemble()
+
+	expected := []string{
+		"  0000 UNSIGNED_INTEGER   1\n",
+		"  0003 COMPILED_FUNCTION  fun f/1\n",
+		"main (0 locals):\n  @ 1: var a = 1;\n    0000 CONST 0 (1)\n    0003 GLOBAL_SET 0\n",
+		"    0013 JNT 22 -> L1\n",
+		"  L1:\n  @ 5: fun f(n: int): int { return n; }\n    0022 CONST 3 (fun f/1)\n",
+		"f (constant 3, 1 parameters, 1 locals):\n",
+	}
+	for _, part := range expected {
+		if !strings.Contains(listing, part) {
+			t.Errorf("listing does not contain %q. got=\n%s", part, listing)
+		}
+	}
+}
+
+func TestDisassembleWithoutDebugInfo(t *testing.T) {
+	byteCode := ByteCode{
+		Instructions: append(MakeInstruction(JUMP, 3), MakeInstruction(TRUE)...),
+	}
+
+	listing := byteCode.Disassemble()
+	expected := "main (0 locals):\n    0000 JUMP 3 -> L1\n  L1:\n    0003 TRUE\n"
+	if !strings.Contains(listing, expected) {
+		t.Errorf("wrong listing. expected to contain=\n%s\ngot=\n%s", expected, listing)
+	}
+}
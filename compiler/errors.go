@@ -0,0 +1,34 @@
+package compiler
+
+import (
+	"atlas/diagnostic"
+	"atlas/lexer"
+	"fmt"
+)
+
+// Codes of the diagnostics of the compilation errors. Most of them are caught by the checker
+// first, the compiler still reports them for the programs it did not check.
+const (
+	NESTED_FUNCTION   = "C001"
+	MISSING_BODY      = "C002"
+	REDECLARED_SYMBOL = "C003"
+	UNDEFINED_SYMBOL  = "C004"
+	INVALID_TARGET    = "C005"
+	LIMIT_EXCEEDED    = "C006"
+	UNSUPPORTED_NODE  = "C007"
+)
+
+// Error found while compiling a node, located in the source like the diagnostics of the parser
+// and of the checker
+type Error struct {
+	Diagnostic diagnostic.Diagnostic
+}
+
+func (err *Error) Error() string {
+	start := err.Diagnostic.Span.Start
+	return fmt.Sprintf("%s at line %d, column %d", err.Diagnostic.Message, start.Row, start.Col)
+}
+
+func errorAt(code string, token *lexer.Token, format string, args ...any) error {
+	return &Error{Diagnostic: diagnostic.NewError(code, token, format, args...)}
+}
@@ -0,0 +1,511 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"sort"
+)
+
+/*
+	Atlas bytecode file format (.atlb)
+
+	All integers are big endian, like instruction operands.
+
+	Header, 12 bytes:
+		magic        [4]byte  "ATLB"
+		version      uint16   FORMAT_VERSION of the writer
+		flags        uint16   FLAG_DEBUG when a debug section is present
+		body length  uint32   Length of the sections that follow
+
+	Body, a sequence of sections. Each section starts with:
+		id      uint8   SECTION_*
+		length  uint32  Length of the section payload
+
+	SECTION_CONSTANTS:
+		count uint32, then count objects
+	SECTION_CODE:
+		main frame locals uint32, instructions length uint32, instructions
+	SECTION_DEBUG (optional):
+		source file name string, source code string, main line table,
+		functions count uint32, then for each function its constant index uint32
+		and its line table
+
+	Line tables are an entries count uint32, then for each entry its instruction
+	offset, row and column as uint32.
+
+	Trailer:
+		CRC-32 (IEEE) uint32 of header and body
+
+	Strings are a uint32 length followed by UTF-8 bytes. Objects start with a tag byte:
+		TAG_INTEGER           int64
+		TAG_UNSIGNED_INTEGER  uint64
+		TAG_FLOAT             IEEE 754 bits of the value uint64
+		TAG_BOOLEAN           uint8 (0 or 1)
+		TAG_STRING            string
+		TAG_COMPILED_FUNCTION name string, locals uint32, parameters uint32,
+		                      instructions length uint32, instructions
+		TAG_NULL              nothing
+		TAG_BUILTIN           name string, the name of one of BUILTINS
+		TAG_ARRAY             elements count uint32, elements
+		TAG_MAP               pairs count uint32, then the key and value of each pair in the
+		                      order of the keys, see Map.SortedPairs
+
+	FORMAT_VERSION must be incremented whenever this layout, an object encoding or the
+	numbering of opcodes changes. Readers only accept their own version.
+*/
+
+var MAGIC = [4]byte{'A', 'T', 'L', 'B'}
+
+const FORMAT_VERSION uint16 = 10
+
+const (
+	FLAG_DEBUG uint16 = 1 << iota
+)
+
+const HEADER_SIZE = 12
+const CHECKSUM_SIZE = 4
+
+const (
+	SECTION_CONSTANTS byte = iota + 1
+	SECTION_CODE
+	SECTION_DEBUG
+)
+
+const (
+	TAG_INTEGER byte = iota + 1
+	TAG_UNSIGNED_INTEGER
+	TAG_BOOLEAN
+	TAG_COMPILED_FUNCTION
+	TAG_NULL
+	TAG_BUILTIN
+	TAG_STRING
+	TAG_ARRAY
+	TAG_MAP
+	TAG_FLOAT
+)
+
+var ErrBadMagic = errors.New("not an Atlas bytecode file (bad magic number)")
+var ErrTruncated = errors.New("bytecode file is truncated")
+var ErrChecksum = errors.New("bytecode file is corrupted (checksum mismatch)")
+
+// Bytecode written by another version of the format
+type VersionError struct {
+	Version uint16
+}
+
+func (err *VersionError) Error() string {
+	return fmt.Sprintf("bytecode format version %d is not supported, this build reads version %d only: recompile the source", err.Version, FORMAT_VERSION)
+}
+
+// Optional information about the source the bytecode was compiled from
+type DebugInfo struct {
+	File          string
+	Source        string
+	Lines         LineTable         // Positions of the main instructions
+	FunctionLines map[int]LineTable // Positions of function instructions by constant index
+}
+
+func (byteCode *ByteCode) MarshalBinary() ([]byte, error) {
+	var body encoder
+
+	var constants encoder
+	constants.uint32(uint32(len(byteCode.Constants)))
+	for _, constant := range byteCode.Constants {
+		err := constants.object(constant)
+		if err != nil {
+			return nil, err
+		}
+	}
+	body.section(SECTION_CONSTANTS, &constants)
+
+	var code encoder
+	code.uint32(uint32(byteCode.NumLocals))
+	code.bytes(byteCode.Instructions)
+	body.section(SECTION_CODE, &code)
+
+	var flags uint16
+	if byteCode.Debug != nil {
+		flags |= FLAG_DEBUG
+
+		var debug encoder
+		debug.string(byteCode.Debug.File)
+		debug.string(byteCode.Debug.Source)
+		debug.lineTable(byteCode.Debug.Lines)
+
+		indexes := make([]int, 0, len(byteCode.Debug.FunctionLines))
+		for index := range byteCode.Debug.FunctionLines {
+			indexes = append(indexes, index)
+		}
+		sort.Ints(indexes) // Keeps the output deterministic
+
+		debug.uint32(uint32(len(indexes)))
+		for _, index := range indexes {
+			debug.uint32(uint32(index))
+			debug.lineTable(byteCode.Debug.FunctionLines[index])
+		}
+		body.section(SECTION_DEBUG, &debug)
+	}
+
+	var file encoder
+	file.buffer.Write(MAGIC[:])
+	file.uint16(FORMAT_VERSION)
+	file.uint16(flags)
+	file.uint32(uint32(body.buffer.Len()))
+	file.buffer.Write(body.buffer.Bytes())
+	file.uint32(crc32.ChecksumIEEE(file.buffer.Bytes()))
+
+	return file.buffer.Bytes(), nil
+}
+
+func (byteCode *ByteCode) UnmarshalBinary(data []byte) error {
+	if len(data) < len(MAGIC) || !bytes.Equal(data[:len(MAGIC)], MAGIC[:]) {
+		return ErrBadMagic
+	}
+	if len(data) < HEADER_SIZE {
+		return ErrTruncated
+	}
+
+	header := decoder{data: data[len(MAGIC):HEADER_SIZE]}
+	version := header.uint16()
+	flags := header.uint16()
+	bodyLength := int(header.uint32())
+
+	if version != FORMAT_VERSION {
+		return &VersionError{Version: version}
+	}
+	if len(data) < HEADER_SIZE+bodyLength+CHECKSUM_SIZE {
+		return ErrTruncated
+	}
+
+	checked := data[:HEADER_SIZE+bodyLength]
+	checksum := binary.BigEndian.Uint32(data[HEADER_SIZE+bodyLength:])
+	if crc32.ChecksumIEEE(checked) != checksum {
+		return ErrChecksum
+	}
+
+	decoded := ByteCode{}
+	body := decoder{data: data[HEADER_SIZE : HEADER_SIZE+bodyLength]}
+	for !body.done() && body.err == nil {
+		id := body.byte()
+		section := decoder{data: body.bytes()}
+
+		switch id {
+		case SECTION_CONSTANTS:
+			count := int(section.uint32())
+			for i := 0; i < count && section.err == nil; i++ {
+				decoded.Constants = append(decoded.Constants, section.object())
+			}
+		case SECTION_CODE:
+			decoded.NumLocals = int(section.uint32())
+			decoded.Instructions = section.bytes()
+		case SECTION_DEBUG:
+			decoded.Debug = &DebugInfo{
+				File:          section.string(),
+				Source:        section.string(),
+				Lines:         section.lineTable(),
+				FunctionLines: make(map[int]LineTable),
+			}
+			count := int(section.uint32())
+			for i := 0; i < count && section.err == nil; i++ {
+				index := int(section.uint32())
+				decoded.Debug.FunctionLines[index] = section.lineTable()
+			}
+		}
+
+		if section.err != nil {
+			return section.err
+		}
+	}
+	if body.err != nil {
+		return body.err
+	}
+	if flags&FLAG_DEBUG != 0 && decoded.Debug == nil {
+		return fmt.Errorf("bytecode file is corrupted: missing debug section")
+	}
+
+	*byteCode = decoded
+	return nil
+}
+
+type encoder struct {
+	buffer bytes.Buffer
+}
+
+func (enc *encoder) byte(value byte) {
+	enc.buffer.WriteByte(value)
+}
+
+func (enc *encoder) uint16(value uint16) {
+	enc.buffer.Write(binary.BigEndian.AppendUint16(nil, value))
+}
+
+func (enc *encoder) uint32(value uint32) {
+	enc.buffer.Write(binary.BigEndian.AppendUint32(nil, value))
+}
+
+func (enc *encoder) uint64(value uint64) {
+	enc.buffer.Write(binary.BigEndian.AppendUint64(nil, value))
+}
+
+func (enc *encoder) bytes(value []byte) {
+	enc.uint32(uint32(len(value)))
+	enc.buffer.Write(value)
+}
+
+func (enc *encoder) string(value string) {
+	enc.bytes([]byte(value))
+}
+
+func (enc *encoder) lineTable(table LineTable) {
+	enc.uint32(uint32(len(table)))
+	for _, line := range table {
+		enc.uint32(uint32(line.Offset))
+		enc.uint32(uint32(line.Row))
+		enc.uint32(uint32(line.Col))
+	}
+}
+
+func (enc *encoder) section(id byte, payload *encoder) {
+	enc.byte(id)
+	enc.bytes(payload.buffer.Bytes())
+}
+
+func (enc *encoder) object(object Object) error {
+	switch obj := object.(type) {
+	case *Integer:
+		enc.byte(TAG_INTEGER)
+		enc.uint64(uint64(obj.Value))
+	case *UnsignedInteger:
+		enc.byte(TAG_UNSIGNED_INTEGER)
+		enc.uint64(obj.Value)
+	case *Float:
+		enc.byte(TAG_FLOAT)
+		enc.uint64(math.Float64bits(obj.Value))
+	case *Boolean:
+		enc.byte(TAG_BOOLEAN)
+		if obj.Value {
+			enc.byte(1)
+		} else {
+			enc.byte(0)
+		}
+	case *String:
+		enc.byte(TAG_STRING)
+		enc.string(obj.Value)
+	case *CompiledFunction:
+		enc.byte(TAG_COMPILED_FUNCTION)
+		enc.string(obj.Name)
+		enc.uint32(uint32(obj.NumLocals))
+		enc.uint32(uint32(obj.NumParameters))
+		enc.bytes(obj.Instructions)
+	case *NullValue:
+		enc.byte(TAG_NULL)
+	case *Builtin:
+		enc.byte(TAG_BUILTIN)
+		enc.string(obj.Name)
+	case *Array:
+		enc.byte(TAG_ARRAY)
+		enc.uint32(uint32(len(obj.Elements)))
+		for _, element := range obj.Elements {
+			err := enc.object(element)
+			if err != nil {
+				return err
+			}
+		}
+	case *Map:
+		enc.byte(TAG_MAP)
+		enc.uint32(uint32(len(obj.Pairs)))
+		for _, pair := range obj.SortedPairs() {
+			err := enc.object(pair.Key)
+			if err != nil {
+				return err
+			}
+			err = enc.object(pair.Value)
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cannot encode object of type `%s`", object.Type())
+	}
+	return nil
+}
+
+// Appends the encoding of object used in the constants section, so that other formats can
+// carry objects too. Objects only existing while a program runs, like futures, cannot be encoded.
+func AppendObject(data []byte, object Object) ([]byte, error) {
+	var enc encoder
+	err := enc.object(object)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, enc.buffer.Bytes()...), nil
+}
+
+// Decodes the object encoded by AppendObject at the start of data, returning the number of bytes read
+func ReadObject(data []byte) (Object, int, error) {
+	dec := decoder{data: data}
+	object := dec.object()
+	if dec.err != nil {
+		return nil, 0, dec.err
+	}
+	return object, dec.offset, nil
+}
+
+// Reads values in the order they were encoded. The first failure is kept in err and
+// following reads return zero values.
+type decoder struct {
+	data   []byte
+	offset int
+	err    error
+}
+
+func (dec *decoder) done() bool {
+	return dec.offset >= len(dec.data)
+}
+
+func (dec *decoder) read(length int) []byte {
+	if dec.err != nil {
+		return nil
+	}
+	if length < 0 || dec.offset+length > len(dec.data) {
+		dec.err = ErrTruncated
+		return nil
+	}
+	value := dec.data[dec.offset : dec.offset+length]
+	dec.offset += length
+	return value
+}
+
+func (dec *decoder) byte() byte {
+	value := dec.read(1)
+	if value == nil {
+		return 0
+	}
+	return value[0]
+}
+
+func (dec *decoder) uint16() uint16 {
+	value := dec.read(2)
+	if value == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(value)
+}
+
+func (dec *decoder) uint32() uint32 {
+	value := dec.read(4)
+	if value == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(value)
+}
+
+func (dec *decoder) uint64() uint64 {
+	value := dec.read(8)
+	if value == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(value)
+}
+
+func (dec *decoder) bytes() []byte {
+	length := dec.uint32()
+	value := dec.read(int(length))
+	if value == nil {
+		return nil
+	}
+	// Copied so that decoded values do not keep the whole input alive
+	return append([]byte{}, value...)
+}
+
+func (dec *decoder) string() string {
+	return string(dec.bytes())
+}
+
+func (dec *decoder) lineTable() LineTable {
+	count := int(dec.uint32())
+	var table LineTable
+	for i := 0; i < count && dec.err == nil; i++ {
+		table = append(table, LineInfo{
+			Offset: int(dec.uint32()),
+			Row:    int(dec.uint32()),
+			Col:    int(dec.uint32()),
+		})
+	}
+	return table
+}
+
+func (dec *decoder) object() Object {
+	tag := dec.byte()
+	if dec.err != nil {
+		return nil
+	}
+
+	switch tag {
+	case TAG_INTEGER:
+		return &Integer{Value: int64(dec.uint64())}
+	case TAG_UNSIGNED_INTEGER:
+		return &UnsignedInteger{Value: dec.uint64()}
+	case TAG_FLOAT:
+		return &Float{Value: math.Float64frombits(dec.uint64())}
+	case TAG_BOOLEAN:
+		return ParseBooleanFromNative(dec.byte() != 0)
+	case TAG_STRING:
+		return &String{Value: dec.string()}
+	case TAG_COMPILED_FUNCTION:
+		return &CompiledFunction{
+			Name:          dec.string(),
+			NumLocals:     int(dec.uint32()),
+			NumParameters: int(dec.uint32()),
+			Instructions:  dec.bytes(),
+		}
+	case TAG_NULL:
+		return Null
+	case TAG_BUILTIN:
+		name := dec.string()
+		index, ok := LookupBuiltin(name)
+		if dec.err == nil && !ok {
+			dec.err = fmt.Errorf("bytecode refers to unknown built-in function `%s`", name)
+		}
+		if dec.err != nil {
+			return nil
+		}
+		return BUILTINS[index]
+	case TAG_ARRAY:
+		count := int(dec.uint32())
+		array := &Array{Elements: []Object{}}
+		for i := 0; i < count && dec.err == nil; i++ {
+			array.Elements = append(array.Elements, dec.object())
+		}
+		if dec.err != nil {
+			return nil
+		}
+		return array
+	case TAG_MAP:
+		count := int(dec.uint32())
+		hashMap := NewMap()
+		for i := 0; i < count && dec.err == nil; i++ {
+			key, value := dec.object(), dec.object()
+			if dec.err != nil {
+				break
+			}
+			hashable, ok := key.(Hashable)
+			if !ok {
+				dec.err = fmt.Errorf("bytecode file is corrupted: map key of type `%s`", key.Type())
+				break
+			}
+			hashMap.Pairs[hashable.HashKey()] = MapPair{Key: key, Value: value}
+		}
+		if dec.err != nil {
+			return nil
+		}
+		return hashMap
+	}
+
+	dec.err = fmt.Errorf("bytecode file is corrupted: unknown object tag %d", tag)
+	return nil
+}
@@ -0,0 +1,189 @@
+package compiler
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestByteCodeRoundTrip(t *testing.T) {
+	comp, err := compileProgram(`
+	fun add(a: int, b: int): int { return a + b; }
+	var x = add(1, 2);
+	var y = -5;
+	var f = 2.5e-3;
+	println(y, "label\n");
+	if true { var z = false; }`)
+	if err != nil {
+		t.Fatalf("compilation failed: %s", err)
+	}
+	byteCode := comp.ByteCode()
+	byteCode.Debug.File = "test.atl"
+	byteCode.Debug.Source = "var x = 1;"
+
+	data, err := byteCode.MarshalBinary()
+	if err != nil {
+		t.Fatalf("could not encode bytecode: %s", err)
+	}
+
+	var decoded ByteCode
+	err = decoded.UnmarshalBinary(data)
+	if err != nil {
+		t.Fatalf("could not decode bytecode: %s", err)
+	}
+
+	if !reflect.DeepEqual(byteCode, decoded) {
+		t.Errorf("decoded bytecode differs.\nexpected=%+v\ngot=%+v", byteCode, decoded)
+	}
+}
+
+func TestByteCodeLoadErrors(t *testing.T) {
+	byteCode := ByteCode{Instructions: MakeInstruction(TRUE), Constants: []Object{&UnsignedInteger{Value: 1}}}
+	data, err := byteCode.MarshalBinary()
+	if err != nil {
+		t.Fatalf("could not encode bytecode: %s", err)
+	}
+
+	corrupted := append([]byte{}, data...)
+	corrupted[HEADER_SIZE+3] ^= 0xff
+
+	wrongVersion := append([]byte{}, data...)
+	wrongVersion[5] = byte(FORMAT_VERSION + 1)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected error
+	}{
+		{"empty", []byte{}, ErrBadMagic},
+		{"bad magic", []byte("ATLX\x00\x01"), ErrBadMagic},
+		{"header only", data[:HEADER_SIZE-2], ErrTruncated},
+		{"truncated", data[:len(data)-1], ErrTruncated},
+		{"corrupted", corrupted, ErrChecksum},
+	}
+
+	for _, tt := range tests {
+		var decoded ByteCode
+		err := decoded.UnmarshalBinary(tt.data)
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%s: expected error %q, got %v", tt.name, tt.expected, err)
+		}
+	}
+
+	var decoded ByteCode
+	err = decoded.UnmarshalBinary(wrongVersion)
+	var versionError *VersionError
+	if !errors.As(err, &versionError) || versionError.Version != FORMAT_VERSION+1 {
+		t.Errorf("wrong version: expected *VersionError, got %v", err)
+	}
+}
+
+func TestEncodeNullAndBuiltins(t *testing.T) {
+	for _, object := range []Object{Null, BUILTINS[2]} {
+		data, err := AppendObject(nil, object)
+		if err != nil {
+			t.Fatalf("could not encode %s: %s", object.Inspect(), err)
+		}
+		decoded, read, err := ReadObject(data)
+		if err != nil || read != len(data) || decoded != object {
+			t.Errorf("wrong decoding of %s. got=%v (%v)", object.Inspect(), decoded, err)
+		}
+	}
+
+	data, _ := AppendObject(nil, &Builtin{Name: "missing"})
+	_, _, err := ReadObject(data)
+	if err == nil || err.Error() != "bytecode refers to unknown built-in function `missing`" {
+		t.Errorf("expected the unknown built-in function. got=%v", err)
+	}
+}
+
+func TestEncodeFloats(t *testing.T) {
+	for _, float := range []*Float{{Value: 3.5}, {Value: -1e300}, {Value: 0.1}, {Value: 2}} {
+		data, err := AppendObject(nil, float)
+		if err != nil {
+			t.Fatalf("could not encode %s: %s", float.Inspect(), err)
+		}
+		decoded, read, err := ReadObject(data)
+		if err != nil || read != len(data) || !reflect.DeepEqual(decoded, float) {
+			t.Errorf("wrong decoding of %s. got=%v (%v)", float.Inspect(), decoded, err)
+		}
+	}
+
+	// Whole floats are shown with a fractional part, unlike integers
+	tests := map[float64]string{2: "2.0", -0.5: "-0.5", 1e21: "1e+21", 1e-7: "1e-07"}
+	for value, expected := range tests {
+		if inspected := (&Float{Value: value}).Inspect(); inspected != expected {
+			t.Errorf("wrong inspection of %g. expected=%q, got=%q", value, expected, inspected)
+		}
+	}
+}
+
+func TestEncodeArrays(t *testing.T) {
+	array := &Array{Elements: []Object{&Integer{Value: -1}, &Array{Elements: []Object{&String{Value: "a"}}}, &Array{}}}
+	data, err := AppendObject(nil, array)
+	if err != nil {
+		t.Fatalf("could not encode %s: %s", array.Inspect(), err)
+	}
+	decoded, read, err := ReadObject(data)
+	if err != nil || read != len(data) || decoded.Inspect() != `[-1, ["a"], []]` {
+		t.Errorf("wrong decoding of %s. got=%v (%v)", array.Inspect(), decoded, err)
+	}
+
+	_, err = AppendObject(nil, &Array{Elements: []Object{NewChannel(0)}})
+	if err == nil || err.Error() != "cannot encode object of type `CHANNEL`" {
+		t.Errorf("expected the channel to be refused. got=%v", err)
+	}
+}
+
+func TestEncodeMaps(t *testing.T) {
+	hashMap := NewMap()
+	for _, pair := range []MapPair{
+		{Key: &String{Value: "b"}, Value: &Array{Elements: []Object{&Integer{Value: -1}}}},
+		{Key: &String{Value: "a"}, Value: NewMap()},
+	} {
+		hashMap.Pairs[pair.Key.(Hashable).HashKey()] = pair
+	}
+	data, err := AppendObject(nil, hashMap)
+	if err != nil {
+		t.Fatalf("could not encode %s: %s", hashMap.Inspect(), err)
+	}
+	decoded, read, err := ReadObject(data)
+	if err != nil || read != len(data) || decoded.Inspect() != `{"a": {}, "b": [-1]}` {
+		t.Errorf("wrong decoding of %s. got=%v (%v)", hashMap.Inspect(), decoded, err)
+	}
+	// Keys are decoded into the same hash keys
+	if _, ok := decoded.(*Map).Pairs[(&String{Value: "a"}).HashKey()]; !ok {
+		t.Errorf("key not found in the decoded map %s", decoded.Inspect())
+	}
+
+	// Maps can be constants of bytecode
+	byteCode := ByteCode{Instructions: MakeInstruction(TRUE), Constants: []Object{hashMap}}
+	encoded, err := byteCode.MarshalBinary()
+	if err != nil {
+		t.Fatalf("could not encode bytecode: %s", err)
+	}
+	var loaded ByteCode
+	err = loaded.UnmarshalBinary(encoded)
+	if err != nil || !reflect.DeepEqual(byteCode.Constants, loaded.Constants) {
+		t.Errorf("wrong constants of the decoded bytecode. got=%v (%v)", loaded.Constants, err)
+	}
+
+	// Pairs are written in the order of their keys, so that equal maps give the same bytes
+	other := NewMap()
+	for _, pair := range hashMap.SortedPairs() {
+		other.Pairs[pair.Key.(Hashable).HashKey()] = pair
+	}
+	otherData, _ := AppendObject(nil, other)
+	if !bytes.Equal(data, otherData) {
+		t.Errorf("equal maps encoded differently")
+	}
+
+	corrupted := []byte{TAG_MAP, 0, 0, 0, 1}
+	corrupted, _ = AppendObject(corrupted, &Array{})
+	corrupted, _ = AppendObject(corrupted, &Integer{Value: 1})
+	_, _, err = ReadObject(corrupted)
+	if err == nil || err.Error() != "bytecode file is corrupted: map key of type `ARRAY`" {
+		t.Errorf("expected the array key to be refused. got=%v", err)
+	}
+}
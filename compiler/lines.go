@@ -0,0 +1,38 @@
+package compiler
+
+import "sort"
+
+// Source position of the instructions starting at Offset, up to the next entry
+type LineInfo struct {
+	Offset int
+	Row    int
+	Col    int
+}
+
+// Maps instruction offsets of a function to source positions. Entries are sorted by offset.
+type LineTable []LineInfo
+
+func (table *LineTable) add(offset int, row int, col int) {
+	if len(*table) > 0 {
+		last := (*table)[len(*table)-1]
+		if last.Row == row && last.Col == col {
+			return
+		}
+		if last.Offset == offset {
+			(*table)[len(*table)-1] = LineInfo{Offset: offset, Row: row, Col: col}
+			return
+		}
+	}
+	*table = append(*table, LineInfo{Offset: offset, Row: row, Col: col})
+}
+
+// Finds the source position of the instruction at offset
+func (table LineTable) Lookup(offset int) (LineInfo, bool) {
+	index := sort.Search(len(table), func(i int) bool {
+		return table[i].Offset > offset
+	})
+	if index == 0 {
+		return LineInfo{}, false
+	}
+	return table[index-1], true
+}
@@ -2,13 +2,24 @@ package compiler
 
 import (
 	"encoding/gob"
+	"errors"
 	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 func RegisterObjectsToGob() {
 	gob.Register(&UnsignedInteger{})
 	gob.Register(&Integer{})
+	gob.Register(&Float{})
 	gob.Register(&Boolean{})
+	gob.Register(&String{})
+	gob.Register(&Array{})
+	gob.Register(&Map{})
+	gob.Register(&CompiledFunction{})
 }
 
 type ObjectType string
@@ -16,7 +27,17 @@ type ObjectType string
 const (
 	INTEGER 			= "INTEGER"
 	UNSIGNED_INTEGER 	= "UNSIGNED_INTEGER"
+	FLOAT				= "FLOAT"
 	BOOLEAN				= "BOOLEAN"
+	STRING				= "STRING"
+	ARRAY_OBJECT		= "ARRAY" // ARRAY is the opcode building arrays
+	MAP_OBJECT			= "MAP" // Same for MAP
+	COMPILED_FUNCTION	= "COMPILED_FUNCTION"
+	NATIVE_FUNCTION		= "NATIVE_FUNCTION"
+	BUILTIN				= "BUILTIN"
+	NULL				= "NULL"
+	FUTURE				= "FUTURE"
+	CHANNEL				= "CHANNEL"
 )
 
 type Object interface {
@@ -24,10 +45,37 @@ type Object interface {
 	Inspect() string
 }
 
+// Key identifying an object in maps: objects with the same key are the same map key
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+	Text  string // Value of strings, kept whole so that keys cannot collide
+}
+
+// Objects that can be map keys: integers, booleans and strings
+type Hashable interface {
+	Object
+	HashKey() HashKey
+}
+
 func IsObjectNumber(object Object) bool {
 	return object.Type() == UNSIGNED_INTEGER || object.Type() == INTEGER
 }
 
+// Value of an integer or float object as a float, for the operations mixing them. Integers
+// become the nearest float.
+func FloatValue(object Object) (float64, bool) {
+	switch number := object.(type) {
+	case *Float:
+		return number.Value, true
+	case *Integer:
+		return float64(number.Value), true
+	case *UnsignedInteger:
+		return float64(number.Value), true
+	}
+	return 0, false
+}
+
 // Integers object
 
 type Integer struct {
@@ -42,6 +90,14 @@ func (integer *Integer) Inspect() string {
 	return fmt.Sprint(integer.Value)
 }
 
+// Integers of the same value are the same key whatever their signedness, like for `==`
+func (integer *Integer) HashKey() HashKey {
+	if integer.Value >= 0 {
+		return HashKey{Type: UNSIGNED_INTEGER, Value: uint64(integer.Value)}
+	}
+	return HashKey{Type: INTEGER, Value: uint64(integer.Value)}
+}
+
 // Unsigned integer object
 
 type UnsignedInteger struct {
@@ -56,6 +112,29 @@ func (uinteger *UnsignedInteger) Inspect() string {
 	return fmt.Sprint(uinteger.Value)
 }
 
+func (uinteger *UnsignedInteger) HashKey() HashKey {
+	return HashKey{Type: UNSIGNED_INTEGER, Value: uinteger.Value}
+}
+
+// Float object, a 64-bit IEEE 754 floating-point number
+
+type Float struct {
+	Value float64
+}
+
+func (float *Float) Type() ObjectType {
+	return FLOAT
+}
+
+// Whole floats keep a fractional part, so that they cannot be mistaken for integers
+func (float *Float) Inspect() string {
+	text := strconv.FormatFloat(float.Value, 'g', -1, 64)
+	if strings.ContainsAny(text, ".eIN") {
+		return text
+	}
+	return text + ".0"
+}
+
 // Boolean object
 
 var True = &Boolean{Value: true}
@@ -73,9 +152,485 @@ func (boolean *Boolean) Inspect() string {
 	return fmt.Sprint(boolean.Value)
 }
 
+func (boolean *Boolean) HashKey() HashKey {
+	if boolean.Value {
+		return HashKey{Type: BOOLEAN, Value: 1}
+	}
+	return HashKey{Type: BOOLEAN, Value: 0}
+}
+
 func ParseBooleanFromNative(nativeBool bool) *Boolean {
 	if nativeBool {
 		return True
 	}
 	return False
-}
\ No newline at end of file
+}
+
+// String object, an immutable sequence of bytes holding UTF-8 text
+
+type String struct {
+	Value string
+}
+
+func (str *String) Type() ObjectType {
+	return STRING
+}
+
+// Strings are shown as they are, without quotes, so that programs can print text
+func (str *String) Inspect() string {
+	return str.Value
+}
+
+func (str *String) HashKey() HashKey {
+	return HashKey{Type: STRING, Text: str.Value}
+}
+
+// Array object, a fixed number of mutable elements shared by every value referring to it
+
+type Array struct {
+	Elements []Object
+}
+
+func (array *Array) Type() ObjectType {
+	return ARRAY_OBJECT
+}
+
+func (array *Array) Inspect() string {
+	elements := make([]string, len(array.Elements))
+	for i, element := range array.Elements {
+		elements[i] = inspectElement(element)
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// Strings inside arrays and maps are quoted, so that their elements can be told apart
+func inspectElement(element Object) string {
+	if str, ok := element.(*String); ok {
+		return strconv.Quote(str.Value)
+	}
+	return element.Inspect()
+}
+
+// Map object, associating values to hashable keys. Like arrays, maps are mutable and shared
+// by every value referring to them.
+
+type MapPair struct {
+	Key   Object
+	Value Object
+}
+
+type Map struct {
+	Pairs map[HashKey]MapPair
+}
+
+func NewMap() *Map {
+	return &Map{Pairs: make(map[HashKey]MapPair)}
+}
+
+func (hashMap *Map) Type() ObjectType {
+	return MAP_OBJECT
+}
+
+// Pairs are shown in the order of their keys
+func (hashMap *Map) Inspect() string {
+	pairs := []string{}
+	for _, pair := range hashMap.SortedPairs() {
+		pairs = append(pairs, inspectElement(pair.Key)+": "+inspectElement(pair.Value))
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// Pairs ordered by key, so that iterating over a map does not depend on how it is stored
+func (hashMap *Map) SortedPairs() []MapPair {
+	pairs := make([]MapPair, 0, len(hashMap.Pairs))
+	for _, pair := range hashMap.Pairs {
+		pairs = append(pairs, pair)
+	}
+	slices.SortFunc(pairs, func(left MapPair, right MapPair) int {
+		return compareKeys(left.Key.(Hashable).HashKey(), right.Key.(Hashable).HashKey())
+	})
+	return pairs
+}
+
+// Orders keys by type, then integers by value, false before true and strings byte-wise
+func compareKeys(left HashKey, right HashKey) int {
+	leftNegative, rightNegative := left.Type == INTEGER, right.Type == INTEGER
+	switch {
+	case leftNegative && rightNegative:
+		return compareOrdered(int64(left.Value), int64(right.Value))
+	case leftNegative != rightNegative && (left.Type == UNSIGNED_INTEGER || right.Type == UNSIGNED_INTEGER):
+		if leftNegative {
+			return -1
+		}
+		return 1
+	case left.Type != right.Type:
+		return strings.Compare(string(left.Type), string(right.Type))
+	case left.Type == STRING:
+		return strings.Compare(left.Text, right.Text)
+	}
+	return compareOrdered(left.Value, right.Value)
+}
+
+// Copies the arrays and maps of object, and the ones they hold, for a task that must not share
+// them. Other objects cannot change and are returned as they are.
+func DeepCopy(object Object) Object {
+	switch object := object.(type) {
+	case *Array:
+		elements := make([]Object, len(object.Elements))
+		for i, element := range object.Elements {
+			elements[i] = DeepCopy(element)
+		}
+		return &Array{Elements: elements}
+	case *Map:
+		copied := NewMap()
+		for hashKey, pair := range object.Pairs {
+			copied.Pairs[hashKey] = MapPair{Key: pair.Key, Value: DeepCopy(pair.Value)}
+		}
+		return copied
+	}
+	return object
+}
+
+// Compiled function object
+
+type CompiledFunction struct {
+	Name          string
+	Instructions  Instructions
+	NumLocals     int // Parameters included
+	NumParameters int
+}
+
+func (fn *CompiledFunction) Type() ObjectType {
+	return COMPILED_FUNCTION
+}
+
+func (fn *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("fun %s/%d", fn.Name, fn.NumParameters)
+}
+
+// Native function object, provided by the host embedding the language. It cannot be
+// serialized, programs calling it run on the node of the host.
+
+type NativeFunction struct {
+	Name     string
+	Function func(args []Object) (Object, error)
+}
+
+func (fn *NativeFunction) Type() ObjectType {
+	return NATIVE_FUNCTION
+}
+
+func (fn *NativeFunction) Inspect() string {
+	return fmt.Sprintf("native fun %s", fn.Name)
+}
+
+// Built-in function object, see BUILTINS. Functions write what they print to output.
+
+type Builtin struct {
+	Name     string
+	Function func(output io.Writer, args []Object) (Object, error)
+}
+
+func (fn *Builtin) Type() ObjectType {
+	return BUILTIN
+}
+
+func (fn *Builtin) Inspect() string {
+	return fmt.Sprintf("builtin fun %s", fn.Name)
+}
+
+// Null object, value of the calls of functions returning nothing
+
+var Null = &NullValue{}
+
+type NullValue struct{}
+
+func (null *NullValue) Type() ObjectType {
+	return NULL
+}
+
+func (null *NullValue) Inspect() string {
+	return "null"
+}
+
+// Future object, result of a spawned call. It is resolved once, when the call ends.
+
+type Future struct {
+	Function string // Name of the spawned function
+	done     chan struct{}
+	value    Object
+	err      error
+}
+
+func NewFuture(function string) *Future {
+	return &Future{Function: function, done: make(chan struct{})}
+}
+
+func (future *Future) Type() ObjectType {
+	return FUTURE
+}
+
+func (future *Future) Inspect() string {
+	return fmt.Sprintf("future of %s", future.Function)
+}
+
+// Sets the outcome of the call and wakes up its waiters. Must be called exactly once.
+func (future *Future) Resolve(value Object, err error) {
+	future.value = value
+	future.err = err
+	close(future.done)
+}
+
+// Closed once the future is resolved
+func (future *Future) Done() <-chan struct{} {
+	return future.done
+}
+
+// Blocks until the future is resolved
+func (future *Future) Wait() (Object, error) {
+	<-future.done
+	return future.value, future.err
+}
+
+// Channel object, passing values between tasks. Up to capacity values wait in the channel for
+// a receiver, a channel without capacity hands each value from a sender to a receiver directly.
+// Operations that cannot complete right away wait in the channel until another task takes part.
+
+var ErrSendOnClosed = errors.New("send on closed channel")
+var ErrCloseOfClosed = errors.New("close of closed channel")
+
+type Channel struct {
+	mutex     sync.Mutex
+	capacity  int
+	buffer    []Object
+	senders   []*ChannelOp // Waiting for room, with the value they send
+	receivers []*ChannelOp // Waiting for a value
+	closed    bool
+
+	proxy ChannelProxy // Set when the channel lives on another node
+}
+
+// Operations of a channel living on another node
+type ChannelProxy interface {
+	Send(value Object) *ChannelOp
+	Recv() *ChannelOp
+	Close() *ChannelOp
+}
+
+func NewChannel(capacity int) *Channel {
+	return &Channel{capacity: capacity}
+}
+
+// Creates the local handle of a channel living on another node
+func NewProxyChannel(proxy ChannelProxy) *Channel {
+	return &Channel{proxy: proxy}
+}
+
+func (channel *Channel) Type() ObjectType {
+	return CHANNEL
+}
+
+// Tells if the channel lives on another node, its operations completing with messages from there
+func (channel *Channel) IsProxy() bool {
+	return channel.proxy != nil
+}
+
+func (channel *Channel) Inspect() string {
+	return "channel"
+}
+
+// Number of values waiting in the buffer of a local channel
+func (channel *Channel) Len() int {
+	channel.mutex.Lock()
+	defer channel.mutex.Unlock()
+	return len(channel.buffer)
+}
+
+func (channel *Channel) Send(value Object) *ChannelOp {
+	if channel.proxy != nil {
+		return channel.proxy.Send(value)
+	}
+	channel.mutex.Lock()
+	defer channel.mutex.Unlock()
+
+	op := NewChannelOp()
+	switch {
+	case channel.closed:
+		op.Complete(nil, false, ErrSendOnClosed)
+	case len(channel.receivers) > 0:
+		receiver := channel.receivers[0]
+		channel.receivers = channel.receivers[1:]
+		receiver.Complete(value, true, nil)
+		op.Complete(nil, false, nil)
+	case len(channel.buffer) < channel.capacity:
+		channel.buffer = append(channel.buffer, value)
+		op.Complete(nil, false, nil)
+	default:
+		op.value = value
+		channel.senders = append(channel.senders, op)
+	}
+	return op
+}
+
+// Receives a value. Once the channel is closed and empty, receptions complete without a value.
+func (channel *Channel) Recv() *ChannelOp {
+	if channel.proxy != nil {
+		return channel.proxy.Recv()
+	}
+	channel.mutex.Lock()
+	defer channel.mutex.Unlock()
+
+	op := NewChannelOp()
+	switch {
+	case len(channel.buffer) > 0:
+		value := channel.buffer[0]
+		channel.buffer = channel.buffer[1:]
+		// The first waiting sender takes the room left
+		if len(channel.senders) > 0 {
+			sender := channel.senders[0]
+			channel.senders = channel.senders[1:]
+			channel.buffer = append(channel.buffer, sender.value)
+			sender.Complete(nil, false, nil)
+		}
+		op.Complete(value, true, nil)
+	case len(channel.senders) > 0:
+		sender := channel.senders[0]
+		channel.senders = channel.senders[1:]
+		value := sender.value
+		sender.Complete(nil, false, nil)
+		op.Complete(value, true, nil)
+	case channel.closed:
+		op.Complete(nil, false, nil)
+	default:
+		channel.receivers = append(channel.receivers, op)
+	}
+	return op
+}
+
+// Closes the channel. Waiting receivers complete without a value and waiting senders fail.
+func (channel *Channel) Close() *ChannelOp {
+	if channel.proxy != nil {
+		return channel.proxy.Close()
+	}
+	channel.mutex.Lock()
+	defer channel.mutex.Unlock()
+
+	op := NewChannelOp()
+	if channel.closed {
+		op.Complete(nil, false, ErrCloseOfClosed)
+		return op
+	}
+
+	channel.closed = true
+	for _, receiver := range channel.receivers {
+		receiver.Complete(nil, false, nil)
+	}
+	for _, sender := range channel.senders {
+		sender.Complete(nil, false, ErrSendOnClosed)
+	}
+	channel.receivers = nil
+	channel.senders = nil
+	op.Complete(nil, false, nil)
+	return op
+}
+
+// Contents of a local channel, as saved in snapshots. Sent holds the values of the waiting senders.
+type ChannelState struct {
+	Capacity  int
+	Buffer    []Object
+	Senders   []*ChannelOp
+	Sent      []Object
+	Receivers []*ChannelOp
+	Closed    bool
+}
+
+// Copy of the contents of a local channel
+func (channel *Channel) State() ChannelState {
+	channel.mutex.Lock()
+	defer channel.mutex.Unlock()
+
+	state := ChannelState{
+		Capacity:  channel.capacity,
+		Buffer:    append([]Object{}, channel.buffer...),
+		Senders:   append([]*ChannelOp{}, channel.senders...),
+		Receivers: append([]*ChannelOp{}, channel.receivers...),
+		Closed:    channel.closed,
+	}
+	for _, sender := range channel.senders {
+		state.Sent = append(state.Sent, sender.value)
+	}
+	return state
+}
+
+// Replaces the contents of a local channel, the operations of state waiting in it again
+func (channel *Channel) Restore(state ChannelState) {
+	channel.mutex.Lock()
+	defer channel.mutex.Unlock()
+
+	channel.capacity = state.Capacity
+	channel.buffer = append([]Object{}, state.Buffer...)
+	channel.senders = append([]*ChannelOp{}, state.Senders...)
+	channel.receivers = append([]*ChannelOp{}, state.Receivers...)
+	channel.closed = state.Closed
+	for i, sender := range channel.senders {
+		sender.value = state.Sent[i]
+	}
+}
+
+// Gives up an operation still waiting in the channel, which completes with err. Returns false
+// when the operation was already complete.
+func (channel *Channel) Cancel(op *ChannelOp, err error) bool {
+	if channel.proxy != nil {
+		return false
+	}
+	channel.mutex.Lock()
+	defer channel.mutex.Unlock()
+
+	for i, waiting := range channel.receivers {
+		if waiting == op {
+			channel.receivers = append(channel.receivers[:i], channel.receivers[i+1:]...)
+			op.Complete(nil, false, err)
+			return true
+		}
+	}
+	for i, waiting := range channel.senders {
+		if waiting == op {
+			channel.senders = append(channel.senders[:i], channel.senders[i+1:]...)
+			op.Complete(nil, false, err)
+			return true
+		}
+	}
+	return false
+}
+
+// Operation on a channel, completed right away or once another task takes part in it
+type ChannelOp struct {
+	done     chan struct{}
+	value    Object
+	received bool
+	err      error
+}
+
+func NewChannelOp() *ChannelOp {
+	return &ChannelOp{done: make(chan struct{})}
+}
+
+// Sets the outcome of the operation, received telling if a reception got a value. Must be
+// called exactly once.
+func (op *ChannelOp) Complete(value Object, received bool, err error) {
+	op.value = value
+	op.received = received
+	op.err = err
+	close(op.done)
+}
+
+// Closed once the operation is complete
+func (op *ChannelOp) Done() <-chan struct{} {
+	return op.done
+}
+
+// Blocks until the operation is complete
+func (op *ChannelOp) Wait() (Object, bool, error) {
+	<-op.done
+	return op.value, op.received, op.err
+}
@@ -26,8 +26,16 @@ const (
 	GT
 	GEQ
 
+	BIT_AND // Bitwise ops of last two items in stack
+	BIT_OR
+	BIT_XOR
+	SHL
+	SHR
+
 	BANG // Prefix modifiers
 	MINUS
+	BIT_NOT
+	CONVERT // Converts the value on top of the stack to the type of the object tag of the operand, see TAG_INTEGER
 
 	JUMP // Branch ops
 	JNT
@@ -35,12 +43,37 @@ const (
 	GLOBAL_SET // Global bindings
 	GLOBAL_GET
 
+	LOCAL_SET // Local bindings of the current frame
+	LOCAL_GET
+
+	BUILTIN_GET // Pushes the built-in function of the operand, see BUILTINS
+
+	CALL         // Calls the function below the arguments on the stack
+	RETURN_VALUE // Returns from current frame with the value on top of the stack
+	RETURN       // Returns from current frame without a value
+
+	SPAWN // Hands the function below the arguments on the stack to the executor, pushing a future
+	AWAIT // Replaces the future on top of the stack with the value of the call once it ends
+
+	MAKE_CHANNEL // Creates a channel with the capacity on top of the stack
+	SEND         // Sends the value on top of the stack on the channel below it, waiting for room
+	RECV         // Replaces the channel on top of the stack with a value received from it, or the constant of the operand once closed
+	CLOSE        // Closes the channel on top of the stack
+
+	ARRAY     // Replaces the number of values of the operand on top of the stack with an array of them
+	MAP       // Replaces the number of key and value pairs of the operand on top of the stack with a map of them
+	INDEX_GET // Replaces the array or map and the index or key on top of the stack with the value they give
+	INDEX_SET // Sets the element at the index or key below the value on top of the stack, in the array or map below them
+
 	IN // Program IO
 	OUT
 
 	POP // Pops from stack
 )
 
+// Operand of RECV when the element type has no zero value: receiving from a closed channel fails
+const NO_ZERO_VALUE = 0xFFFF
+
 type Definition struct {
 	Name          string
 	OperandWidths []int
@@ -62,8 +95,16 @@ var DEFINITIONS = map[OpCode]*Definition{
 	GT:  {"GT", []int{}},
 	GEQ: {"GEQ", []int{}},
 
-	BANG:  {"BANG", []int{}},
-	MINUS: {"MINUS", []int{}},
+	BIT_AND: {"BIT_AND", []int{}},
+	BIT_OR:  {"BIT_OR", []int{}},
+	BIT_XOR: {"BIT_XOR", []int{}},
+	SHL:     {"SHL", []int{}},
+	SHR:     {"SHR", []int{}},
+
+	BANG:    {"BANG", []int{}},
+	MINUS:   {"MINUS", []int{}},
+	BIT_NOT: {"BIT_NOT", []int{}},
+	CONVERT: {"CONVERT", []int{1}},
 
 	JUMP: {"JUMP", []int{2}},
 	JNT:  {"JNT", []int{2}},
@@ -71,7 +112,29 @@ var DEFINITIONS = map[OpCode]*Definition{
 	GLOBAL_SET: {"GLOBAL_SET", []int{2}},
 	GLOBAL_GET: {"GLOBAL_GET", []int{2}},
 
-	IN: {"IN", []int{2}},
+	LOCAL_SET: {"LOCAL_SET", []int{1}},
+	LOCAL_GET: {"LOCAL_GET", []int{1}},
+
+	BUILTIN_GET: {"BUILTIN_GET", []int{1}},
+
+	CALL:         {"CALL", []int{1}},
+	RETURN_VALUE: {"RETURN_VALUE", []int{}},
+	RETURN:       {"RETURN", []int{}},
+
+	SPAWN: {"SPAWN", []int{1}},
+	AWAIT: {"AWAIT", []int{}},
+
+	MAKE_CHANNEL: {"MAKE_CHANNEL", []int{}},
+	SEND:         {"SEND", []int{}},
+	RECV:         {"RECV", []int{2}},
+	CLOSE:        {"CLOSE", []int{}},
+
+	ARRAY:     {"ARRAY", []int{2}},
+	MAP:       {"MAP", []int{2}},
+	INDEX_GET: {"INDEX_GET", []int{}},
+	INDEX_SET: {"INDEX_SET", []int{}},
+
+	IN:  {"IN", []int{}},
 	OUT: {"OUT", []int{}},
 
 	POP: {"POP", []int{}},
@@ -80,6 +143,8 @@ var DEFINITIONS = map[OpCode]*Definition{
 type ByteCode struct {
 	Instructions Instructions
 	Constants    []Object
+	NumLocals    int // Locals of the main frame, declared in top level blocks
+	Debug        *DebugInfo
 }
 
 func LookupOperation(op byte) (*Definition, error) {
@@ -105,6 +170,8 @@ func MakeInstruction(op OpCode, operands ...int) []byte {
 	for index, operand := range operands {
 		width := definition.OperandWidths[index]
 		switch width {
+		case 1:
+			instruction[offset] = byte(operand)
 		case 2:
 			binary.BigEndian.PutUint16(instruction[offset:], uint16(operand))
 		}
@@ -118,6 +185,8 @@ func ReadInstructionOperands(definition *Definition, instruction Instructions) (
 	offset := 0
 	for i, width := range definition.OperandWidths {
 		switch width {
+		case 1:
+			operands[i] = int(ReadUint8(instruction[offset:]))
 		case 2:
 			operands[i] = int(ReadUint16(instruction[offset:]))
 		}
@@ -130,6 +199,10 @@ func ReadUint16(ins Instructions) uint16 {
 	return binary.BigEndian.Uint16(ins)
 }
 
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
 func (instruction Instructions) String() string {
 	var out strings.Builder
 	i := 0
@@ -137,6 +210,7 @@ func (instruction Instructions) String() string {
 		definition, err := LookupOperation(instruction[i])
 		if err != nil {
 			fmt.Fprintf(&out, "Error: %s\n", err)
+			i++
 			continue
 		}
 		operands, read := ReadInstructionOperands(definition, instruction[i+1:])
@@ -1,9 +1,13 @@
 package compiler
 
+import "sort"
+
 type SymbolScope string
 
 const (
-	GlobalScope SymbolScope = "GLOBAL"
+	GlobalScope  SymbolScope = "GLOBAL"
+	LocalScope   SymbolScope = "LOCAL"
+	BuiltinScope SymbolScope = "BUILTIN"
 )
 
 type Symbol struct {
@@ -12,24 +16,125 @@ type Symbol struct {
 	Index int
 }
 
+/*
+	Symbol tables are chained through Outer. The global table defines globals, every
+	other table defines locals stored in the slots of a frame:
+
+	- A function table owns the slots of the function frame.
+	- A block table (if, loop...) borrows slots from the table owning the frame it runs
+	  in, and gives them back when the block ends. Blocks at top level use the slots of
+	  the main frame, owned by the global table.
+*/
+
 type SymbolTable struct {
+	Outer *SymbolTable
+
 	store          map[string]Symbol
 	numDefinitions int
+
+	frame      *SymbolTable // Table owning the local slots
+	firstLocal int          // First slot borrowed by a block table
+	nextLocal  int          // Next free slot, on frame owners only
+	maxLocals  int          // Slots needed by the frame, on frame owners only
 }
 
 func NewSymbolTable() *SymbolTable {
 	s := make(map[string]Symbol)
-	return &SymbolTable{store: s}
+	symbolTable := &SymbolTable{store: s}
+	symbolTable.frame = symbolTable
+	return symbolTable
+}
+
+// Creates a symbol table for a function body. Its symbols are locals of the function frame.
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	symbolTable := NewSymbolTable()
+	symbolTable.Outer = outer
+	return symbolTable
+}
+
+// Creates a symbol table for a block nested in outer. Its symbols are locals of the enclosing frame.
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	symbolTable := NewEnclosedSymbolTable(outer)
+	symbolTable.frame = outer.frame
+	symbolTable.firstLocal = outer.frame.nextLocal
+	return symbolTable
+}
+
+// Copies a table owning its frame, so that definitions made in the copy do not change the
+// original. Used to drop the definitions of a REPL input that fails.
+func (symbolTable *SymbolTable) Copy() *SymbolTable {
+	copied := *symbolTable
+	copied.store = make(map[string]Symbol, len(symbolTable.store))
+	for name, symbol := range symbolTable.store {
+		copied.store[name] = symbol
+	}
+	copied.frame = &copied
+	return &copied
 }
 
 func (symbolTable *SymbolTable) Define(name string) Symbol {
-	symbol := Symbol{Name: name, Index: symbolTable.numDefinitions, Scope: GlobalScope}
+	symbol := Symbol{Name: name}
+	if symbolTable.Outer == nil {
+		symbol.Scope = GlobalScope
+		symbol.Index = symbolTable.numDefinitions
+	} else {
+		symbol.Scope = LocalScope
+		symbol.Index = symbolTable.frame.allocateLocal()
+	}
 	symbolTable.store[name] = symbol
 	symbolTable.numDefinitions++
 	return symbol
 }
 
+// Resolves name in this table and the outer ones. Names declared nowhere resolve to the
+// built-in function of that name, if any: programs can shadow built-in functions.
 func (symbolTable *SymbolTable) Resolve(name string) (Symbol, bool) {
 	obj, ok := symbolTable.store[name]
+	if !ok && symbolTable.Outer != nil {
+		return symbolTable.Outer.Resolve(name)
+	}
+	if !ok {
+		index, isBuiltin := LookupBuiltin(name)
+		if isBuiltin {
+			return Symbol{Name: name, Scope: BuiltinScope, Index: index}, true
+		}
+	}
 	return obj, ok
 }
+
+// Checks if name is declared by this table, ignoring outer ones
+func (symbolTable *SymbolTable) IsDefinedInScope(name string) bool {
+	_, ok := symbolTable.store[name]
+	return ok
+}
+
+// Symbols declared by this table, ordered by index
+func (symbolTable *SymbolTable) Symbols() []Symbol {
+	symbols := make([]Symbol, 0, len(symbolTable.store))
+	for _, symbol := range symbolTable.store {
+		symbols = append(symbols, symbol)
+	}
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i].Index < symbols[j].Index })
+	return symbols
+}
+
+// Gives back the slots borrowed by a block table once the block ends
+func (symbolTable *SymbolTable) ReleaseLocals() {
+	if symbolTable.frame != symbolTable {
+		symbolTable.frame.nextLocal = symbolTable.firstLocal
+	}
+}
+
+// Number of local slots the frame owned by this table needs
+func (symbolTable *SymbolTable) NumLocals() int {
+	return symbolTable.frame.maxLocals
+}
+
+func (symbolTable *SymbolTable) allocateLocal() int {
+	index := symbolTable.nextLocal
+	symbolTable.nextLocal++
+	if symbolTable.nextLocal > symbolTable.maxLocals {
+		symbolTable.maxLocals = symbolTable.nextLocal
+	}
+	return index
+}
@@ -0,0 +1,98 @@
+package compiler
+
+import "testing"
+
+func TestDefineAndResolveScopes(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+	if a != (Symbol{Name: "a", Scope: GlobalScope, Index: 0}) {
+		t.Errorf("wrong global symbol. got=%+v", a)
+	}
+
+	function := NewEnclosedSymbolTable(global)
+	function.Define("arg")
+	block := NewBlockSymbolTable(function)
+	b := block.Define("b")
+	if b != (Symbol{Name: "b", Scope: LocalScope, Index: 1}) {
+		t.Errorf("wrong block symbol. got=%+v", b)
+	}
+
+	resolved, ok := block.Resolve("a")
+	if !ok || resolved != a {
+		t.Errorf("could not resolve global from block. got=%+v", resolved)
+	}
+
+	shadow := block.Define("arg")
+	resolved, _ = block.Resolve("arg")
+	if resolved != shadow || resolved.Index != 2 {
+		t.Errorf("block symbol does not shadow parameter. got=%+v", resolved)
+	}
+
+	block.ReleaseLocals()
+	if _, ok := function.Resolve("b"); ok {
+		t.Errorf("block symbol `b` visible after the block")
+	}
+
+	sibling := NewBlockSymbolTable(function)
+	c := sibling.Define("c")
+	if c.Index != 1 {
+		t.Errorf("released slot not reused. got=%d", c.Index)
+	}
+
+	if function.NumLocals() != 3 {
+		t.Errorf("wrong number of locals. expected=3, got=%d", function.NumLocals())
+	}
+}
+
+func TestTopLevelBlockUsesMainFrame(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("g")
+
+	block := NewBlockSymbolTable(global)
+	local := block.Define("l")
+	if local != (Symbol{Name: "l", Scope: LocalScope, Index: 0}) {
+		t.Errorf("wrong top level block symbol. got=%+v", local)
+	}
+
+	if global.NumLocals() != 1 {
+		t.Errorf("wrong number of main frame locals. expected=1, got=%d", global.NumLocals())
+	}
+}
+
+func TestCopySymbolTable(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	copied := global.Copy()
+	b := copied.Define("b")
+	if b.Index != 1 {
+		t.Errorf("wrong index in copy. got=%d", b.Index)
+	}
+	if _, ok := global.Resolve("b"); ok {
+		t.Errorf("symbol defined in the copy is visible in the original")
+	}
+
+	symbols := copied.Symbols()
+	if len(symbols) != 2 || symbols[0].Name != "a" || symbols[1].Name != "b" {
+		t.Errorf("wrong symbols. got=%+v", symbols)
+	}
+}
+
+func TestResolveBuiltins(t *testing.T) {
+	global := NewSymbolTable()
+	function := NewEnclosedSymbolTable(global)
+
+	resolved, ok := function.Resolve("println")
+	if !ok || resolved != (Symbol{Name: "println", Scope: BuiltinScope, Index: 1}) {
+		t.Errorf("wrong built-in symbol. got=%+v", resolved)
+	}
+
+	shadow := global.Define("len")
+	resolved, _ = function.Resolve("len")
+	if resolved != shadow {
+		t.Errorf("global does not shadow the built-in function. got=%+v", resolved)
+	}
+	if len(global.Symbols()) != 1 {
+		t.Errorf("built-in functions listed with the symbols. got=%+v", global.Symbols())
+	}
+}
@@ -0,0 +1,95 @@
+package diagnostic
+
+import (
+	"atlas/lexer"
+	"fmt"
+)
+
+type Severity int
+
+const (
+	ERROR Severity = iota
+	WARNING
+	NOTE
+)
+
+func (severity Severity) String() string {
+	return [...]string{
+		"error",
+		"warning",
+		"note",
+	}[severity]
+}
+
+func (severity Severity) MarshalText() ([]byte, error) {
+	return []byte(severity.String()), nil
+}
+
+// Position in the source. Rows and columns start at 1, columns count bytes.
+type Position struct {
+	Row int `json:"row"`
+	Col int `json:"col"`
+}
+
+// Source range from Start to End, End excluded
+type Span struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Span of the text of token. Tokens without text, like the end of file, span one column.
+func SpanOf(token *lexer.Token) Span {
+	width := len(token.Value)
+	if width == 0 {
+		width = 1
+	}
+	return Span{
+		Start: Position{Row: token.Row, Col: token.Col},
+		End:   Position{Row: token.Row, Col: token.Col + width},
+	}
+}
+
+// Additional information attached to a diagnostic, optionally pointing at another place in the source
+type Note struct {
+	Message string `json:"message"`
+	Span    *Span  `json:"span,omitempty"`
+}
+
+// Problem found in the source by one of the front end passes. Code identifies the kind of
+// problem and stays the same when the wording of Message changes.
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+	Span     Span     `json:"span"`
+	Notes    []Note   `json:"notes,omitempty"`
+}
+
+// Creates an error pointing at token
+func NewError(code string, token *lexer.Token, format string, args ...any) Diagnostic {
+	diagnostic := Diagnostic{
+		Severity: ERROR,
+		Code:     code,
+		Message:  fmt.Sprintf(format, args...),
+	}
+	if token != nil {
+		diagnostic.Span = SpanOf(token)
+	}
+	return diagnostic
+}
+
+// Returns a copy of the diagnostic with a note pointing at token, or at nothing when token is nil
+func (diagnostic Diagnostic) WithNote(token *lexer.Token, format string, args ...any) Diagnostic {
+	note := Note{Message: fmt.Sprintf(format, args...)}
+	if token != nil {
+		span := SpanOf(token)
+		note.Span = &span
+	}
+	diagnostic.Notes = append(append([]Note{}, diagnostic.Notes...), note)
+	return diagnostic
+}
+
+// One line form, used where the source cannot be shown
+func (diagnostic Diagnostic) String() string {
+	return fmt.Sprintf("%s at line %d, column %d", diagnostic.Message, diagnostic.Span.Start.Row, diagnostic.Span.Start.Col)
+}
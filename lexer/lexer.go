@@ -4,12 +4,13 @@ import (
 	"atlas/utils"
 	"fmt"
 	"os"
+	"strings"
 	"unicode"
 )
 
-var KEYWORDS = []string{"if", "else", "return", "var", "int", "uint", "bool", "loop", "fun", "true", "false"}
+var KEYWORDS = []string{"if", "else", "return", "var", "int", "uint", "float", "bool", "string", "loop", "fun", "spawn", "await", "chan", "send", "recv", "close", "true", "false"}
 
-var OPERATORS_FIRSTS = []byte{'+', '-', '*', '/', '<', '>', '&', '|', '!', '=', '~'}
+var OPERATORS_FIRSTS = []byte{'+', '-', '*', '/', '<', '>', '&', '|', '!', '=', '~', '^'}
 var OPERATORS_ASSIGN_MAP = map[string]TokenType{
 	"=":  ASSIGN,
 	"==": EQ,
@@ -26,6 +27,9 @@ var OPERATORS_ASSIGN_MAP = map[string]TokenType{
 	"&":  BIT_AND,
 	"|":  BIT_OR,
 	"~":  BIT_NOT,
+	"^":  BIT_XOR,
+	"<<": SHIFT_LEFT,
+	">>": SHIFT_RIGHT,
 	"&&": LOGICAL_AND,
 	"||": LOGICAL_OR,
 }
@@ -39,13 +43,23 @@ var KEYWORDS_MAP = map[string]TokenType{
 	"loop":   LOOP,
 	"int":    TYPE_INT,
 	"uint":   TYPE_UINT,
+	"float":  TYPE_FLOAT,
 	"bool":   TYPE_BOOL,
+	"string": TYPE_STRING,
 	"fun":    FUN,
+	"spawn":  SPAWN,
+	"await":  AWAIT,
+	"chan":   CHAN,
+	"send":   SEND,
+	"recv":   RECV,
+	"close":  CLOSE,
+	"map":    MAP,
 	"true":   TRUE,
 	"false":  FALSE,
 }
 
-var TYPES_KEYWORDS = []TokenType{TYPE_INT, TYPE_UINT, TYPE_BOOL}
+// Tokens starting a type: the type keywords, `chan`, `map` and the `[]` of array types
+var TYPES_KEYWORDS = []TokenType{TYPE_INT, TYPE_UINT, TYPE_FLOAT, TYPE_BOOL, TYPE_STRING, CHAN, MAP, LBRACKET}
 
 type TokenType int
 
@@ -58,17 +72,28 @@ const (
 	WHILE
 	LOOP
 	FUN
+	SPAWN
+	AWAIT
+	CHAN
+	SEND
+	RECV
+	CLOSE
+	MAP
 
 	TRUE // Built-in literals
 	FALSE
 
 	TYPE_INT // Built-in types
 	TYPE_UINT
+	TYPE_FLOAT
 	TYPE_BOOL
+	TYPE_STRING
 
-	IDENTIFIER  // An identifier variable
-	LITERAL_INT // A LITERAL number
-	OPERATOR    // An operator
+	IDENTIFIER     // An identifier variable
+	LITERAL_INT    // A LITERAL number
+	LITERAL_FLOAT  // A LITERAL number with a fractional part or an exponent
+	LITERAL_STRING // A LITERAL string, with its quotes and escape sequences as written
+	OPERATOR       // An operator
 
 	EQ  // ==
 	NEQ // ==
@@ -87,6 +112,10 @@ const (
 	BIT_AND // &
 	BIT_OR  // |
 	BIT_NOT // ~
+	BIT_XOR // ^
+
+	SHIFT_LEFT  // <<
+	SHIFT_RIGHT // >>
 
 	LOGICAL_AND // &&
 	LOGICAL_OR  // ||
@@ -110,20 +139,32 @@ func (d TokenType) String() string {
 		"var keyword",
 		"if keyword",
 		"else keyword",
+		"in keyword",
 		"return keyword",
 		"while keyword",
-		"for keyword",
+		"loop keyword",
 		"function keyword",
+		"spawn keyword",
+		"await keyword",
+		"chan keyword",
+		"send keyword",
+		"recv keyword",
+		"close keyword",
+		"map keyword",
 
 		"true keyword",
 		"false keyword",
 
 		"Integer type keyword",
 		"Unsigned int type keyword",
+		"Float type keyword",
 		"Boolean type keyword",
+		"String type keyword",
 
 		"Identifier",
 		"Literal number",
+		"Literal float",
+		"Literal string",
 		"Operator",
 
 		"Equal",
@@ -143,6 +184,10 @@ func (d TokenType) String() string {
 		"Bit AND",
 		"Bit OR",
 		"Bit NOT",
+		"Bit XOR",
+
+		"Shift left",
+		"Shift right",
 
 		"Logical AND",
 		"Logical OR",
@@ -282,7 +327,16 @@ func (tokenizer *Tokenizer) NextToken() (*Token, error) {
 			return &token, nil
 		} else if unicode.IsNumber(rune(currentChar)) {
 			value, new_i := tokenizer.readLiteralNumber()
-			token := createToken(LITERAL_INT, value, tokenizer.line, tokenizer.index-tokenizer.lineStart)
+			tokenType := LITERAL_INT
+			if strings.ContainsAny(value, ".eE") {
+				tokenType = LITERAL_FLOAT
+			}
+			token := createToken(tokenType, value, tokenizer.line, tokenizer.index-tokenizer.lineStart)
+			tokenizer.index = new_i
+			return &token, nil
+		} else if currentChar == '"' {
+			value, new_i := tokenizer.readLiteralString()
+			token := createToken(LITERAL_STRING, value, tokenizer.line, tokenizer.index-tokenizer.lineStart)
 			tokenizer.index = new_i
 			return &token, nil
 		} else if currentChar == ';' {
@@ -305,8 +359,8 @@ func (tokenizer *Tokenizer) NextToken() (*Token, error) {
 		}
 	}
 
-	tokenizer.resetCusrors()
 	eofToken := createToken(EOF, "", tokenizer.line, tokenizer.index-tokenizer.lineStart)
+	tokenizer.resetCusrors()
 	return &eofToken, nil
 }
 
@@ -360,6 +414,8 @@ func (tokenizer *Tokenizer) readIdentifier() (string, int) {
 	return buffer, i
 }
 
+// Reads a number with the dots and exponent of floats. Malformed numbers like 1.2.3 are read
+// whole, for the parser to report them.
 func (tokenizer *Tokenizer) readLiteralNumber() (string, int) {
 	i := tokenizer.index
 	currentChar := (*tokenizer.code)[tokenizer.index]
@@ -371,6 +427,16 @@ func (tokenizer *Tokenizer) readLiteralNumber() (string, int) {
 			break
 		}
 		currentChar = (*tokenizer.code)[i]
+		if currentChar == 'e' || currentChar == 'E' {
+			// Exponent of scientific notation, with its optional sign
+			buffer += string(currentChar)
+			i++
+			if i < len(*tokenizer.code) && ((*tokenizer.code)[i] == '+' || (*tokenizer.code)[i] == '-') {
+				buffer += string((*tokenizer.code)[i])
+				i++
+			}
+			continue
+		}
 		if currentChar != '.' && !unicode.IsNumber(rune(currentChar)) {
 			break
 		}
@@ -380,6 +446,58 @@ func (tokenizer *Tokenizer) readLiteralNumber() (string, int) {
 	return buffer, i
 }
 
+// Reads a string literal up to its closing quote, or up to the end of the line when it is
+// unterminated: Unquote reports it
+func (tokenizer *Tokenizer) readLiteralString() (string, int) {
+	i := tokenizer.index + 1
+	for i < len(*tokenizer.code) {
+		currentChar := (*tokenizer.code)[i]
+		if currentChar == '\n' {
+			break
+		}
+		i++
+		if currentChar == '"' {
+			break
+		}
+		if currentChar == '\\' && i < len(*tokenizer.code) && (*tokenizer.code)[i] != '\n' {
+			i++
+		}
+	}
+	return (*tokenizer.code)[tokenizer.index:i], i
+}
+
+// Characters written after a backslash in string literals, and the characters they stand for
+var ESCAPE_SEQUENCES = map[byte]byte{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'0':  0,
+	'\\': '\\',
+	'"':  '"',
+}
+
+// Gives the value of a string literal token, replacing its escape sequences
+func Unquote(literal string) (string, error) {
+	var value strings.Builder
+	for i := 1; i < len(literal); i++ {
+		currentChar := literal[i]
+		switch {
+		case currentChar == '"' && i == len(literal)-1:
+			return value.String(), nil
+		case currentChar == '\\' && i+1 < len(literal):
+			i++
+			escaped, ok := ESCAPE_SEQUENCES[literal[i]]
+			if !ok {
+				return "", fmt.Errorf("unknown escape sequence `\\%c`", literal[i])
+			}
+			value.WriteByte(escaped)
+		default:
+			value.WriteByte(currentChar)
+		}
+	}
+	return "", fmt.Errorf("unterminated string literal")
+}
+
 func (tokenizer *Tokenizer) readOperatorOrAssign() (string, TokenType, int) {
 	buffer := string((*tokenizer.code)[tokenizer.index])
 
@@ -353,4 +353,159 @@ func TestLexerFromFileWithAdvancedCode(t *testing.T) {
 			t.Fatalf("test %d - literal wrong. expected=%q, got=%q", i, tt.expectedValue, tok.Value)
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestLexerBitwiseOperators(t *testing.T) {
+	code := `a & b | c ^ ~d << 2 >> 1 && e || !f`
+
+	expected := []TokenType{
+		IDENTIFIER, BIT_AND, IDENTIFIER, BIT_OR, IDENTIFIER, BIT_XOR, BIT_NOT, IDENTIFIER,
+		SHIFT_LEFT, LITERAL_INT, SHIFT_RIGHT, LITERAL_INT, LOGICAL_AND, IDENTIFIER,
+		LOGICAL_OR, BANG, IDENTIFIER, EOF,
+	}
+
+	tokenizer := New(&code)
+
+	for i, exp := range expected {
+		token, err := tokenizer.NextToken()
+		if err != nil {
+			t.Fatalf("Error getting next token: %v", err)
+		}
+
+		if token.Type != exp {
+			t.Errorf("Test case %d: expected token type %v, got %v", i, exp, token.Type)
+		}
+	}
+}
+
+func TestLexerChannelKeywords(t *testing.T) {
+	code := `var c: chan int = chan(); send(c, recv(c)); close(c);`
+
+	expected := []TokenType{
+		VAR, IDENTIFIER, COLON, CHAN, TYPE_INT, ASSIGN, CHAN, LPAR, RPAR, SEMICOLON,
+		SEND, LPAR, IDENTIFIER, COMMA, RECV, LPAR, IDENTIFIER, RPAR, RPAR, SEMICOLON,
+		CLOSE, LPAR, IDENTIFIER, RPAR, SEMICOLON, EOF,
+	}
+
+	tokenizer := New(&code)
+
+	for i, exp := range expected {
+		token, err := tokenizer.NextToken()
+		if err != nil {
+			t.Fatalf("Error getting next token: %v", err)
+		}
+
+		if token.Type != exp {
+			t.Errorf("Test case %d: expected token type %v, got %v", i, exp, token.Type)
+		}
+	}
+}
+
+func TestLexerStrings(t *testing.T) {
+	code := `var s: string = "say \"hi\"\n"; "unterminated
+"end\`
+
+	expected := []struct {
+		tokenType TokenType
+		value     string
+	}{
+		{VAR, "var"},
+		{IDENTIFIER, "s"},
+		{COLON, ":"},
+		{TYPE_STRING, "string"},
+		{ASSIGN, "="},
+		{LITERAL_STRING, `"say \"hi\"\n"`},
+		{SEMICOLON, ";"},
+		{LITERAL_STRING, `"unterminated`},
+		{LITERAL_STRING, `"end\`},
+		{EOF, ""},
+	}
+
+	tokenizer := New(&code)
+
+	for i, exp := range expected {
+		token, err := tokenizer.NextToken()
+		if err != nil {
+			t.Fatalf("Error getting next token: %v", err)
+		}
+
+		if token.Type != exp.tokenType {
+			t.Errorf("Test case %d: expected token type %v, got %v", i, exp.tokenType, token.Type)
+		}
+
+		if token.Value != exp.value {
+			t.Errorf("Test case %d: expected token value '%s', got '%s'", i, exp.value, token.Value)
+		}
+	}
+}
+
+func TestLexerFloats(t *testing.T) {
+	code := `var f: float = 3.14 * 2.5e-3 + 1E6 - 1.2.3 + 1e;`
+
+	expected := []struct {
+		tokenType TokenType
+		value     string
+	}{
+		{VAR, "var"},
+		{IDENTIFIER, "f"},
+		{COLON, ":"},
+		{TYPE_FLOAT, "float"},
+		{ASSIGN, "="},
+		{LITERAL_FLOAT, "3.14"},
+		{MULTIPLY, "*"},
+		{LITERAL_FLOAT, "2.5e-3"},
+		{PLUS, "+"},
+		{LITERAL_FLOAT, "1E6"},
+		{MINUS, "-"},
+		{LITERAL_FLOAT, "1.2.3"},
+		{PLUS, "+"},
+		{LITERAL_FLOAT, "1e"},
+		{SEMICOLON, ";"},
+		{EOF, ""},
+	}
+
+	tokenizer := New(&code)
+
+	for i, exp := range expected {
+		token, err := tokenizer.NextToken()
+		if err != nil {
+			t.Fatalf("Error getting next token: %v", err)
+		}
+
+		if token.Type != exp.tokenType {
+			t.Errorf("Test case %d: expected token type %v, got %v", i, exp.tokenType, token.Type)
+		}
+
+		if token.Value != exp.value {
+			t.Errorf("Test case %d: expected token value '%s', got '%s'", i, exp.value, token.Value)
+		}
+	}
+}
+
+func TestUnquote(t *testing.T) {
+	tests := []struct {
+		literal  string
+		expected string
+		err      string
+	}{
+		{`""`, "", ""},
+		{`"héllo"`, "héllo", ""},
+		{`"a\tb\\c\"d\n\r\0"`, "a\tb\\c\"d\n\r\x00", ""},
+		{`"bad \q"`, "", "unknown escape sequence `\\q`"},
+		{`"open`, "", "unterminated string literal"},
+		{`"open\"`, "", "unterminated string literal"},
+	}
+
+	for _, tt := range tests {
+		value, err := Unquote(tt.literal)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("expected error %q for %s. got=%v", tt.err, tt.literal, err)
+			}
+			continue
+		}
+		if err != nil || value != tt.expected {
+			t.Errorf("wrong value for %s. expected=%q, got=%q (%v)", tt.literal, tt.expected, value, err)
+		}
+	}
+}
@@ -1,11 +1,23 @@
 package parser
 
 import (
+	"atlas/diagnostic"
 	"atlas/lexer"
+	"errors"
 	"fmt"
 	"strconv"
 )
 
+// Codes of the diagnostics reported by the parser
+const (
+	UNEXPECTED_TOKEN    = "P001"
+	EXPECTED_EXPRESSION = "P002"
+	INVALID_LITERAL     = "P003"
+	UNCLOSED_BLOCK      = "P004"
+	EXPECTED_CALL       = "P005"
+	INVALID_ARGUMENTS   = "P006"
+)
+
 type (
 	prefixParseFn func() Expression
 	infixParseFn  func(Expression) Expression
@@ -16,7 +28,8 @@ type Parser struct {
 	currentToken *lexer.Token
 	peekToken    *lexer.Token
 
-	Errors []string
+	Errors     []diagnostic.Diagnostic
+	recovering bool // Set by an error until the parser skips to the end of the statement
 
 	prefixParseFns map[lexer.TokenType]prefixParseFn
 	infixParseFns  map[lexer.TokenType]infixParseFn
@@ -28,14 +41,27 @@ func setupParser(parser *Parser) {
 
 	parser.registerPrefixParser(lexer.IDENTIFIER, parser.parseIdentifierExpression)
 	parser.registerPrefixParser(lexer.LITERAL_INT, parser.parseUnsignedIntegerLiteralExpression)
+	parser.registerPrefixParser(lexer.LITERAL_FLOAT, parser.parseFloatLiteralExpression)
+	parser.registerPrefixParser(lexer.LITERAL_STRING, parser.parseStringLiteralExpression)
 	parser.registerPrefixParser(lexer.TRUE, parser.parseBooleanLiteralExpression)
 	parser.registerPrefixParser(lexer.FALSE, parser.parseBooleanLiteralExpression)
 	parser.registerPrefixParser(lexer.BANG, parser.parsePrefixExpression)
 	parser.registerPrefixParser(lexer.BIT_NOT, parser.parsePrefixExpression)
 	parser.registerPrefixParser(lexer.MINUS, parser.parsePrefixExpression)
 	parser.registerPrefixParser(lexer.LPAR, parser.parseGroupedExpression)
+	parser.registerPrefixParser(lexer.SPAWN, parser.parseSpawnExpression)
+	parser.registerPrefixParser(lexer.AWAIT, parser.parseAwaitExpression)
+	parser.registerPrefixParser(lexer.CHAN, parser.parseChannelExpression)
+	parser.registerPrefixParser(lexer.RECV, parser.parseRecvExpression)
+	parser.registerPrefixParser(lexer.LBRACKET, parser.parseArrayLiteralExpression)
+	parser.registerPrefixParser(lexer.LBRACE, parser.parseMapLiteralExpression)
+	parser.registerPrefixParser(lexer.TYPE_INT, parser.parseConversionExpression)
+	parser.registerPrefixParser(lexer.TYPE_UINT, parser.parseConversionExpression)
+	parser.registerPrefixParser(lexer.TYPE_FLOAT, parser.parseConversionExpression)
+	parser.registerPrefixParser(lexer.TYPE_BOOL, parser.parseConversionExpression)
 
 	parser.registerInfixParser(lexer.LPAR, parser.parseCallExpression)
+	parser.registerInfixParser(lexer.LBRACKET, parser.parseIndexExpression)
 	parser.registerInfixParser(lexer.MINUS, parser.parseInfixExpression)
 	parser.registerInfixParser(lexer.PLUS, parser.parseInfixExpression)
 	parser.registerInfixParser(lexer.MULTIPLY, parser.parseInfixExpression)
@@ -49,7 +75,10 @@ func setupParser(parser *Parser) {
 	parser.registerInfixParser(lexer.LOGICAL_AND, parser.parseInfixExpression)
 	parser.registerInfixParser(lexer.LOGICAL_OR, parser.parseInfixExpression)
 	parser.registerInfixParser(lexer.BIT_AND, parser.parseInfixExpression)
-	parser.registerInfixParser(lexer.BIT_NOT, parser.parseInfixExpression)
+	parser.registerInfixParser(lexer.BIT_OR, parser.parseInfixExpression)
+	parser.registerInfixParser(lexer.BIT_XOR, parser.parseInfixExpression)
+	parser.registerInfixParser(lexer.SHIFT_LEFT, parser.parseInfixExpression)
+	parser.registerInfixParser(lexer.SHIFT_RIGHT, parser.parseInfixExpression)
 }
 
 func New(code *string) *Parser {
@@ -57,7 +86,7 @@ func New(code *string) *Parser {
 		tokenizer:    lexer.New(code),
 		currentToken: nil,
 		peekToken:    nil,
-		Errors:       []string{},
+		Errors:       []diagnostic.Diagnostic{},
 
 		prefixParseFns: make(map[lexer.TokenType]prefixParseFn),
 		infixParseFns:  make(map[lexer.TokenType]infixParseFn),
@@ -78,7 +107,7 @@ func NewFromFile(filePath string) (*Parser, error) {
 		tokenizer:    *tokenizer,
 		currentToken: nil,
 		peekToken:    nil,
-		Errors:       []string{},
+		Errors:       []diagnostic.Diagnostic{},
 
 		prefixParseFns: make(map[lexer.TokenType]prefixParseFn),
 		infixParseFns:  make(map[lexer.TokenType]infixParseFn),
@@ -124,11 +153,73 @@ func (parser *Parser) peekTokenIs(tokenType lexer.TokenType) bool {
 }
 
 func (parser *Parser) currentTokenIsDataType() bool {
-	return parser.currentToken != nil && (lexer.TYPE_INT == parser.currentToken.Type || lexer.TYPE_UINT == parser.currentToken.Type || lexer.TYPE_BOOL == parser.currentToken.Type)
+	return parser.currentToken != nil && parser.currentToken.IsTypeKeyword()
 }
 
 func (parser *Parser) peekTokenIsDataType() bool {
-	return parser.peekToken != nil && (lexer.TYPE_INT == parser.peekToken.Type || lexer.TYPE_UINT == parser.peekToken.Type || lexer.TYPE_BOOL == parser.peekToken.Type)
+	return parser.peekToken != nil && parser.peekToken.IsTypeKeyword()
+}
+
+// Parses the type starting at the current token, a type keyword, `chan` or `[]` followed by
+// the type of the elements, or `map[K]` followed by the type of the values
+func (parser *Parser) parseDataType() (DataType, bool) {
+	if parser.currentTokenIs(lexer.MAP) {
+		if !parser.peekTokenIs(lexer.LBRACKET) {
+			parser.reportUnexpectedToken(parser.peekToken, lexer.LBRACKET)
+			return INFERED, false
+		}
+		parser.nextToken()
+		keyToken := parser.peekToken
+		key, ok := parser.parseElementType()
+		if !ok {
+			return INFERED, false
+		}
+		// Keys are hashed by value, which only basic types have
+		if key.Kind() != BASIC {
+			parser.reportError(UNEXPECTED_TOKEN, keyToken, "Map keys must be integers, booleans or strings, found %s", key)
+			return INFERED, false
+		}
+		if !parser.peekTokenIs(lexer.RBRACKET) {
+			parser.reportUnexpectedToken(parser.peekToken, lexer.RBRACKET)
+			return INFERED, false
+		}
+		parser.nextToken()
+		element, ok := parser.parseElementType()
+		return MapOf(key, element), ok
+	}
+	if parser.currentTokenIs(lexer.CHAN) {
+		if !parser.peekTokenIsDataType() {
+			parser.reportUnexpectedToken(parser.peekToken, lexer.TYPES_KEYWORDS...)
+			return INFERED, false
+		}
+		element, ok := parser.parseElementType()
+		return ChannelOf(element), ok
+	}
+	if parser.currentTokenIs(lexer.LBRACKET) {
+		if !parser.peekTokenIs(lexer.RBRACKET) {
+			parser.reportUnexpectedToken(parser.peekToken, lexer.RBRACKET)
+			return INFERED, false
+		}
+		parser.nextToken()
+		element, ok := parser.parseElementType()
+		return ArrayOf(element), ok
+	}
+
+	dataType, ok := DATA_TYPE_MAP[parser.currentToken.Type]
+	if !ok {
+		parser.reportUnexpectedToken(parser.currentToken, lexer.TYPES_KEYWORDS...)
+	}
+	return dataType, ok
+}
+
+// Parses the type following the current token, part of a composite type
+func (parser *Parser) parseElementType() (DataType, bool) {
+	if !parser.peekTokenIsDataType() {
+		parser.reportUnexpectedToken(parser.peekToken, lexer.TYPES_KEYWORDS...)
+		return INFERED, false
+	}
+	parser.nextToken()
+	return parser.parseDataType()
 }
 
 func (parser *Parser) currentTokenPrecedence() int {
@@ -145,8 +236,17 @@ func (parser *Parser) peekTokenPrecedence() int {
 	return LOWEST
 }
 
-func (parser *Parser) reportError(err string) {
-	parser.Errors = append(parser.Errors, err)
+// Only the first error of a statement is reported, the following ones are most likely caused by it
+func (parser *Parser) report(diagnostic diagnostic.Diagnostic) {
+	if parser.recovering {
+		return
+	}
+	parser.Errors = append(parser.Errors, diagnostic)
+	parser.recovering = true
+}
+
+func (parser *Parser) reportError(code string, token *lexer.Token, format string, args ...any) {
+	parser.report(diagnostic.NewError(code, token, format, args...))
 }
 
 func (parser *Parser) reportUnexpectedToken(found *lexer.Token, expected ...lexer.TokenType) {
@@ -158,12 +258,61 @@ func (parser *Parser) reportUnexpectedToken(found *lexer.Token, expected ...lexe
 			}
 			expectedMsg += fmt.Sprint(expect)
 		}
-		parser.reportError(fmt.Sprintf("Expected %s, found %s %s", expectedMsg, found.Type, found.FormattedLocation()))
+		parser.reportError(UNEXPECTED_TOKEN, found, "Expected %s, found %s", expectedMsg, found.Type)
 	} else {
-		parser.reportError(fmt.Sprintf("Unexpected token %s found %s", found.Type, found.FormattedLocation()))
+		parser.reportError(UNEXPECTED_TOKEN, found, "Unexpected token %s", found.Type)
 	}
 }
 
+// Skips the rest of a statement in error, up to its semicolon or the brace closing its last
+// block, so that parsing goes on with the next statement. Returns true when it stops on a brace
+// closing an enclosing block, which is left to be read by that block.
+func (parser *Parser) synchronize() bool {
+	parser.recovering = false
+
+	depth := 0
+	for !parser.currentTokenIs(lexer.EOF) {
+		switch parser.currentToken.Type {
+		case lexer.SEMICOLON:
+			if depth == 0 {
+				return false
+			}
+		case lexer.LBRACE:
+			depth++
+		case lexer.RBRACE:
+			if depth == 0 {
+				return true
+			}
+			depth--
+			if depth == 0 && !parser.peekTokenIs(lexer.ELSE) {
+				return false
+			}
+		}
+		if depth == 0 && (parser.peekTokenIs(lexer.RBRACE) || parser.peekStartsStatement()) {
+			return false
+		}
+		parser.nextToken()
+	}
+	return false
+}
+
+// Checks if the next token can only start a statement, which ends the statement in error
+func (parser *Parser) peekStartsStatement() bool {
+	switch parser.peekToken.Type {
+	case lexer.VAR, lexer.IF, lexer.LOOP, lexer.FUN, lexer.RETURN, lexer.IN, lexer.SEND, lexer.CLOSE:
+		return true
+	}
+	return false
+}
+
+// Reports a missing semicolon right after the current token, where it was forgotten
+func (parser *Parser) reportMissingSemicolon() {
+	position := *parser.currentToken
+	position.Col += len(position.Value)
+	position.Value = ""
+	parser.reportError(UNEXPECTED_TOKEN, &position, "Expected %s, found %s", lexer.SEMICOLON, parser.peekToken.Type)
+}
+
 // Parses statement as long as there is a token to read
 func (parser *Parser) Parse() Program {
 	program := newProgram()
@@ -174,7 +323,9 @@ func (parser *Parser) Parse() Program {
 		}
 
 		statement := parser.parseStatement()
-		if statement != nil {
+		if parser.recovering {
+			parser.synchronize()
+		} else if statement != nil {
 			program.addStatement(statement)
 		}
 		parser.nextToken()
@@ -200,6 +351,10 @@ func (parser *Parser) parseStatement() Statement {
 		statement = parser.parseFunctionDeclarationStatement()
 	case lexer.RETURN:
 		statement = parser.parseReturnStatement()
+	case lexer.SEND:
+		statement = parser.parseSendStatement()
+	case lexer.CLOSE:
+		statement = parser.parseCloseStatement()
 	default:
 		statement = parser.parseExpressionStatement()
 	}
@@ -224,14 +379,15 @@ func (parser *Parser) parseDeclarationOrAssignmentOrExpression(assignment bool)
 			parser.reportUnexpectedToken(parser.peekToken, lexer.TYPES_KEYWORDS...)
 		} else {
 			parser.nextToken()
-			t = DATA_TYPE_MAP[parser.currentToken.Type]
+			t, _ = parser.parseDataType()
 		}
-	} else if assignment && parser.peekTokenIs(lexer.LPAR) {
+	} else if assignment && !parser.peekTokenIs(lexer.ASSIGN) {
+		// An identifier not followed by `=` starts an expression, like `a;` or `f(1) + 2;`
 		return parser.parseExpressionStatement()
 	}
 
 	if !parser.peekTokenIs(lexer.ASSIGN) {
-		parser.reportUnexpectedToken(parser.currentToken, lexer.ASSIGN)
+		parser.reportUnexpectedToken(parser.peekToken, lexer.ASSIGN)
 	} else {
 		parser.nextToken()
 	}
@@ -241,7 +397,7 @@ func (parser *Parser) parseDeclarationOrAssignmentOrExpression(assignment bool)
 	value := parser.parseExpression(LOWEST)
 
 	if !parser.peekTokenIs(lexer.SEMICOLON) {
-		parser.reportUnexpectedToken(parser.currentToken, lexer.SEMICOLON)
+		parser.reportMissingSemicolon()
 	} else {
 		parser.nextToken()
 	}
@@ -271,7 +427,7 @@ func (parser *Parser) parseInputStatement() *InputStatement {
 	}
 
 	if !parser.peekTokenIs(lexer.SEMICOLON) {
-		parser.reportUnexpectedToken(parser.currentToken, lexer.SEMICOLON)
+		parser.reportMissingSemicolon()
 	} else {
 		parser.nextToken()
 	}
@@ -304,7 +460,7 @@ func (parser *Parser) parseUnsignedIntegerLiteral() *UnsignedIntegerLiteralExpre
 	}
 	convertedInteger, err := strconv.ParseUint(parser.currentToken.Value, 0, 64)
 	if err != nil {
-		parser.reportError(fmt.Sprintf("Could not convert `%s` to integer %s", parser.currentToken.Value, parser.currentToken.FormattedLocation()))
+		parser.reportError(INVALID_LITERAL, parser.currentToken, "Could not convert `%s` to integer", parser.currentToken.Value)
 		return nil
 	}
 	return &UnsignedIntegerLiteralExpression{
@@ -317,6 +473,34 @@ func (parser *Parser) parseUnsignedIntegerLiteralExpression() Expression {
 	return parser.parseUnsignedIntegerLiteral()
 }
 
+func (parser *Parser) parseFloatLiteralExpression() Expression {
+	value, err := strconv.ParseFloat(parser.currentToken.Value, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		parser.reportError(INVALID_LITERAL, parser.currentToken, "Float literal `%s` is out of range", parser.currentToken.Value)
+		return nil
+	}
+	if err != nil {
+		parser.reportError(INVALID_LITERAL, parser.currentToken, "Malformed float literal `%s`", parser.currentToken.Value)
+		return nil
+	}
+	return &FloatLiteralExpression{
+		Token: parser.currentToken,
+		Value: value,
+	}
+}
+
+func (parser *Parser) parseStringLiteralExpression() Expression {
+	value, err := lexer.Unquote(parser.currentToken.Value)
+	if err != nil {
+		parser.reportError(INVALID_LITERAL, parser.currentToken, "Invalid string literal: %s", err)
+		return nil
+	}
+	return &StringLiteralExpression{
+		Token: parser.currentToken,
+		Value: value,
+	}
+}
+
 func (parser *Parser) parseBooleanLiteral() *BooleanLiteralExpression {
 	if parser.currentToken.Type != lexer.TRUE && parser.currentToken.Type != lexer.FALSE {
 		parser.reportUnexpectedToken(parser.currentToken, lexer.TRUE, lexer.FALSE)
@@ -335,7 +519,11 @@ func (parser *Parser) parseBooleanLiteralExpression() Expression {
 func (parser *Parser) parseExpression(precedence int) Expression {
 	prefix := parser.prefixParseFns[parser.currentToken.Type]
 	if prefix == nil {
-		parser.reportError(fmt.Sprintf("No prefix expression associated to operator %s %s", parser.currentToken.Value, parser.currentToken.FormattedLocation()))
+		if parser.currentTokenIs(lexer.ILLEGAL) {
+			parser.reportError(EXPECTED_EXPRESSION, parser.currentToken, "Illegal character `%s`", parser.currentToken.Value)
+		} else {
+			parser.reportError(EXPECTED_EXPRESSION, parser.currentToken, "Expected expression, found %s", parser.currentToken.Type)
+		}
 		return nil
 	}
 
@@ -374,6 +562,133 @@ func (parser *Parser) parsePrefixExpression() Expression {
 	return expression
 }
 
+// Spawn expression: spawn f(x), the operand must be a call
+func (parser *Parser) parseSpawnExpression() Expression {
+	expression := &SpawnExpression{Token: parser.currentToken}
+	parser.nextToken()
+	operand := parser.parseExpression(PREFIX)
+	if operand == nil {
+		return nil
+	}
+	call, ok := operand.(*CallExpression)
+	if !ok {
+		parser.reportError(EXPECTED_CALL, operand.GetToken(), "Expected a function call after spawn")
+		return nil
+	}
+	expression.Call = call
+	return expression
+}
+
+func (parser *Parser) parseAwaitExpression() Expression {
+	expression := &AwaitExpression{Token: parser.currentToken}
+	parser.nextToken()
+	expression.Future = parser.parseExpression(PREFIX)
+	if expression.Future == nil {
+		return nil
+	}
+	return expression
+}
+
+// Parses the parenthesized arguments of a keyword like the channel operations and the
+// conversions, which takes count of them
+func (parser *Parser) parseKeywordArguments(count int) []Expression {
+	keyword := parser.currentToken
+	if !parser.peekTokenIs(lexer.LPAR) {
+		parser.reportUnexpectedToken(parser.peekToken, lexer.LPAR)
+		return nil
+	}
+	parser.nextToken()
+
+	args := parser.parseCallArguments()
+	if args == nil {
+		return nil
+	}
+
+	if len(args) != count {
+		parser.reportError(INVALID_ARGUMENTS, keyword, "`%s` expects %d arguments, found %d", keyword.Value, count, len(args))
+		return nil
+	}
+	return args
+}
+
+// Conversion expression: int(value), uint(value), float(value) or bool(value)
+func (parser *Parser) parseConversionExpression() Expression {
+	expression := &ConversionExpression{Token: parser.currentToken, Type: DATA_TYPE_MAP[parser.currentToken.Type]}
+	args := parser.parseKeywordArguments(1)
+	if args == nil {
+		return nil
+	}
+	expression.Value = args[0]
+	return expression
+}
+
+// Channel expression: chan() or chan(capacity)
+func (parser *Parser) parseChannelExpression() Expression {
+	expression := &ChannelExpression{Token: parser.currentToken}
+	if !parser.peekTokenIs(lexer.LPAR) {
+		parser.reportUnexpectedToken(parser.peekToken, lexer.LPAR)
+		return nil
+	}
+	parser.nextToken()
+
+	args := parser.parseCallArguments()
+	if args == nil {
+		return nil
+	}
+
+	if len(args) > 1 {
+		parser.reportError(INVALID_ARGUMENTS, expression.Token, "`chan` expects at most 1 argument, found %d", len(args))
+		return nil
+	}
+	if len(args) == 1 {
+		expression.Capacity = args[0]
+	}
+	return expression
+}
+
+func (parser *Parser) parseRecvExpression() Expression {
+	expression := &RecvExpression{Token: parser.currentToken}
+	args := parser.parseKeywordArguments(1)
+	if args == nil {
+		return nil
+	}
+	expression.Channel = args[0]
+	return expression
+}
+
+func (parser *Parser) parseSendStatement() *SendStatement {
+	statement := &SendStatement{Token: parser.currentToken}
+	args := parser.parseKeywordArguments(2)
+	if args == nil {
+		return nil
+	}
+	statement.Channel = args[0]
+	statement.Value = args[1]
+
+	if !parser.peekTokenIs(lexer.SEMICOLON) {
+		parser.reportMissingSemicolon()
+	} else {
+		parser.nextToken()
+	}
+	return statement
+}
+
+func (parser *Parser) parseCloseStatement() *CloseStatement {
+	statement := &CloseStatement{Token: parser.currentToken}
+	args := parser.parseKeywordArguments(1)
+	if args == nil {
+		return nil
+	}
+	statement.Channel = args[0]
+
+	if !parser.peekTokenIs(lexer.SEMICOLON) {
+		parser.reportMissingSemicolon()
+	} else {
+		parser.nextToken()
+	}
+	return statement
+}
+
 func (parser *Parser) parseInfixExpression(left Expression) Expression {
 	expression := &InfixExpression{
 		Token:    parser.currentToken,
@@ -390,12 +705,10 @@ func (parser *Parser) parserIfStatement() *IfStatement {
 	startToken := parser.currentToken
 	parser.nextToken()
 
-	condition, consequence := parser.parseConditionAndConsequence()
+	condition, consequence := parser.parseConditionAndConsequence(startToken)
 	conditions := []Expression{condition}
 	consequences := []*StatementsBlock{consequence}
 
-	println(len(consequences))
-
 	var elseConsequence *StatementsBlock = nil
 	for parser.peekTokenIs(lexer.ELSE) {
 		parser.nextToken()
@@ -405,8 +718,9 @@ func (parser *Parser) parserIfStatement() *IfStatement {
 			break
 		} else if parser.peekTokenIs(lexer.IF) {
 			parser.nextToken()
+			ifToken := parser.currentToken
 			parser.nextToken()
-			condition, consequence := parser.parseConditionAndConsequence()
+			condition, consequence := parser.parseConditionAndConsequence(ifToken)
 			conditions = append(conditions, condition)
 			consequences = append(consequences, consequence)
 		} else {
@@ -423,10 +737,9 @@ func (parser *Parser) parserIfStatement() *IfStatement {
 	}
 }
 
-func (parser *Parser) parseConditionAndConsequence() (Expression, *StatementsBlock) {
-	expression := parser.parseExpression(LOWEST)
+func (parser *Parser) parseConditionAndConsequence(keyword *lexer.Token) (Expression, *StatementsBlock) {
+	expression := parser.parseCondition(keyword)
 	if expression == nil {
-		parser.reportError("Could not parse condition expression")
 		return nil, nil
 	}
 
@@ -442,6 +755,20 @@ func (parser *Parser) parseConditionAndConsequence() (Expression, *StatementsBlo
 	return expression, block
 }
 
+// Parses the condition of the if or loop statement starting at keyword. A brace right after
+// the keyword opens the block, not a map literal: the condition is missing.
+func (parser *Parser) parseCondition(keyword *lexer.Token) Expression {
+	if parser.currentTokenIs(lexer.LBRACE) {
+		parser.reportError(EXPECTED_EXPRESSION, keyword, "Missing condition after `%s`", keyword.Value)
+		return nil
+	}
+	condition := parser.parseExpression(LOWEST)
+	if condition == nil {
+		parser.reportError(EXPECTED_EXPRESSION, parser.currentToken, "Could not parse condition expression")
+	}
+	return condition
+}
+
 func (parser *Parser) parseStatementsBlock() *StatementsBlock {
 	startToken := parser.currentToken
 
@@ -449,13 +776,19 @@ func (parser *Parser) parseStatementsBlock() *StatementsBlock {
 
 	statements := []Statement{}
 
-	for {
-		if parser.currentTokenIs(lexer.RBRACE) || parser.currentTokenIs(lexer.EOF) {
+	for !parser.currentTokenIs(lexer.RBRACE) {
+		if parser.currentTokenIs(lexer.EOF) {
+			unclosed := diagnostic.NewError(UNCLOSED_BLOCK, parser.currentToken, "Expected %s, found %s", lexer.RBRACE, lexer.EOF)
+			parser.report(unclosed.WithNote(startToken, "Block opened here"))
 			break
 		}
 
 		statement := parser.parseStatement()
-		if statement != nil {
+		if parser.recovering {
+			if parser.synchronize() {
+				continue // Stopped on the brace closing this block
+			}
+		} else if statement != nil {
 			statements = append(statements, statement)
 		}
 		parser.nextToken()
@@ -471,9 +804,8 @@ func (parser *Parser) parseLoopStatement() *LoopStatement {
 	startToken := parser.currentToken
 	parser.nextToken()
 
-	condition := parser.parseExpression(LOWEST)
+	condition := parser.parseCondition(startToken)
 	if condition == nil {
-		parser.reportError("Could not parse condition expression")
 		return nil
 	}
 
@@ -524,27 +856,25 @@ func (parser *Parser) parseFunctionDeclarationStatement() *FunctionDeclarationSt
 	}
 
 	if !parser.peekTokenIs(lexer.COLON) {
-		parser.reportUnexpectedToken(parser.peekToken, lexer.LPAR)
+		parser.reportUnexpectedToken(parser.peekToken, lexer.COLON)
 	} else {
 		parser.nextToken()
 	}
 
 	var returnType *DataType
 	if !parser.peekTokenIsDataType() {
-		parser.reportUnexpectedToken(parser.peekToken, lexer.LPAR)
+		parser.reportUnexpectedToken(parser.peekToken, lexer.TYPES_KEYWORDS...)
 	} else {
 		parser.nextToken()
-		dataType, ok := DATA_TYPE_MAP[parser.currentToken.Type]
+		dataType, ok := parser.parseDataType()
 		if ok {
 			returnType = &dataType
-		} else {
-			parser.reportError("Invalid data type in function return type")
 		}
 	}
 
 	var body *StatementsBlock = nil
 	if !parser.peekTokenIs(lexer.LBRACE) {
-		parser.reportUnexpectedToken(parser.peekToken)
+		parser.reportUnexpectedToken(parser.peekToken, lexer.LBRACE)
 	} else {
 		parser.nextToken()
 		body = parser.parseStatementsBlock()
@@ -566,16 +896,26 @@ func (parser *Parser) parseFunctionArgs() (*[]*Identifier, *[]DataType) {
 
 	for !parser.currentTokenIs(lexer.RPAR) {
 		identifier := parser.parseIdentifier()
+		if identifier == nil {
+			return nil, nil
+		}
 
+		if !parser.peekTokenIs(lexer.COLON) {
+			parser.reportUnexpectedToken(parser.peekToken, lexer.COLON)
+			return nil, nil
+		}
 		parser.nextToken()
 
-		if identifier == nil || !parser.currentTokenIs(lexer.COLON) {
+		if !parser.peekToken.IsTypeKeyword() {
+			parser.reportUnexpectedToken(parser.peekToken, lexer.TYPES_KEYWORDS...)
 			return nil, nil
 		}
-
 		parser.nextToken()
 
-		dataType := DATA_TYPE_MAP[parser.currentToken.Type]
+		dataType, ok := parser.parseDataType()
+		if !ok {
+			return nil, nil
+		}
 
 		identifiers = append(identifiers, identifier)
 		dataTypes = append(dataTypes, dataType)
@@ -584,18 +924,24 @@ func (parser *Parser) parseFunctionArgs() (*[]*Identifier, *[]DataType) {
 
 		if parser.currentTokenIs(lexer.COMMA) {
 			parser.nextToken()
+		} else if !parser.currentTokenIs(lexer.RPAR) {
+			parser.reportUnexpectedToken(parser.currentToken, lexer.COMMA, lexer.RPAR)
+			return nil, nil
 		}
 	}
 
 	return &identifiers, &dataTypes
 }
 
-func (parser *Parser) parseExpressionStatement() *ExpressionStatement {
+func (parser *Parser) parseExpressionStatement() Statement {
 	startToken := parser.currentToken
 	expression := parser.parseExpression(LOWEST)
 	if expression == nil {
 		return nil
 	}
+	if target, ok := expression.(*IndexExpression); ok && parser.peekTokenIs(lexer.ASSIGN) {
+		return parser.parseIndexAssignmentStatement(startToken, target)
+	}
 	if parser.peekTokenIs(lexer.SEMICOLON) {
 		parser.nextToken()
 	}
@@ -605,12 +951,29 @@ func (parser *Parser) parseExpressionStatement() *ExpressionStatement {
 	}
 }
 
+// Index assignment statement: a[i] = value;, the current token ends the target
+func (parser *Parser) parseIndexAssignmentStatement(startToken *lexer.Token, target *IndexExpression) *IndexAssignmentStatement {
+	parser.nextToken()
+	parser.nextToken()
+
+	value := parser.parseExpression(LOWEST)
+
+	if !parser.peekTokenIs(lexer.SEMICOLON) {
+		parser.reportMissingSemicolon()
+	} else {
+		parser.nextToken()
+	}
+
+	return &IndexAssignmentStatement{
+		Token:  startToken,
+		Target: target,
+		Value:  value,
+	}
+}
+
 func (parser *Parser) parseCall(function Expression) *CallExpression {
 	expr := &CallExpression{Token: parser.currentToken, Function: function}
 	expr.Arguments = parser.parseCallArguments()
-	if parser.peekTokenIs(lexer.RPAR) {
-		parser.nextToken()
-	}
 	return expr
 }
 
@@ -618,23 +981,106 @@ func (parser *Parser) parseCallExpression(function Expression) Expression {
 	return parser.parseCall(function)
 }
 
+// Parses the arguments following a left parenthesis, up to the right parenthesis closing them
 func (parser *Parser) parseCallArguments() []Expression {
-	args := []Expression{}
-	if parser.peekTokenIs(lexer.RPAR) {
+	return parser.parseExpressionList(lexer.RPAR)
+}
+
+// Parses the expressions separated by commas following the current token, up to the end token
+func (parser *Parser) parseExpressionList(end lexer.TokenType) []Expression {
+	list := []Expression{}
+	if parser.peekTokenIs(end) {
 		parser.nextToken()
-		return args
+		return list
 	}
 	parser.nextToken()
-	args = append(args, parser.parseExpression(LOWEST))
+	list = append(list, parser.parseExpression(LOWEST))
 	for parser.peekTokenIs(lexer.COMMA) {
 		parser.nextToken()
 		parser.nextToken()
-		args = append(args, parser.parseExpression(LOWEST))
+		list = append(list, parser.parseExpression(LOWEST))
 	}
-	if !parser.peekTokenIs(lexer.RPAR) {
+	if !parser.peekTokenIs(end) {
+		parser.reportUnexpectedToken(parser.peekToken, lexer.COMMA, end)
 		return nil
 	}
-	return args
+	parser.nextToken()
+	return list
+}
+
+// Array literal expression: [1, 2, 3]
+func (parser *Parser) parseArrayLiteralExpression() Expression {
+	expression := &ArrayLiteralExpression{Token: parser.currentToken}
+	expression.Elements = parser.parseExpressionList(lexer.RBRACKET)
+	if expression.Elements == nil {
+		return nil
+	}
+	return expression
+}
+
+// Map literal expression: {key: value, ...}
+func (parser *Parser) parseMapLiteralExpression() Expression {
+	expression := &MapLiteralExpression{Token: parser.currentToken, Keys: []Expression{}, Values: []Expression{}}
+	if parser.peekTokenIs(lexer.RBRACE) {
+		parser.nextToken()
+		return expression
+	}
+	for {
+		parser.nextToken()
+		key := parser.parseExpression(LOWEST)
+		if !parser.peekTokenIs(lexer.COLON) {
+			parser.reportUnexpectedToken(parser.peekToken, lexer.COLON)
+			parser.skipMapLiteral()
+			return nil
+		}
+		parser.nextToken()
+		parser.nextToken()
+		expression.Keys = append(expression.Keys, key)
+		expression.Values = append(expression.Values, parser.parseExpression(LOWEST))
+
+		if !parser.peekTokenIs(lexer.COMMA) {
+			break
+		}
+		parser.nextToken()
+	}
+	if !parser.peekTokenIs(lexer.RBRACE) {
+		parser.reportUnexpectedToken(parser.peekToken, lexer.COMMA, lexer.RBRACE)
+		parser.skipMapLiteral()
+		return nil
+	}
+	parser.nextToken()
+	return expression
+}
+
+// Skips the rest of a map literal in error up to its closing brace, which synchronize would
+// take for the end of a block. Stops before a semicolon, literals cannot hold one.
+func (parser *Parser) skipMapLiteral() {
+	depth := 0
+	for !parser.peekTokenIs(lexer.EOF) && !parser.peekTokenIs(lexer.SEMICOLON) {
+		parser.nextToken()
+		switch parser.currentToken.Type {
+		case lexer.LBRACE:
+			depth++
+		case lexer.RBRACE:
+			if depth == 0 {
+				return
+			}
+			depth--
+		}
+	}
+}
+
+// Index expression: array[index] or map[key]
+func (parser *Parser) parseIndexExpression(left Expression) Expression {
+	expression := &IndexExpression{Token: parser.currentToken, Left: left}
+	parser.nextToken()
+	expression.Index = parser.parseExpression(LOWEST)
+	if !parser.peekTokenIs(lexer.RBRACKET) {
+		parser.reportUnexpectedToken(parser.peekToken, lexer.RBRACKET)
+		return nil
+	}
+	parser.nextToken()
+	return expression
 }
 
 func (parser *Parser) parseReturnStatement() *ReturnStatement {
@@ -644,12 +1090,12 @@ func (parser *Parser) parseReturnStatement() *ReturnStatement {
 
 	expression := parser.parseExpression(LOWEST)
 	if expression == nil {
-		parser.reportError(fmt.Sprintf("Could not parse expression for return statement %s", startToken.FormattedLocation()))
+		parser.reportError(EXPECTED_EXPRESSION, startToken, "Could not parse expression for return statement")
 		return nil
 	}
 
 	if !parser.peekTokenIs(lexer.SEMICOLON) {
-		parser.reportUnexpectedToken(parser.peekToken, lexer.SEMICOLON)
+		parser.reportMissingSemicolon()
 	} else {
 		parser.nextToken()
 	}
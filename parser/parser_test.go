@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -83,6 +84,35 @@ func TestParseAssignmentStatement(t *testing.T) {
 	}
 }
 
+func TestParseIdentifierExpressionStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"x;", "x"},
+		{"x + 1;", "(x + 1)"},
+		{"f(1) * 2;", "(f(1) * 2)"},
+	}
+
+	for _, tt := range tests {
+		parser := New(&tt.input)
+		program := parser.Parse()
+
+		if len(parser.Errors) > 0 {
+			t.Fatalf("parsing %q failed: %v", tt.input, parser.Errors)
+		}
+
+		stmt, ok := program.Statements[0].(*ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not *ExpressionStatement. got=%T", program.Statements[0])
+		}
+
+		if got := parenthesize(stmt.Expression); got != tt.expected {
+			t.Errorf("wrong expression for %q. expected=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
 func TestParseIfStatement(t *testing.T) {
 	input := `
 	if x > 5 {
@@ -295,4 +325,495 @@ func testUnsignedIntegerLiteral(t *testing.T, il Expression, value uint64) bool
 	}
 
 	return true
-}
\ No newline at end of file
+}
+func TestOperatorPrecedence(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"a || b && c;", "(a || (b && c))"},
+		{"a && b || c;", "((a && b) || c)"},
+		{"a | b ^ c & d;", "(a | (b ^ (c & d)))"},
+		{"a & b == c;", "(a & (b == c))"},
+		{"(a & b) == c;", "((a & b) == c)"},
+		{"a == b && c != d;", "((a == b) && (c != d))"},
+		{"a < b == c > d;", "((a < b) == (c > d))"},
+		{"a << b < c;", "((a << b) < c)"},
+		{"a + b << c - d;", "((a + b) << (c - d))"},
+		{"a * b + c;", "((a * b) + c)"},
+		{"~a & !b;", "((~a) & (!b))"},
+		{"a | b | c;", "((a | b) | c)"},
+		{"await a + await b;", "((await a) + (await b))"},
+		{"await spawn f(a, b);", "(await (spawn f(a, b)))"},
+		{"f(g(), h(a)) + b;", "(f(g(), h(a)) + b)"},
+		{"-a[0] + b[i * 2];", "((-a[0]) + b[(i * 2)])"},
+		{"f(a)[1][j];", "f(a)[1][j]"},
+		{"[a, b + c][0];", "[a, (b + c)][0]"},
+	}
+
+	for _, tt := range tests {
+		input := "var x = " + tt.input
+		parser := New(&input)
+		program := parser.Parse()
+		if len(parser.Errors) > 0 {
+			t.Fatalf("parsing %q failed: %v", input, parser.Errors)
+		}
+
+		stmt, ok := program.Statements[0].(*DeclarationStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not *DeclarationStatement. got=%T", program.Statements[0])
+		}
+
+		actual := parenthesize(stmt.Value)
+		if actual != tt.expected {
+			t.Errorf("wrong precedence for %q. expected=%s, got=%s", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func parenthesize(expression Expression) string {
+	switch node := expression.(type) {
+	case *InfixExpression:
+		return "(" + parenthesize(node.Left) + " " + node.Operator + " " + parenthesize(node.Right) + ")"
+	case *PrefixExpression:
+		return "(" + node.Operator + parenthesize(node.Right) + ")"
+	case *Identifier:
+		return node.Value
+	case *CallExpression:
+		args := make([]string, len(node.Arguments))
+		for i, arg := range node.Arguments {
+			args[i] = parenthesize(arg)
+		}
+		return parenthesize(node.Function) + "(" + strings.Join(args, ", ") + ")"
+	case *IndexExpression:
+		return parenthesize(node.Left) + "[" + parenthesize(node.Index) + "]"
+	case *ArrayLiteralExpression:
+		elements := make([]string, len(node.Elements))
+		for i, element := range node.Elements {
+			elements[i] = parenthesize(element)
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *SpawnExpression:
+		return "(spawn " + parenthesize(node.Call) + ")"
+	case *AwaitExpression:
+		return "(await " + parenthesize(node.Future) + ")"
+	}
+	return expression.GetToken().Value
+}
+
+func TestSpawnRequiresCall(t *testing.T) {
+	input := "var h = spawn f;"
+	parser := New(&input)
+	parser.Parse()
+
+	if len(parser.Errors) != 1 {
+		t.Fatalf("expected 1 error. got=%v", parser.Errors)
+	}
+	err := parser.Errors[0]
+	if err.Code != EXPECTED_CALL || err.Span.Start.Col != 15 {
+		t.Errorf("wrong error. expected=%s at column 15, got=%s at column %d (%s)", EXPECTED_CALL, err.Code, err.Span.Start.Col, err.Message)
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	input := `var a: int = 1
+var b = a +;
+fun f(x int): int {
+	return x;
+}
+if a > 0 {
+	var c = ;
+	a = 2;
+}
+var d = 3;
+loop true {
+	a = a + 1;`
+
+	parser := New(&input)
+	program := parser.Parse()
+
+	expected := []struct {
+		code string
+		row  int
+		col  int
+	}{
+		{UNEXPECTED_TOKEN, 1, 15},
+		{EXPECTED_EXPRESSION, 2, 12},
+		{UNEXPECTED_TOKEN, 3, 9},
+		{EXPECTED_EXPRESSION, 7, 10},
+		{UNCLOSED_BLOCK, 12, 12},
+	}
+
+	if len(parser.Errors) != len(expected) {
+		t.Fatalf("wrong number of errors. expected=%d, got=%v", len(expected), parser.Errors)
+	}
+	for i, tt := range expected {
+		err := parser.Errors[i]
+		if err.Code != tt.code || err.Span.Start.Row != tt.row || err.Span.Start.Col != tt.col {
+			t.Errorf("wrong error %d. expected=%s at %d:%d, got=%s at %d:%d (%s)", i, tt.code, tt.row, tt.col, err.Code, err.Span.Start.Row, err.Span.Start.Col, err.Message)
+		}
+	}
+
+	unclosed := parser.Errors[len(parser.Errors)-1]
+	if len(unclosed.Notes) != 1 || unclosed.Notes[0].Span == nil || unclosed.Notes[0].Span.Start.Row != 11 {
+		t.Errorf("unclosed block error does not point at the opening brace. got=%+v", unclosed.Notes)
+	}
+
+	// The statements in error are dropped, the others are kept
+	if len(program.Statements) != 2 {
+		t.Errorf("wrong number of statements. expected=2, got=%d", len(program.Statements))
+	}
+}
+
+// A brace after `if` or `loop` opens the block, the missing condition is reported at the keyword
+// rather than on the statement after the block
+func TestMissingCondition(t *testing.T) {
+	tests := []struct {
+		input string
+		row   int
+		col   int
+	}{
+		{"if { }\nprintln(x);", 1, 1},
+		{"loop {\n\tx = 1;\n}\nprintln(x);", 1, 1},
+		{"if x { } else if { }\nprintln(x);", 1, 15},
+		{"if {\"a\": true} { }", 1, 1},
+	}
+
+	for _, tt := range tests {
+		parser := New(&tt.input)
+		program := parser.Parse()
+		if len(parser.Errors) != 1 {
+			t.Fatalf("expected 1 error for %q. got=%v", tt.input, parser.Errors)
+		}
+		err := parser.Errors[0]
+		if err.Code != EXPECTED_EXPRESSION || !strings.HasPrefix(err.Message, "Missing condition after `") || err.Span.Start.Row != tt.row || err.Span.Start.Col != tt.col {
+			t.Errorf("wrong error for %q. got=%s at %d:%d (%s)", tt.input, err.Code, err.Span.Start.Row, err.Span.Start.Col, err.Message)
+		}
+		if strings.Contains(tt.input, "println") && len(program.Statements) != 1 {
+			t.Errorf("statement after the block not parsed for %q. got=%s", tt.input, program.StringRepr(0))
+		}
+	}
+}
+
+func TestParseChannels(t *testing.T) {
+	input := `var c: chan chan int = chan(2);
+send(c, chan());
+var v = recv(c);
+close(c);`
+
+	parser := New(&input)
+	program := parser.Parse()
+	if len(parser.Errors) > 0 {
+		t.Fatalf("parsing failed: %v", parser.Errors)
+	}
+	if len(program.Statements) != 4 {
+		t.Fatalf("program.Statements does not contain 4 statements. got=%d", len(program.Statements))
+	}
+
+	declaration := program.Statements[0].(*DeclarationStatement)
+	if declaration.Type != ChannelOf(ChannelOf(INT)) || declaration.Type.String() != "Channel of Channel of Integer" {
+		t.Errorf("wrong channel type. got=%s", declaration.Type)
+	}
+	channel, ok := declaration.Value.(*ChannelExpression)
+	if !ok || !testUnsignedIntegerLiteral(t, channel.Capacity, 2) {
+		t.Errorf("declaration.Value is not a channel of capacity 2. got=%T", declaration.Value)
+	}
+
+	send, ok := program.Statements[1].(*SendStatement)
+	if !ok {
+		t.Fatalf("program.Statements[1] is not *SendStatement. got=%T", program.Statements[1])
+	}
+	if _, ok := send.Value.(*ChannelExpression); !ok || send.Value.(*ChannelExpression).Capacity != nil {
+		t.Errorf("send.Value is not an unbuffered channel. got=%T", send.Value)
+	}
+
+	recv, ok := program.Statements[2].(*DeclarationStatement).Value.(*RecvExpression)
+	if !ok || recv.Channel.GetToken().Value != "c" {
+		t.Errorf("declaration does not receive from `c`")
+	}
+
+	if _, ok := program.Statements[3].(*CloseStatement); !ok {
+		t.Errorf("program.Statements[3] is not *CloseStatement. got=%T", program.Statements[3])
+	}
+}
+
+func TestChannelArgumentsCount(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"send(c);", "`send` expects 2 arguments, found 1"},
+		{"close();", "`close` expects 1 arguments, found 0"},
+		{"var v = recv(a, b);", "`recv` expects 1 arguments, found 2"},
+		{"var c = chan(1, 2);", "`chan` expects at most 1 argument, found 2"},
+	}
+
+	for _, tt := range tests {
+		parser := New(&tt.input)
+		parser.Parse()
+
+		if len(parser.Errors) != 1 {
+			t.Fatalf("expected 1 error for %q. got=%v", tt.input, parser.Errors)
+		}
+		err := parser.Errors[0]
+		if err.Code != INVALID_ARGUMENTS || err.Message != tt.expected {
+			t.Errorf("wrong error for %q. expected=%s %q, got=%s %q", tt.input, INVALID_ARGUMENTS, tt.expected, err.Code, err.Message)
+		}
+	}
+}
+
+func TestParseStrings(t *testing.T) {
+	input := `var s: string = "tab\there" + "!";`
+	parser := New(&input)
+	program := parser.Parse()
+	if len(parser.Errors) > 0 {
+		t.Fatalf("parsing failed: %v", parser.Errors)
+	}
+
+	declaration := program.Statements[0].(*DeclarationStatement)
+	if declaration.Type != STRING || declaration.Type.String() != "String" {
+		t.Errorf("wrong string type. got=%s", declaration.Type)
+	}
+	infix, ok := declaration.Value.(*InfixExpression)
+	if !ok {
+		t.Fatalf("declaration.Value is not *InfixExpression. got=%T", declaration.Value)
+	}
+	literal, ok := infix.Left.(*StringLiteralExpression)
+	if !ok || literal.Value != "tab\there" || literal.Token.Value != `"tab\there"` {
+		t.Errorf("wrong string literal. got=%+v", infix.Left)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+		col      int
+	}{
+		{`var s = "open;`, "Invalid string literal: unterminated string literal", 9},
+		{`var s = "\d";`, "Invalid string literal: unknown escape sequence `\\d`", 9},
+	}
+	for _, tt := range tests {
+		parser := New(&tt.input)
+		parser.Parse()
+		if len(parser.Errors) == 0 {
+			t.Fatalf("expected error for %q", tt.input)
+		}
+		err := parser.Errors[0]
+		if err.Code != INVALID_LITERAL || err.Message != tt.expected || err.Span.Start.Col != tt.col {
+			t.Errorf("wrong error for %q. got=%s at column %d (%s)", tt.input, err.Code, err.Span.Start.Col, err.Message)
+		}
+	}
+}
+
+func TestParseFloats(t *testing.T) {
+	input := `var f: float = 3.14 * 2.5e-3 + 1E2;`
+	parser := New(&input)
+	program := parser.Parse()
+	if len(parser.Errors) > 0 {
+		t.Fatalf("parsing failed: %v", parser.Errors)
+	}
+
+	declaration := program.Statements[0].(*DeclarationStatement)
+	if declaration.Type != FLOAT || declaration.Type.String() != "Float" {
+		t.Errorf("wrong float type. got=%s", declaration.Type)
+	}
+	sum := declaration.Value.(*InfixExpression)
+	product := sum.Left.(*InfixExpression)
+	values := []Expression{product.Left, product.Right, sum.Right}
+	for i, expected := range []float64{3.14, 0.0025, 100} {
+		literal, ok := values[i].(*FloatLiteralExpression)
+		if !ok || literal.Value != expected {
+			t.Errorf("wrong float literal %d. expected=%g, got=%+v", i, expected, values[i])
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+		col      int
+	}{
+		{"var f = 1.2.3;", "Malformed float literal `1.2.3`", 9},
+		{"var f = 2 * 1e;", "Malformed float literal `1e`", 13},
+		{"var f = 1e+;", "Malformed float literal `1e+`", 9},
+		{"var f = 1e400;", "Float literal `1e400` is out of range", 9},
+	}
+	for _, tt := range tests {
+		parser := New(&tt.input)
+		parser.Parse()
+		if len(parser.Errors) == 0 {
+			t.Fatalf("expected error for %q", tt.input)
+		}
+		err := parser.Errors[0]
+		if err.Code != INVALID_LITERAL || err.Message != tt.expected || err.Span.Start.Col != tt.col {
+			t.Errorf("wrong error for %q. got=%s at column %d (%s)", tt.input, err.Code, err.Span.Start.Col, err.Message)
+		}
+	}
+}
+
+func TestParseConversions(t *testing.T) {
+	input := "var a = int(x) + uint(1); float(a)[0]; bool(-a);"
+	parser := New(&input)
+	program := parser.Parse()
+	if len(parser.Errors) > 0 {
+		t.Fatalf("parsing failed: %v", parser.Errors)
+	}
+
+	sum := program.Statements[0].(*DeclarationStatement).Value.(*InfixExpression)
+	for i, conversion := range []Expression{sum.Left, sum.Right} {
+		node, ok := conversion.(*ConversionExpression)
+		if !ok {
+			t.Fatalf("operand %d is not *ConversionExpression. got=%T", i, conversion)
+		}
+		if node.Type != []DataType{INT, UINT}[i] {
+			t.Errorf("wrong conversion type %d. got=%s", i, node.Type)
+		}
+	}
+	index := program.Statements[1].(*ExpressionStatement).Expression.(*IndexExpression)
+	if conversion, ok := index.Left.(*ConversionExpression); !ok || conversion.Type != FLOAT {
+		t.Errorf("wrong indexed conversion. got=%+v", index.Left)
+	}
+	conversion := program.Statements[2].(*ExpressionStatement).Expression.(*ConversionExpression)
+	if _, ok := conversion.Value.(*PrefixExpression); !ok || conversion.Type != BOOL {
+		t.Errorf("wrong bool conversion. got=%+v", conversion)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var a = int 5;", "Expected Left Parenthesis, found Literal number"},
+		{"var a = uint(1, 2);", "`uint` expects 1 arguments, found 2"},
+		{"var a = bool();", "`bool` expects 1 arguments, found 0"},
+		{"var a = string(1);", "Expected expression, found String type keyword"},
+	}
+	for _, tt := range tests {
+		parser := New(&tt.input)
+		parser.Parse()
+		if len(parser.Errors) == 0 {
+			t.Fatalf("expected error for %q", tt.input)
+		}
+		if parser.Errors[0].Message != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, parser.Errors[0].Message)
+		}
+	}
+}
+
+func TestParseArrays(t *testing.T) {
+	input := `var a: [][]int = [[1], []]; a[0][0] = a[1][0];`
+	parser := New(&input)
+	program := parser.Parse()
+	if len(parser.Errors) > 0 {
+		t.Fatalf("parsing failed: %v", parser.Errors)
+	}
+	if len(program.Statements) != 2 {
+		t.Fatalf("wrong number of statements. got=%d", len(program.Statements))
+	}
+
+	declaration := program.Statements[0].(*DeclarationStatement)
+	if declaration.Type != ArrayOf(ArrayOf(INT)) || declaration.Type.String() != "Array of Array of Integer" {
+		t.Errorf("wrong array type. got=%s", declaration.Type)
+	}
+	literal, ok := declaration.Value.(*ArrayLiteralExpression)
+	if !ok || len(literal.Elements) != 2 {
+		t.Fatalf("declaration.Value is not an array of 2 elements. got=%T (%+v)", declaration.Value, declaration.Value)
+	}
+	if empty, ok := literal.Elements[1].(*ArrayLiteralExpression); !ok || len(empty.Elements) != 0 {
+		t.Errorf("wrong empty array literal. got=%+v", literal.Elements[1])
+	}
+
+	assignment, ok := program.Statements[1].(*IndexAssignmentStatement)
+	if !ok {
+		t.Fatalf("program.Statements[1] is not *IndexAssignmentStatement. got=%T", program.Statements[1])
+	}
+	if parenthesize(assignment.Target) != "a[0][0]" || parenthesize(assignment.Value) != "a[1][0]" {
+		t.Errorf("wrong index assignment. got=%s = %s", parenthesize(assignment.Target), parenthesize(assignment.Value))
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var a = [1, 2;", "Expected Comma or Right bracket, found Semicolon"},
+		{"a[1 = 2;", "Expected Right bracket, found Assign"},
+		{"var a: [int = 2;", "Expected Right bracket, found Integer type keyword"},
+		{"a[0] = 1", "Expected Semicolon, found End of file"},
+	}
+	for _, tt := range tests {
+		parser := New(&tt.input)
+		parser.Parse()
+		if len(parser.Errors) == 0 {
+			t.Fatalf("expected error for %q", tt.input)
+		}
+		if parser.Errors[0].Message != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, parser.Errors[0].Message)
+		}
+	}
+}
+
+func TestParseMaps(t *testing.T) {
+	input := `var m: map[string][]int = {"a": [1], "b" + "c": []}; m["d"] = {}["e"]; var e: map[bool]uint = {};`
+	parser := New(&input)
+	program := parser.Parse()
+	if len(parser.Errors) > 0 {
+		t.Fatalf("parsing failed: %v", parser.Errors)
+	}
+	if len(program.Statements) != 3 {
+		t.Fatalf("wrong number of statements. got=%d", len(program.Statements))
+	}
+
+	declaration := program.Statements[0].(*DeclarationStatement)
+	expectedType := MapOf(STRING, ArrayOf(INT))
+	if declaration.Type != expectedType || declaration.Type.String() != "Map of String to Array of Integer" {
+		t.Errorf("wrong map type. got=%s", declaration.Type)
+	}
+	if declaration.Type.Key() != STRING || declaration.Type.Element() != ArrayOf(INT) {
+		t.Errorf("wrong key or value type. got=%s and %s", declaration.Type.Key(), declaration.Type.Element())
+	}
+	literal, ok := declaration.Value.(*MapLiteralExpression)
+	if !ok || len(literal.Keys) != 2 || len(literal.Values) != 2 {
+		t.Fatalf("declaration.Value is not a map of 2 pairs. got=%T (%+v)", declaration.Value, declaration.Value)
+	}
+	if parenthesize(literal.Keys[1]) != `("b" + "c")` || parenthesize(literal.Values[0]) != "[1]" {
+		t.Errorf("wrong pairs. got=%s: %s", parenthesize(literal.Keys[1]), parenthesize(literal.Values[0]))
+	}
+
+	if _, ok := program.Statements[1].(*IndexAssignmentStatement); !ok {
+		t.Errorf("program.Statements[1] is not *IndexAssignmentStatement. got=%T", program.Statements[1])
+	}
+	empty := program.Statements[2].(*DeclarationStatement).Value.(*MapLiteralExpression)
+	if len(empty.Keys) != 0 {
+		t.Errorf("wrong empty map literal. got=%+v", empty)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`var m = {"a" 1};`, "Expected Colon, found Literal number"},
+		{`var m = {"a": 1,};`, "Expected expression, found Right brace"},
+		{`var m = {"a": 1;`, "Expected Comma or Right brace, found Semicolon"},
+		{"var m: map int = {};", "Expected Left bracket, found Integer type keyword"},
+		{"var m: map[int = {};", "Expected Right bracket, found Assign"},
+		{"var m: map[[]int]bool = {};", "Map keys must be integers, booleans or strings, found Array of Integer"},
+	}
+	for _, tt := range tests {
+		parser := New(&tt.input)
+		parser.Parse()
+		if len(parser.Errors) == 0 {
+			t.Fatalf("expected error for %q", tt.input)
+		}
+		if parser.Errors[0].Message != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, parser.Errors[0].Message)
+		}
+	}
+
+	// The brace closing a map literal in error does not close the enclosing block
+	input = "if true {\n\tvar m = {\"a\" 1, \"b\": 2};\n\tvar x = 2;\n}\nvar y = 3;"
+	parser = New(&input)
+	program = parser.Parse()
+	if len(parser.Errors) != 1 {
+		t.Fatalf("expected 1 error. got=%v", parser.Errors)
+	}
+	if len(program.Statements) != 2 || len(program.Statements[0].(*IfStatement).Consequences[0].Statements) != 1 {
+		t.Errorf("wrong statements after the error. got=%s", program.StringRepr(0))
+	}
+}
@@ -5,32 +5,42 @@ import (
 	"atlas/utils"
 	"fmt"
 	"strings"
+	"sync"
 )
 
-// Operator precedance
+// Operator precedance, from the loosest to the tightest
 const (
 	_ int = iota
 	LOWEST
-	BITWISE     // ~ &
+	LOGICAL_OR  // ||
+	LOGICAL_AND // &&
+	BITWISE_OR  // |
+	BITWISE_XOR // ^
+	BITWISE_AND // &
 	EQUALS      // ==
 	LESSGREATER // > or <
+	SHIFT       // << or >>
 	SUM         // +
 	PRODUCT     // *
-	PREFIX      // -X or !X
+	PREFIX      // -X or !X or ~X
 	CALL        // myFunction(X)
+	INDEX       // array[X] or map[X]
 )
 
 var PRECEDENCE_MAP = map[lexer.TokenType]int{
-	lexer.BIT_AND:     BITWISE,
-	lexer.BIT_OR:      BITWISE,
+	lexer.LOGICAL_OR:  LOGICAL_OR,
+	lexer.LOGICAL_AND: LOGICAL_AND,
+	lexer.BIT_OR:      BITWISE_OR,
+	lexer.BIT_XOR:     BITWISE_XOR,
+	lexer.BIT_AND:     BITWISE_AND,
 	lexer.EQ:          EQUALS,
 	lexer.NEQ:         EQUALS,
-	lexer.LOGICAL_AND: EQUALS,
-	lexer.LOGICAL_OR:  EQUALS,
 	lexer.LT:          LESSGREATER,
 	lexer.GT:          LESSGREATER,
 	lexer.LEQ:         LESSGREATER,
 	lexer.GEQ:         LESSGREATER,
+	lexer.SHIFT_LEFT:  SHIFT,
+	lexer.SHIFT_RIGHT: SHIFT,
 	lexer.PLUS:        SUM,
 	lexer.MINUS:       SUM,
 	lexer.MULTIPLY:    PRODUCT,
@@ -38,6 +48,7 @@ var PRECEDENCE_MAP = map[lexer.TokenType]int{
 	lexer.BANG:        PREFIX,
 	lexer.BIT_NOT:     PREFIX,
 	lexer.LPAR:        CALL,
+	lexer.LBRACKET:    INDEX,
 }
 
 type DataType int
@@ -46,22 +57,133 @@ const (
 	INFERED DataType = iota
 	INT
 	UINT
+	FLOAT
 	BOOL
+	STRING
+
+	basicTypesEnd // Composite types are numbered from here
 )
 
 func (dataType DataType) String() string {
+	if dataType >= basicTypesEnd {
+		composite := compositeTypeOf(dataType)
+		switch composite.kind {
+		case FUTURE:
+			return "Future of " + composite.element.String()
+		case CHANNEL:
+			if composite.element == INFERED {
+				return "Channel"
+			}
+			return "Channel of " + composite.element.String()
+		case ARRAY:
+			return "Array of " + composite.element.String()
+		case MAP:
+			return "Map of " + composite.key.String() + " to " + composite.element.String()
+		}
+	}
 	return [...]string{
 		"Infered",
 		"Integer",
 		"Unsigned integer",
+		"Float",
 		"Boolean",
+		"String",
 	}[dataType]
 }
 
+// Kinds of types, composite types are built from an element type
+type TypeKind int
+
+const (
+	BASIC TypeKind = iota
+	FUTURE
+	CHANNEL
+	ARRAY
+	MAP
+)
+
+type compositeType struct {
+	kind    TypeKind
+	element DataType
+	key     DataType // Type of the keys of maps, INFERED for other kinds
+}
+
+// Composite types are interned, so that data types stay comparable with ==
+var (
+	compositeTypesMutex sync.Mutex
+	compositeTypes      = []compositeType{}
+	compositeTypesIndex = map[compositeType]DataType{}
+)
+
+func internCompositeType(composite compositeType) DataType {
+	compositeTypesMutex.Lock()
+	defer compositeTypesMutex.Unlock()
+
+	dataType, ok := compositeTypesIndex[composite]
+	if !ok {
+		dataType = basicTypesEnd + DataType(len(compositeTypes))
+		compositeTypes = append(compositeTypes, composite)
+		compositeTypesIndex[composite] = dataType
+	}
+	return dataType
+}
+
+func compositeTypeOf(dataType DataType) compositeType {
+	compositeTypesMutex.Lock()
+	defer compositeTypesMutex.Unlock()
+	return compositeTypes[dataType-basicTypesEnd]
+}
+
+// Type of the future returned by spawning a function returning element
+func FutureOf(element DataType) DataType {
+	return internCompositeType(compositeType{kind: FUTURE, element: element})
+}
+
+// Type of the channels passing values of type element. Channels whose element type is not
+// known yet are ChannelOf(INFERED).
+func ChannelOf(element DataType) DataType {
+	return internCompositeType(compositeType{kind: CHANNEL, element: element})
+}
+
+// Type of the arrays holding values of type element: []element
+func ArrayOf(element DataType) DataType {
+	return internCompositeType(compositeType{kind: ARRAY, element: element})
+}
+
+// Type of the maps associating values of type element to keys of type key: map[key]element
+func MapOf(key DataType, element DataType) DataType {
+	return internCompositeType(compositeType{kind: MAP, element: element, key: key})
+}
+
+func (dataType DataType) Kind() TypeKind {
+	if dataType < basicTypesEnd {
+		return BASIC
+	}
+	return compositeTypeOf(dataType).kind
+}
+
+// Type of the elements of a composite type, the values for maps, INFERED for basic types
+func (dataType DataType) Element() DataType {
+	if dataType < basicTypesEnd {
+		return INFERED
+	}
+	return compositeTypeOf(dataType).element
+}
+
+// Type of the keys of a map type, INFERED for other types
+func (dataType DataType) Key() DataType {
+	if dataType < basicTypesEnd {
+		return INFERED
+	}
+	return compositeTypeOf(dataType).key
+}
+
 var DATA_TYPE_MAP = map[lexer.TokenType]DataType{
-	lexer.TYPE_INT:  INT,
-	lexer.TYPE_UINT: UINT,
-	lexer.TYPE_BOOL: BOOL,
+	lexer.TYPE_INT:    INT,
+	lexer.TYPE_UINT:   UINT,
+	lexer.TYPE_FLOAT:  FLOAT,
+	lexer.TYPE_BOOL:   BOOL,
+	lexer.TYPE_STRING: STRING,
 }
 
 type Node interface {
@@ -205,6 +327,35 @@ func (assign *AssignmentStatement) StringRepr(level int) string {
 	)
 }
 
+// Index assignment statement: a[i] = 9 or m[key] = 9
+
+type IndexAssignmentStatement struct {
+	Token  *lexer.Token
+	Target *IndexExpression
+	Value  Expression
+}
+
+func (assign *IndexAssignmentStatement) statementNode() {}
+
+func (assign *IndexAssignmentStatement) GetToken() *lexer.Token {
+	return assign.Token
+}
+
+func (assign *IndexAssignmentStatement) StringRepr(level int) string {
+	if assign == nil {
+		return ""
+	}
+	valueRepr := ""
+	if assign.Value != nil {
+		valueRepr = assign.Value.StringRepr(level + 1)
+	}
+
+	return utils.IndentStringByLevel(
+		level,
+		fmt.Sprintf("IndexAssignmentStatement\nTarget:\n%s\nValue:\n%s", assign.Target.StringRepr(level+1), valueRepr),
+	)
+}
+
 // If statement: if () {} else {};
 
 type IfStatement struct {
@@ -302,6 +453,7 @@ func (iden *Identifier) StringRepr(level int) string {
 type UnsignedIntegerLiteralExpression struct {
 	Token *lexer.Token
 	Value uint64
+	Type  DataType // Set by the checker to INT or FLOAT for the literals used as such
 }
 
 func (liter *UnsignedIntegerLiteralExpression) expressionNode() {}
@@ -320,6 +472,112 @@ func (liter *UnsignedIntegerLiteralExpression) StringRepr(level int) string {
 	)
 }
 
+// Float literal expression: 3.14, 2.5e-3
+
+type FloatLiteralExpression struct {
+	Token *lexer.Token
+	Value float64
+}
+
+func (liter *FloatLiteralExpression) expressionNode() {}
+
+func (liter *FloatLiteralExpression) GetToken() *lexer.Token {
+	return liter.Token
+}
+
+func (liter *FloatLiteralExpression) StringRepr(level int) string {
+	if liter == nil {
+		return ""
+	}
+	return utils.IndentStringByLevel(
+		level,
+		fmt.Sprintf("FloatLiteral: %g", liter.Value),
+	)
+}
+
+// String literal expression: "hello\n", Value holds the string without its escape sequences
+
+type StringLiteralExpression struct {
+	Token *lexer.Token
+	Value string
+}
+
+func (str *StringLiteralExpression) expressionNode() {}
+
+func (str *StringLiteralExpression) GetToken() *lexer.Token {
+	return str.Token
+}
+
+func (str *StringLiteralExpression) StringRepr(level int) string {
+	if str == nil {
+		return ""
+	}
+	return utils.IndentStringByLevel(
+		level,
+		fmt.Sprintf("StringLiteral: %q", str.Value),
+	)
+}
+
+// Array literal expression: [1, 2, 3]
+
+type ArrayLiteralExpression struct {
+	Token    *lexer.Token
+	Elements []Expression
+}
+
+func (array *ArrayLiteralExpression) expressionNode() {}
+
+func (array *ArrayLiteralExpression) GetToken() *lexer.Token {
+	return array.Token
+}
+
+func (array *ArrayLiteralExpression) StringRepr(level int) string {
+	if array == nil {
+		return ""
+	}
+
+	var elementsBuilder strings.Builder
+	for _, element := range array.Elements {
+		elementsBuilder.WriteString(element.StringRepr(level + 1))
+		elementsBuilder.WriteRune('\n')
+	}
+
+	return utils.IndentStringByLevel(
+		level,
+		fmt.Sprintf("ArrayLiteral:\nElements:\n%s", elementsBuilder.String()),
+	)
+}
+
+// Map literal expression: {"a": 1, "b": 2}, Keys and Values in the order they are written
+
+type MapLiteralExpression struct {
+	Token  *lexer.Token
+	Keys   []Expression
+	Values []Expression
+}
+
+func (mapLiteral *MapLiteralExpression) expressionNode() {}
+
+func (mapLiteral *MapLiteralExpression) GetToken() *lexer.Token {
+	return mapLiteral.Token
+}
+
+func (mapLiteral *MapLiteralExpression) StringRepr(level int) string {
+	if mapLiteral == nil {
+		return ""
+	}
+
+	var pairsBuilder strings.Builder
+	for i, key := range mapLiteral.Keys {
+		pairsBuilder.WriteString(fmt.Sprintf("Key:\n%s\nValue:\n%s\n", key.StringRepr(level+1), mapLiteral.Values[i].StringRepr(level+1)))
+	}
+
+	return utils.IndentStringByLevel(
+		level,
+		fmt.Sprintf("MapLiteral:\n%s", pairsBuilder.String()),
+	)
+}
+
 // Boolean literal expression: false
 
 type BooleanLiteralExpression struct {
@@ -392,6 +650,30 @@ func (infixExp *InfixExpression) StringRepr(level int) string {
 	)
 }
 
+// Index expression: array[i] or map[key]
+
+type IndexExpression struct {
+	Token *lexer.Token
+	Left  Expression
+	Index Expression
+}
+
+func (index *IndexExpression) expressionNode() {}
+
+func (index *IndexExpression) GetToken() *lexer.Token {
+	return index.Token
+}
+
+func (index *IndexExpression) StringRepr(level int) string {
+	if index == nil {
+		return ""
+	}
+	return utils.IndentStringByLevel(
+		level,
+		fmt.Sprintf("IndexExpression\nLeft:\n%s\nIndex:\n%s", index.Left.StringRepr(level+1), index.Index.StringRepr(level+1)),
+	)
+}
+
 // Loop expression: loop a > 10 {...}
 
 type LoopStatement struct {
@@ -503,6 +785,174 @@ func (ce *CallExpression) StringRepr(level int) string {
 	)
 }
 
+// Spawn expression: spawn hello(x)
+
+type SpawnExpression struct {
+	Token *lexer.Token
+	Call  *CallExpression
+}
+
+func (spawn *SpawnExpression) expressionNode() {}
+
+func (spawn *SpawnExpression) GetToken() *lexer.Token {
+	return spawn.Token
+}
+
+func (spawn *SpawnExpression) StringRepr(level int) string {
+	if spawn == nil {
+		return ""
+	}
+	return utils.IndentStringByLevel(
+		level,
+		fmt.Sprintf("SpawnExpression:\n%s", spawn.Call.StringRepr(level+1)),
+	)
+}
+
+// Await expression: await future
+
+type AwaitExpression struct {
+	Token  *lexer.Token
+	Future Expression
+}
+
+func (await *AwaitExpression) expressionNode() {}
+
+func (await *AwaitExpression) GetToken() *lexer.Token {
+	return await.Token
+}
+
+func (await *AwaitExpression) StringRepr(level int) string {
+	if await == nil {
+		return ""
+	}
+	return utils.IndentStringByLevel(
+		level,
+		fmt.Sprintf("AwaitExpression:\n%s", await.Future.StringRepr(level+1)),
+	)
+}
+
+// Channel expression: chan() or chan(10)
+
+type ChannelExpression struct {
+	Token    *lexer.Token
+	Capacity Expression // Nil for a channel without capacity
+}
+
+func (channel *ChannelExpression) expressionNode() {}
+
+func (channel *ChannelExpression) GetToken() *lexer.Token {
+	return channel.Token
+}
+
+func (channel *ChannelExpression) StringRepr(level int) string {
+	if channel == nil {
+		return ""
+	}
+	capacity := ""
+	if channel.Capacity != nil {
+		capacity = channel.Capacity.StringRepr(level + 1)
+	}
+	return utils.IndentStringByLevel(
+		level,
+		fmt.Sprintf("ChannelExpression:\nCapacity:\n%s", capacity),
+	)
+}
+
+// Conversion expression: int(value), converting value to the basic type of the keyword
+
+type ConversionExpression struct {
+	Token *lexer.Token
+	Type  DataType
+	Value Expression
+}
+
+func (conversion *ConversionExpression) expressionNode() {}
+
+func (conversion *ConversionExpression) GetToken() *lexer.Token {
+	return conversion.Token
+}
+
+func (conversion *ConversionExpression) StringRepr(level int) string {
+	if conversion == nil {
+		return ""
+	}
+	return utils.IndentStringByLevel(
+		level,
+		fmt.Sprintf("ConversionExpression: %s\n%s", conversion.Type, conversion.Value.StringRepr(level+1)),
+	)
+}
+
+// Receive expression: recv(channel)
+
+type RecvExpression struct {
+	Token       *lexer.Token
+	Channel     Expression
+	ElementType DataType // Set by the checker, gives the value received from a closed channel
+}
+
+func (recv *RecvExpression) expressionNode() {}
+
+func (recv *RecvExpression) GetToken() *lexer.Token {
+	return recv.Token
+}
+
+func (recv *RecvExpression) StringRepr(level int) string {
+	if recv == nil {
+		return ""
+	}
+	return utils.IndentStringByLevel(
+		level,
+		fmt.Sprintf("RecvExpression:\n%s", recv.Channel.StringRepr(level+1)),
+	)
+}
+
+// Send statement: send(channel, value);
+
+type SendStatement struct {
+	Token   *lexer.Token
+	Channel Expression
+	Value   Expression
+}
+
+func (send *SendStatement) statementNode() {}
+
+func (send *SendStatement) GetToken() *lexer.Token {
+	return send.Token
+}
+
+func (send *SendStatement) StringRepr(level int) string {
+	if send == nil {
+		return ""
+	}
+	return utils.IndentStringByLevel(
+		level,
+		fmt.Sprintf("SendStatement:\nChannel:\n%s\nValue:\n%s", send.Channel.StringRepr(level+1), send.Value.StringRepr(level+1)),
+	)
+}
+
+// Close statement: close(channel);
+
+type CloseStatement struct {
+	Token   *lexer.Token
+	Channel Expression
+}
+
+func (close *CloseStatement) statementNode() {}
+
+func (close *CloseStatement) GetToken() *lexer.Token {
+	return close.Token
+}
+
+func (close *CloseStatement) StringRepr(level int) string {
+	if close == nil {
+		return ""
+	}
+	return utils.IndentStringByLevel(
+		level,
+		fmt.Sprintf("CloseStatement:\n%s", close.Channel.StringRepr(level+1)),
+	)
+}
+
 // Return statement
 
 type ReturnStatement struct {
@@ -0,0 +1,287 @@
+package remote
+
+import (
+	"atlas/compiler"
+	"atlas/vm"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Runs the calls spawned by programs on the worker or coordinator at Address, over a
+// connection of their own
+type Executor struct {
+	Address string
+}
+
+func (executor *Executor) Spawn(call *vm.Call) *compiler.Future {
+	future := compiler.NewFuture(call.Function.Name)
+	go func() {
+		future.Resolve(executor.run(call))
+	}()
+	return future
+}
+
+func (executor *Executor) run(call *vm.Call) (compiler.Object, error) {
+	client, err := Dial(executor.Address)
+	if err != nil {
+		return nil, fmt.Errorf("could not reach %s: %w", executor.Address, err)
+	}
+	defer client.Close()
+
+	return client.Call(call)
+}
+
+// Encodes a call as a MSG_CALL payload. The channels it refers to are returned in the order
+// of their ids, to serve the requests of the worker.
+func encodeCall(call *vm.Call) ([]byte, []*compiler.Channel, error) {
+	byteCode := compiler.ByteCode{Constants: call.Constants}
+	if call.Debug != nil {
+		// Lines of the main function are not used by the call
+		debug := *call.Debug
+		debug.Lines = nil
+		byteCode.Debug = &debug
+	}
+	program, err := byteCode.MarshalBinary()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	enc := callEncoder{constants: call.Constants}
+	payload := binary.BigEndian.AppendUint32(nil, uint32(len(program)))
+	payload = append(payload, program...)
+
+	payload, err = enc.value(payload, call.Function)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload = binary.BigEndian.AppendUint32(payload, uint32(len(call.Args)))
+	for _, arg := range call.Args {
+		payload, err = enc.value(payload, arg)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	globalsCount := 0
+	for _, global := range call.Globals {
+		if isSent(global) {
+			globalsCount++
+		}
+	}
+	payload = binary.BigEndian.AppendUint32(payload, uint32(globalsCount))
+	for index, global := range call.Globals {
+		if !isSent(global) {
+			continue
+		}
+		payload = binary.BigEndian.AppendUint32(payload, uint32(index))
+		payload, err = enc.value(payload, global)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return payload, enc.channels, nil
+}
+
+// Futures are tied to the node that spawned them, globals holding one are left unset on the worker
+func isSent(global compiler.Object) bool {
+	return global != nil && global.Type() != compiler.FUTURE
+}
+
+type callEncoder struct {
+	constants []compiler.Object
+	channels  []*compiler.Channel
+}
+
+// Functions are sent as the constant they are and channels as an id, the same for every
+// occurrence of a channel
+func (enc *callEncoder) value(payload []byte, value compiler.Object) ([]byte, error) {
+	switch value := value.(type) {
+	case *compiler.CompiledFunction:
+		for index, constant := range enc.constants {
+			if constant == value {
+				payload = append(payload, VALUE_CONSTANT)
+				return binary.BigEndian.AppendUint32(payload, uint32(index)), nil
+			}
+		}
+	case *compiler.Channel:
+		id := len(enc.channels)
+		for index, channel := range enc.channels {
+			if channel == value {
+				id = index
+			}
+		}
+		if id == len(enc.channels) {
+			enc.channels = append(enc.channels, value)
+		}
+		payload = append(payload, VALUE_CHANNEL)
+		return binary.BigEndian.AppendUint32(payload, uint32(id)), nil
+	}
+	return compiler.AppendObject(append(payload, VALUE_OBJECT), value)
+}
+
+// Reads the fields of a MSG_CALL payload in order. The first failure is kept in err.
+type callDecoder struct {
+	payload   []byte
+	constants []compiler.Object
+	session   *channelSession
+	proxies   map[uint32]*compiler.Channel // Channels of the client already read, by id
+	err       error
+}
+
+func (dec *callDecoder) read(length int) []byte {
+	if dec.err != nil {
+		return nil
+	}
+	if length < 0 || length > len(dec.payload) {
+		dec.err = fmt.Errorf("truncated call message")
+		return nil
+	}
+	value := dec.payload[:length]
+	dec.payload = dec.payload[length:]
+	return value
+}
+
+func (dec *callDecoder) uint32() int {
+	value := dec.read(4)
+	if value == nil {
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(value))
+}
+
+func (dec *callDecoder) value() compiler.Object {
+	kind := dec.read(1)
+	if kind == nil {
+		return nil
+	}
+
+	switch kind[0] {
+	case VALUE_CONSTANT:
+		index := dec.uint32()
+		if dec.err == nil && index >= len(dec.constants) {
+			dec.err = fmt.Errorf("call refers to unknown constant %d", index)
+		}
+		if dec.err != nil {
+			return nil
+		}
+		return dec.constants[index]
+	case VALUE_CHANNEL:
+		id := uint32(dec.uint32())
+		if dec.err != nil {
+			return nil
+		}
+		channel, ok := dec.proxies[id]
+		if !ok {
+			channel = compiler.NewProxyChannel(&channelProxy{session: dec.session, id: id})
+			dec.proxies[id] = channel
+		}
+		return channel
+	case VALUE_OBJECT:
+		object, read, err := compiler.ReadObject(dec.payload)
+		if err != nil {
+			dec.err = err
+			return nil
+		}
+		dec.payload = dec.payload[read:]
+		return object
+	}
+	dec.err = fmt.Errorf("unknown value kind %d", kind[0])
+	return nil
+}
+
+// Decodes a MSG_CALL payload. The channels of the client it refers to are used through session.
+func decodeCall(payload []byte, session *channelSession) (*vm.Call, error) {
+	dec := callDecoder{payload: payload, session: session, proxies: make(map[uint32]*compiler.Channel)}
+
+	var byteCode compiler.ByteCode
+	program := dec.read(dec.uint32())
+	if dec.err != nil {
+		return nil, dec.err
+	}
+	err := byteCode.UnmarshalBinary(program)
+	if err != nil {
+		return nil, fmt.Errorf("could not load bytecode: %w", err)
+	}
+	dec.constants = byteCode.Constants
+
+	call := &vm.Call{Constants: byteCode.Constants, Debug: byteCode.Debug}
+	callee := dec.value()
+	function, ok := callee.(*compiler.CompiledFunction)
+	if dec.err == nil && !ok {
+		return nil, fmt.Errorf("cannot call a value of type `%s`", callee.Type())
+	}
+	call.Function = function
+
+	argsCount := dec.uint32()
+	for i := 0; i < argsCount && dec.err == nil; i++ {
+		call.Args = append(call.Args, dec.value())
+	}
+
+	globalsCount := dec.uint32()
+	for i := 0; i < globalsCount && dec.err == nil; i++ {
+		index := dec.uint32()
+		value := dec.value()
+		if dec.err == nil && index >= vm.GLOBALS_SIZE {
+			dec.err = fmt.Errorf("global index %d is out of range", index)
+		}
+		if dec.err != nil {
+			break
+		}
+		for len(call.Globals) <= index {
+			call.Globals = append(call.Globals, nil)
+		}
+		call.Globals[index] = value
+	}
+
+	if dec.err != nil {
+		return nil, dec.err
+	}
+	return call, nil
+}
+
+// Runs a call received by a worker. A panic caused by malformed bytecode fails the call only.
+// Like jobs, calls have no input.
+func runCall(payload []byte, output io.Writer, session *channelSession, options ...vm.Option) (value compiler.Object, err error) {
+	call, err := decodeCall(payload, session)
+	if err != nil {
+		return nil, err
+	}
+	call.Input = strings.NewReader("")
+	call.Output = output
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("call crashed: %v", recovered)
+		}
+	}()
+
+	return call.Run(options...)
+}
+
+// Answer to a call, with its value or the error it failed with
+func callResultFrame(value compiler.Object, err error) Frame {
+	if err == nil {
+		var payload []byte
+		payload, err = compiler.AppendObject([]byte{STATUS_OK}, value)
+		if err == nil {
+			return Frame{Type: MSG_RESULT, Payload: payload}
+		}
+	}
+	return resultFrame(err)
+}
+
+// Decodes the MSG_RESULT payload of a call, returning the value of the function or the error it carries
+func readValue(payload []byte) (compiler.Object, error) {
+	err := readResult(payload)
+	if err != nil {
+		return nil, err
+	}
+	value, _, err := compiler.ReadObject(payload[1:])
+	if err != nil {
+		return nil, fmt.Errorf("could not read the value of the call: %w", err)
+	}
+	return value, nil
+}
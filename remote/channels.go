@@ -0,0 +1,217 @@
+package remote
+
+import (
+	"atlas/compiler"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var errCallEnded = errors.New("the call using the channel ended")
+
+// Channels of the client, as seen by the calls received on a worker connection. Operations
+// are sent to the client and complete when it replies.
+type channelSession struct {
+	conn io.Writer
+
+	mutex       sync.Mutex
+	nextRequest uint32
+	pending     map[uint32]*compiler.ChannelOp
+	err         error // Set once the connection is lost, failing every operation
+}
+
+func newChannelSession(conn io.Writer) *channelSession {
+	return &channelSession{conn: conn, pending: make(map[uint32]*compiler.ChannelOp)}
+}
+
+func (session *channelSession) request(operation byte, channel uint32, value compiler.Object) *compiler.ChannelOp {
+	op := compiler.NewChannelOp()
+
+	session.mutex.Lock()
+	if session.err != nil {
+		session.mutex.Unlock()
+		op.Complete(nil, false, session.err)
+		return op
+	}
+	id := session.nextRequest
+	session.nextRequest++
+	session.pending[id] = op
+	session.mutex.Unlock()
+
+	payload := binary.BigEndian.AppendUint32(nil, id)
+	payload = append(payload, operation)
+	payload = binary.BigEndian.AppendUint32(payload, channel)
+
+	var err error
+	if operation == CHANNEL_SEND {
+		payload, err = compiler.AppendObject(payload, value)
+	}
+	if err == nil {
+		err = WriteFrame(session.conn, Frame{Type: MSG_CHANNEL, Payload: payload})
+	}
+	if err != nil {
+		session.settle(id, nil, false, err)
+	}
+	return op
+}
+
+func (session *channelSession) settle(id uint32, value compiler.Object, received bool, err error) {
+	session.mutex.Lock()
+	op, ok := session.pending[id]
+	delete(session.pending, id)
+	session.mutex.Unlock()
+
+	if ok {
+		op.Complete(value, received, err)
+	}
+}
+
+// Completes the operation a MSG_CHANNEL_REPLY answers
+func (session *channelSession) reply(payload []byte) error {
+	if len(payload) < 5 {
+		return fmt.Errorf("truncated channel reply")
+	}
+	id := binary.BigEndian.Uint32(payload)
+
+	err := readResult(payload[4:])
+	if err != nil {
+		var remoteError *RemoteError
+		if !errors.As(err, &remoteError) {
+			return err
+		}
+		session.settle(id, nil, false, err)
+		return nil
+	}
+
+	if len(payload) < 6 {
+		return fmt.Errorf("truncated channel reply")
+	}
+	if payload[5] == 0 {
+		session.settle(id, nil, false, nil)
+		return nil
+	}
+	value, _, err := compiler.ReadObject(payload[6:])
+	if err != nil {
+		return err
+	}
+	session.settle(id, value, true, nil)
+	return nil
+}
+
+// Fails the operations waiting for a reply and the following ones
+func (session *channelSession) fail(err error) {
+	session.mutex.Lock()
+	session.err = err
+	pending := session.pending
+	session.pending = make(map[uint32]*compiler.ChannelOp)
+	session.mutex.Unlock()
+
+	for _, op := range pending {
+		op.Complete(nil, false, err)
+	}
+}
+
+// Channel of the client used by a call running on the worker
+type channelProxy struct {
+	session *channelSession
+	id      uint32
+}
+
+func (proxy *channelProxy) Send(value compiler.Object) *compiler.ChannelOp {
+	return proxy.session.request(CHANNEL_SEND, proxy.id, value)
+}
+
+func (proxy *channelProxy) Recv() *compiler.ChannelOp {
+	return proxy.session.request(CHANNEL_RECV, proxy.id, nil)
+}
+
+func (proxy *channelProxy) Close() *compiler.ChannelOp {
+	return proxy.session.request(CHANNEL_CLOSE, proxy.id, nil)
+}
+
+// Runs the channel operations requested by a call on the channels the client sent with it
+type channelServer struct {
+	conn     io.Writer
+	channels []*compiler.Channel // Indexed by the ids given to the call
+
+	mutex    sync.Mutex
+	inFlight map[*compiler.ChannelOp]*compiler.Channel
+}
+
+func newChannelServer(conn io.Writer, channels []*compiler.Channel) *channelServer {
+	return &channelServer{conn: conn, channels: channels, inFlight: make(map[*compiler.ChannelOp]*compiler.Channel)}
+}
+
+// Starts the operation of a MSG_CHANNEL. It is answered once complete, without waiting here.
+func (server *channelServer) serve(payload []byte) error {
+	if len(payload) < 9 {
+		return fmt.Errorf("truncated channel request")
+	}
+	id := binary.BigEndian.Uint32(payload)
+	operation := payload[4]
+	channelID := binary.BigEndian.Uint32(payload[5:])
+
+	if int(channelID) >= len(server.channels) {
+		return WriteFrame(server.conn, channelReplyFrame(id, nil, false, fmt.Errorf("unknown channel %d", channelID)))
+	}
+	channel := server.channels[channelID]
+
+	var op *compiler.ChannelOp
+	switch operation {
+	case CHANNEL_SEND:
+		value, _, err := compiler.ReadObject(payload[9:])
+		if err != nil {
+			return err
+		}
+		op = channel.Send(value)
+	case CHANNEL_RECV:
+		op = channel.Recv()
+	case CHANNEL_CLOSE:
+		op = channel.Close()
+	default:
+		return fmt.Errorf("unknown channel operation %d", operation)
+	}
+
+	server.mutex.Lock()
+	server.inFlight[op] = channel
+	server.mutex.Unlock()
+
+	go func() {
+		value, received, err := op.Wait()
+
+		server.mutex.Lock()
+		delete(server.inFlight, op)
+		server.mutex.Unlock()
+
+		WriteFrame(server.conn, channelReplyFrame(id, value, received, err))
+	}()
+	return nil
+}
+
+// Withdraws the operations still waiting once the call ended, so that they do not take
+// values meant for other tasks
+func (server *channelServer) cancel() {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	for op, channel := range server.inFlight {
+		channel.Cancel(op, errCallEnded)
+	}
+}
+
+func channelReplyFrame(id uint32, value compiler.Object, received bool, err error) Frame {
+	payload := binary.BigEndian.AppendUint32(nil, id)
+	if err == nil && received {
+		var encoded []byte
+		encoded, err = compiler.AppendObject(append(payload, STATUS_OK, 1), value)
+		if err == nil {
+			return Frame{Type: MSG_CHANNEL_REPLY, Payload: encoded}
+		}
+	}
+	if err != nil {
+		return Frame{Type: MSG_CHANNEL_REPLY, Payload: append(payload, resultFrame(err).Payload...)}
+	}
+	return Frame{Type: MSG_CHANNEL_REPLY, Payload: append(payload, STATUS_OK, 0)}
+}
@@ -0,0 +1,151 @@
+package remote
+
+import (
+	"atlas/compiler"
+	"atlas/vm"
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+)
+
+// Connection to a node running jobs
+type Client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+
+	OnStatus func(status JobStatus) // Called with the progress reported by a coordinator, if set
+}
+
+// Connects to the node at address and checks that it speaks the same protocol version
+func Dial(address string) (*Client, error) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &Client{conn: conn, reader: bufio.NewReader(conn)}
+	err = client.hello()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+func (client *Client) hello() error {
+	err := WriteFrame(client.conn, helloFrame())
+	if err != nil {
+		return err
+	}
+
+	frame, err := ReadFrame(client.reader)
+	if err != nil {
+		return err
+	}
+	if frame.Type == MSG_RESULT {
+		return readResult(frame.Payload)
+	}
+
+	version, err := readHello(frame)
+	if err != nil {
+		return err
+	}
+	if version != PROTOCOL_VERSION {
+		return fmt.Errorf("node speaks protocol version %d, expected %d", version, PROTOCOL_VERSION)
+	}
+	return nil
+}
+
+// Runs byteCode on the node and copies what it prints to output. A failure of the program
+// is returned as a *RemoteError.
+func (client *Client) Execute(byteCode compiler.ByteCode, output io.Writer) error {
+	data, err := byteCode.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return client.executeEncoded(data, output)
+}
+
+// Runs a function call on the node and returns its value. What the function prints is
+// copied to the output of the call, if any. The channels passed to the call stay here, the
+// node operates on them through the connection until the call returns.
+func (client *Client) Call(call *vm.Call) (compiler.Object, error) {
+	payload, channels, err := encodeCall(call)
+	if err != nil {
+		return nil, err
+	}
+
+	output := call.Output
+	if output == nil {
+		output = io.Discard
+	}
+	server := newChannelServer(client.conn, channels)
+	defer server.cancel()
+
+	onChannel := func(frame Frame) error {
+		return server.serve(frame.Payload)
+	}
+	result, err := client.run(Frame{Type: MSG_CALL, Payload: payload}, output, onChannel)
+	if err != nil {
+		return nil, err
+	}
+	return readValue(result)
+}
+
+// Runs bytecode already in the file format, as received by a coordinator
+func (client *Client) executeEncoded(data []byte, output io.Writer) error {
+	result, err := client.run(Frame{Type: MSG_JOB, Payload: data}, output, nil)
+	if err != nil {
+		return err
+	}
+	return readResult(result)
+}
+
+// Sends a job or a call and copies its output until the node answers, returning the
+// payload of the MSG_RESULT. Channel requests of the node are passed to onChannel, if set.
+func (client *Client) run(request Frame, output io.Writer, onChannel func(frame Frame) error) ([]byte, error) {
+	err := WriteFrame(client.conn, request)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		frame, err := ReadFrame(client.reader)
+		if err != nil {
+			return nil, fmt.Errorf("connection lost while running the job: %w", err)
+		}
+
+		switch frame.Type {
+		case MSG_OUTPUT:
+			_, err = output.Write(frame.Payload)
+			if err != nil {
+				return nil, err
+			}
+		case MSG_STATUS:
+			status, err := readStatus(frame.Payload)
+			if err != nil {
+				return nil, err
+			}
+			if client.OnStatus != nil {
+				client.OnStatus(status)
+			}
+		case MSG_CHANNEL:
+			if onChannel == nil {
+				return nil, fmt.Errorf("unexpected channel request while running the job")
+			}
+			err = onChannel(frame)
+			if err != nil {
+				return nil, err
+			}
+		case MSG_RESULT:
+			return frame.Payload, nil
+		default:
+			return nil, fmt.Errorf("unexpected message %d while running the job", frame.Type)
+		}
+	}
+}
+
+func (client *Client) Close() error {
+	return client.conn.Close()
+}
@@ -0,0 +1,249 @@
+package remote
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+var ErrNoWorker = errors.New("no worker is registered to run the job")
+
+// Registered worker and the number of jobs the coordinator is running on it
+type WorkerInfo struct {
+	Address string
+	Load    int
+}
+
+// Node placing the jobs of its clients on the workers registered to it
+type Coordinator struct {
+	listener net.Listener
+
+	mutex   sync.Mutex
+	workers []*WorkerInfo // In registration order, which breaks ties between equal loads
+	nextJob uint64
+}
+
+// Creates a coordinator listening on address, for clients and workers alike. Connections are
+// accepted once Serve is called.
+func NewCoordinator(address string) (*Coordinator, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &Coordinator{listener: listener}, nil
+}
+
+func (coordinator *Coordinator) Addr() net.Addr {
+	return coordinator.listener.Addr()
+}
+
+// Accepts connections until the coordinator is closed
+func (coordinator *Coordinator) Serve() error {
+	for {
+		conn, err := coordinator.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go coordinator.handleConnection(conn)
+	}
+}
+
+func (coordinator *Coordinator) Close() error {
+	return coordinator.listener.Close()
+}
+
+// Copy of the registry
+func (coordinator *Coordinator) Workers() []WorkerInfo {
+	coordinator.mutex.Lock()
+	defer coordinator.mutex.Unlock()
+
+	workers := make([]WorkerInfo, len(coordinator.workers))
+	for i, worker := range coordinator.workers {
+		workers[i] = *worker
+	}
+	return workers
+}
+
+func (coordinator *Coordinator) handleConnection(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	err := acceptHello(conn, reader)
+	if err != nil {
+		return
+	}
+
+	// Jobs run while the connection is read, for the channel replies the client sends to
+	// the worker running its call. Frames carry no job id, so each job waits for the one
+	// sent before it to end.
+	var worker relay
+	var previous chan struct{}
+	for {
+		frame, err := ReadFrame(reader)
+		if err != nil {
+			return
+		}
+
+		switch frame.Type {
+		case MSG_REGISTER:
+			coordinator.serveWorker(frame.Payload, conn, reader)
+			return
+		case MSG_JOB, MSG_CALL:
+			done := make(chan struct{})
+			go func(request Frame, previous <-chan struct{}) {
+				defer close(done)
+				if previous != nil {
+					<-previous
+				}
+				if coordinator.runJob(request, conn, &worker) != nil {
+					conn.Close()
+				}
+			}(frame, previous)
+			previous = done
+		case MSG_CHANNEL_REPLY:
+			worker.forward(frame)
+		default:
+			WriteFrame(conn, resultFrame(fmt.Errorf("unexpected message %d, expected a job, a call or a registration", frame.Type)))
+			return
+		}
+	}
+}
+
+// Keeps the worker registered until its registration connection ends
+func (coordinator *Coordinator) serveWorker(payload []byte, conn net.Conn, reader *bufio.Reader) {
+	address, err := readString(payload)
+	if err != nil {
+		WriteFrame(conn, resultFrame(err))
+		return
+	}
+
+	worker := coordinator.register(address)
+	defer coordinator.unregister(worker)
+
+	err = WriteFrame(conn, resultFrame(nil))
+	if err != nil {
+		return
+	}
+
+	// Nothing more is expected from the worker, a read only ends when it leaves
+	io.Copy(io.Discard, reader)
+}
+
+func (coordinator *Coordinator) register(address string) *WorkerInfo {
+	coordinator.mutex.Lock()
+	defer coordinator.mutex.Unlock()
+
+	worker := &WorkerInfo{Address: address}
+	coordinator.workers = append(coordinator.workers, worker)
+	return worker
+}
+
+func (coordinator *Coordinator) unregister(worker *WorkerInfo) {
+	coordinator.mutex.Lock()
+	defer coordinator.mutex.Unlock()
+
+	for i, registered := range coordinator.workers {
+		if registered == worker {
+			coordinator.workers = append(coordinator.workers[:i], coordinator.workers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Picks the worker running the fewest jobs and counts the new job in its load
+func (coordinator *Coordinator) acquireWorker() (*WorkerInfo, error) {
+	coordinator.mutex.Lock()
+	defer coordinator.mutex.Unlock()
+
+	var leastLoaded *WorkerInfo
+	for _, worker := range coordinator.workers {
+		if leastLoaded == nil || worker.Load < leastLoaded.Load {
+			leastLoaded = worker
+		}
+	}
+	if leastLoaded == nil {
+		return nil, ErrNoWorker
+	}
+
+	leastLoaded.Load++
+	return leastLoaded, nil
+}
+
+func (coordinator *Coordinator) releaseWorker(worker *WorkerInfo) {
+	coordinator.mutex.Lock()
+	defer coordinator.mutex.Unlock()
+
+	worker.Load--
+}
+
+// Connection to the worker running the job of a client, if any
+type relay struct {
+	mutex sync.Mutex
+	conn  net.Conn
+}
+
+func (relay *relay) set(conn net.Conn) {
+	relay.mutex.Lock()
+	defer relay.mutex.Unlock()
+
+	relay.conn = conn
+}
+
+// Sends a frame of the client to the worker. Frames arriving after the job ended are dropped.
+func (relay *relay) forward(frame Frame) {
+	relay.mutex.Lock()
+	defer relay.mutex.Unlock()
+
+	if relay.conn != nil {
+		WriteFrame(relay.conn, frame)
+	}
+}
+
+// Runs a job or a call on a worker, relaying its status, output, channel requests and result
+// to the client. The returned error means the client connection cannot be used anymore.
+func (coordinator *Coordinator) runJob(request Frame, conn net.Conn, worker *relay) error {
+	coordinator.mutex.Lock()
+	coordinator.nextJob++
+	job := coordinator.nextJob
+	coordinator.mutex.Unlock()
+
+	err := WriteFrame(conn, statusFrame(JobStatus{Job: job, State: JOB_ACCEPTED}))
+	if err != nil {
+		return err
+	}
+
+	placed, err := coordinator.acquireWorker()
+	if err != nil {
+		return WriteFrame(conn, resultFrame(err))
+	}
+	defer coordinator.releaseWorker(placed)
+
+	err = WriteFrame(conn, statusFrame(JobStatus{Job: job, State: JOB_RUNNING, Worker: placed.Address}))
+	if err != nil {
+		return err
+	}
+
+	client, err := Dial(placed.Address)
+	if err != nil {
+		return WriteFrame(conn, resultFrame(fmt.Errorf("could not reach worker %s: %w", placed.Address, err)))
+	}
+	defer client.Close()
+
+	worker.set(client.conn)
+	defer worker.set(nil)
+
+	forward := func(frame Frame) error {
+		return WriteFrame(conn, frame)
+	}
+	result, err := client.run(request, &outputWriter{conn: conn}, forward)
+	if err != nil {
+		return WriteFrame(conn, resultFrame(err))
+	}
+	return WriteFrame(conn, Frame{Type: MSG_RESULT, Payload: result})
+}
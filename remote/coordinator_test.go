@@ -0,0 +1,218 @@
+package remote
+
+import (
+	"atlas/vm"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startCoordinator(t *testing.T, workers int) (*Coordinator, []*Worker) {
+	t.Helper()
+
+	coordinator, err := NewCoordinator("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not start coordinator: %s", err)
+	}
+	go coordinator.Serve()
+	t.Cleanup(func() { coordinator.Close() })
+
+	started := []*Worker{}
+	for i := 0; i < workers; i++ {
+		worker := startWorker(t)
+		err := worker.Register(coordinator.Addr().String(), worker.Addr().String())
+		if err != nil {
+			t.Fatalf("could not register worker: %s", err)
+		}
+		started = append(started, worker)
+	}
+	return coordinator, started
+}
+
+func TestLeastLoadedPlacement(t *testing.T) {
+	coordinator, workers := startCoordinator(t, 3)
+
+	placed := []string{}
+	acquired := []*WorkerInfo{}
+	for i := 0; i < 4; i++ {
+		worker, err := coordinator.acquireWorker()
+		if err != nil {
+			t.Fatalf("could not acquire worker: %s", err)
+		}
+		placed = append(placed, worker.Address)
+		acquired = append(acquired, worker)
+	}
+
+	expected := []string{workers[0].Addr().String(), workers[1].Addr().String(), workers[2].Addr().String(), workers[0].Addr().String()}
+	if strings.Join(placed, " ") != strings.Join(expected, " ") {
+		t.Errorf("wrong placement. expected=%v, got=%v", expected, placed)
+	}
+
+	coordinator.releaseWorker(acquired[1])
+	worker, _ := coordinator.acquireWorker()
+	if worker.Address != workers[1].Addr().String() {
+		t.Errorf("job not placed on the least loaded worker. got=%s", worker.Address)
+	}
+}
+
+func TestCoordinatorRunsJobs(t *testing.T) {
+	coordinator, workers := startCoordinator(t, 2)
+
+	client, err := Dial(coordinator.Addr().String())
+	if err != nil {
+		t.Fatalf("could not connect: %s", err)
+	}
+	defer client.Close()
+
+	statuses := []JobStatus{}
+	client.OnStatus = func(status JobStatus) {
+		statuses = append(statuses, status)
+	}
+
+	var output strings.Builder
+	err = client.Execute(compileProgram(t, "fun double(n: uint): uint { return n * 2; } return double(21);"), &output)
+	if err != nil {
+		t.Fatalf("job failed: %s", err)
+	}
+	if output.String() != "42\n" {
+		t.Errorf("wrong output. got=%q", output.String())
+	}
+
+	if len(statuses) != 2 || statuses[0].State != JOB_ACCEPTED || statuses[1].State != JOB_RUNNING {
+		t.Fatalf("wrong statuses. got=%+v", statuses)
+	}
+	if statuses[1].Worker != workers[0].Addr().String() || statuses[1].Job != statuses[0].Job {
+		t.Errorf("wrong running status. got=%+v", statuses[1])
+	}
+
+	err = client.Execute(compileProgram(t, "var a = 1 / 0;"), &output)
+	var remoteError *RemoteError
+	if !errors.As(err, &remoteError) || !strings.Contains(remoteError.Message, "division by zero") {
+		t.Errorf("expected the runtime error of the job. got=%v", err)
+	}
+
+	for _, worker := range coordinator.Workers() {
+		if worker.Load != 0 {
+			t.Errorf("load of %s not released. got=%d", worker.Address, worker.Load)
+		}
+	}
+}
+
+// Frames carry no job id, so the jobs sent at once on a connection must not interleave even
+// when there are workers for all of them
+func TestCoordinatorRunsJobsInOrder(t *testing.T) {
+	coordinator, _ := startCoordinator(t, 2)
+
+	client, err := Dial(coordinator.Addr().String())
+	if err != nil {
+		t.Fatalf("could not connect: %s", err)
+	}
+	defer client.Close()
+
+	programs := []string{
+		`var i = 0; loop i < 50 { println("a"); i = i + 1; }`,
+		`println("b");`,
+	}
+	for _, program := range programs {
+		byteCode := compileProgram(t, program)
+		data, err := byteCode.MarshalBinary()
+		if err != nil {
+			t.Fatalf("could not encode job: %s", err)
+		}
+		err = WriteFrame(client.conn, Frame{Type: MSG_JOB, Payload: data})
+		if err != nil {
+			t.Fatalf("could not send job: %s", err)
+		}
+	}
+
+	for i, expected := range []string{strings.Repeat("a\n", 50), "b\n"} {
+		var output strings.Builder
+		jobs := map[uint64]bool{}
+		for {
+			frame, err := ReadFrame(client.reader)
+			if err != nil {
+				t.Fatalf("could not read frame: %s", err)
+			}
+			if frame.Type == MSG_RESULT {
+				if err := readResult(frame.Payload); err != nil {
+					t.Fatalf("job %d failed: %s", i, err)
+				}
+				break
+			}
+			switch frame.Type {
+			case MSG_OUTPUT:
+				output.Write(frame.Payload)
+			case MSG_STATUS:
+				status, err := readStatus(frame.Payload)
+				if err != nil {
+					t.Fatalf("wrong status: %s", err)
+				}
+				jobs[status.Job] = true
+			}
+		}
+		if output.String() != expected {
+			t.Errorf("wrong output of job %d. got=%q", i, output.String())
+		}
+		if len(jobs) != 1 {
+			t.Errorf("statuses of several jobs before the result of job %d. got=%v", i, jobs)
+		}
+	}
+}
+
+func TestWorkersLeavingTheRegistry(t *testing.T) {
+	coordinator, workers := startCoordinator(t, 1)
+
+	workers[0].Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(coordinator.Workers()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("closed worker still registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	client, err := Dial(coordinator.Addr().String())
+	if err != nil {
+		t.Fatalf("could not connect: %s", err)
+	}
+	defer client.Close()
+
+	err = client.Execute(compileProgram(t, "return 1;"), &strings.Builder{})
+	if err == nil || err.Error() != ErrNoWorker.Error() {
+		t.Errorf("expected %q. got=%v", ErrNoWorker, err)
+	}
+}
+
+func TestCoordinatorRunsCalls(t *testing.T) {
+	coordinator, _ := startCoordinator(t, 2)
+
+	input := `fun square(x: uint): uint { return x * x; }
+var a = spawn square(3);
+var b = spawn square(4);
+return await a + await b;`
+
+	var output strings.Builder
+	machine := vm.New(compileProgram(t, input), vm.WithExecutor(&Executor{Address: coordinator.Addr().String()}), vm.WithOutput(&output))
+	err := machine.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if output.String() != "25\n" {
+		t.Errorf("wrong output. got=%q", output.String())
+	}
+}
+
+func TestCoordinatorRelaysChannels(t *testing.T) {
+	coordinator, _ := startCoordinator(t, 2)
+
+	var output strings.Builder
+	machine := vm.New(compileProgram(t, CHANNELS_PROGRAM), vm.WithExecutor(&Executor{Address: coordinator.Addr().String()}), vm.WithOutput(&output))
+	err := machine.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if output.String() != "6\n3\n42\n0\n" {
+		t.Errorf("wrong output. got=%q", output.String())
+	}
+}
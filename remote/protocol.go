@@ -0,0 +1,247 @@
+package remote
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+/*
+	Atlas wire protocol
+
+	Nodes talk over TCP with frames. All integers are big endian, like in the bytecode format.
+
+	Frame:
+		length   uint32  Length of the type and the payload, at most MAX_FRAME_SIZE
+		type     uint8   MSG_*
+		payload  [length-1]byte
+
+	A connection starts with the client sending MSG_HELLO, with the protocol version as a
+	uint16 payload. The worker answers MSG_HELLO with its own version, or MSG_RESULT with an
+	error when the versions differ and closes the connection.
+
+	Jobs are then run one after another on the connection, in the order they were sent:
+
+		client -> worker  MSG_JOB     bytecode in the .atlb file format
+		worker -> client  MSG_OUTPUT  text printed by the program, zero or more times, in order
+		worker -> client  MSG_RESULT  status uint8 (STATUS_OK or STATUS_ERROR), then the error
+		                              message as a uint32 length and UTF-8 bytes when it failed
+
+	Each job runs in its own VM: globals and output of a job are never seen by another one.
+
+	Calls spawned by programs run the same way as jobs, in turn with them:
+
+		client -> worker  MSG_CALL    program, function, arguments and globals of the call
+		worker -> client  MSG_OUTPUT  zero or more times
+		worker -> client  MSG_RESULT  STATUS_OK followed by the value returned by the function
+		                              as an object, or STATUS_ERROR and the error message
+
+	The program is bytecode in the .atlb file format as a uint32 length and bytes, only its
+	constants and debug section are used. Then come the function as a value, the arguments
+	count uint32 and values, the globals count uint32 and, for each global set, its index
+	uint32 and value. Values are VALUE_OBJECT followed by an object in the encoding of the
+	.atlb constants, VALUE_CONSTANT followed by the index uint32 of the constant they are,
+	which keeps functions tied to their debug information, or VALUE_CHANNEL followed by the
+	id uint32 the client gives to one of its channels for the call. Arrays and maps are
+	objects, the call gets a copy of them, so they cannot hold channels.
+
+	Channels stay on the client. The call uses them by sending requests while it runs, which
+	the client answers as soon as the operation completes, in any order:
+
+		worker -> client  MSG_CHANNEL        request id uint32, operation uint8 (CHANNEL_*),
+		                                     channel id uint32, then the object sent for CHANNEL_SEND
+		client -> worker  MSG_CHANNEL_REPLY  request id uint32, then STATUS_OK followed by 1 and
+		                                     the object received or 0, or STATUS_ERROR and the message
+
+	Coordinators speak the same protocol to clients, forward channel requests and replies
+	between the client and the worker running its call, and send before the outputs of a job
+	or call. Like workers, they run the jobs and calls of a connection one after another,
+	in the order they were sent:
+
+		coordinator -> client  MSG_STATUS  job id uint64, state uint8 (JOB_*), then the address
+		                                   of the worker running the job as a string
+
+	Workers join a coordinator by opening a connection, saying hello and sending:
+
+		worker -> coordinator  MSG_REGISTER  address clients can reach the worker at, as a string
+		coordinator -> worker  MSG_RESULT    STATUS_OK once registered
+
+	The worker stays registered as long as this connection is open.
+
+	Strings are a uint32 length followed by UTF-8 bytes.
+
+	PROTOCOL_VERSION must be incremented whenever frames or payloads change.
+*/
+
+const PROTOCOL_VERSION uint16 = 9
+
+const MAX_FRAME_SIZE = 64 << 20
+
+const (
+	MSG_HELLO byte = iota + 1
+	MSG_JOB
+	MSG_OUTPUT
+	MSG_RESULT
+	MSG_STATUS
+	MSG_REGISTER
+	MSG_CALL
+	MSG_CHANNEL
+	MSG_CHANNEL_REPLY
+)
+
+const (
+	STATUS_OK byte = iota
+	STATUS_ERROR
+)
+
+const (
+	VALUE_OBJECT byte = iota
+	VALUE_CONSTANT
+	VALUE_CHANNEL
+)
+
+const (
+	CHANNEL_SEND byte = iota
+	CHANNEL_RECV
+	CHANNEL_CLOSE
+)
+
+// States of a job reported by a coordinator
+const (
+	JOB_ACCEPTED byte = iota // Received, waiting to be placed
+	JOB_RUNNING              // Sent to a worker
+)
+
+var ErrFrameTooLarge = errors.New("frame is larger than the maximum frame size")
+
+// Unit of communication between nodes
+type Frame struct {
+	Type    byte
+	Payload []byte
+}
+
+// Writes the frame with a single Write, so that goroutines can share a connection
+func WriteFrame(writer io.Writer, frame Frame) error {
+	if len(frame.Payload)+1 > MAX_FRAME_SIZE {
+		return ErrFrameTooLarge
+	}
+	header := binary.BigEndian.AppendUint32(nil, uint32(len(frame.Payload)+1))
+	header = append(header, frame.Type)
+	_, err := writer.Write(append(header, frame.Payload...))
+	return err
+}
+
+func ReadFrame(reader *bufio.Reader) (Frame, error) {
+	var header [5]byte
+	_, err := io.ReadFull(reader, header[:4])
+	if err != nil {
+		return Frame{}, err
+	}
+
+	length := binary.BigEndian.Uint32(header[:4])
+	if length == 0 {
+		return Frame{}, fmt.Errorf("frame without type")
+	}
+	if length > MAX_FRAME_SIZE {
+		return Frame{}, ErrFrameTooLarge
+	}
+
+	data := make([]byte, length)
+	_, err = io.ReadFull(reader, data)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Frame{}, err
+	}
+
+	return Frame{Type: data[0], Payload: data[1:]}, nil
+}
+
+func helloFrame() Frame {
+	return Frame{Type: MSG_HELLO, Payload: binary.BigEndian.AppendUint16(nil, PROTOCOL_VERSION)}
+}
+
+func readHello(frame Frame) (uint16, error) {
+	if frame.Type != MSG_HELLO || len(frame.Payload) != 2 {
+		return 0, fmt.Errorf("expected hello message, got message %d", frame.Type)
+	}
+	return binary.BigEndian.Uint16(frame.Payload), nil
+}
+
+func appendString(payload []byte, value string) []byte {
+	payload = binary.BigEndian.AppendUint32(payload, uint32(len(value)))
+	return append(payload, value...)
+}
+
+// Reads a string taking the whole rest of payload
+func readString(payload []byte) (string, error) {
+	if len(payload) < 4 || int(binary.BigEndian.Uint32(payload)) != len(payload)-4 {
+		return "", fmt.Errorf("truncated string in message")
+	}
+	return string(payload[4:]), nil
+}
+
+func resultFrame(err error) Frame {
+	if err == nil {
+		return Frame{Type: MSG_RESULT, Payload: []byte{STATUS_OK}}
+	}
+	return Frame{Type: MSG_RESULT, Payload: appendString([]byte{STATUS_ERROR}, err.Error())}
+}
+
+// Error reported by the node running a job, usually a runtime error of the program
+type RemoteError struct {
+	Message string
+}
+
+func (err *RemoteError) Error() string {
+	return err.Message
+}
+
+// Decodes a MSG_RESULT payload, returning the error it carries or nil
+func readResult(payload []byte) error {
+	if len(payload) == 0 {
+		return fmt.Errorf("empty result message")
+	}
+	switch payload[0] {
+	case STATUS_OK:
+		return nil
+	case STATUS_ERROR:
+		message, err := readString(payload[1:])
+		if err != nil {
+			return err
+		}
+		return &RemoteError{Message: message}
+	}
+	return fmt.Errorf("unknown result status %d", payload[0])
+}
+
+// Progress of a job reported by a coordinator
+type JobStatus struct {
+	Job    uint64
+	State  byte   // JOB_*
+	Worker string // Address of the worker running the job, empty until it is placed
+}
+
+func statusFrame(status JobStatus) Frame {
+	payload := binary.BigEndian.AppendUint64(nil, status.Job)
+	payload = append(payload, status.State)
+	return Frame{Type: MSG_STATUS, Payload: appendString(payload, status.Worker)}
+}
+
+func readStatus(payload []byte) (JobStatus, error) {
+	if len(payload) < 9 {
+		return JobStatus{}, fmt.Errorf("truncated status message")
+	}
+	worker, err := readString(payload[9:])
+	if err != nil {
+		return JobStatus{}, err
+	}
+	return JobStatus{
+		Job:    binary.BigEndian.Uint64(payload),
+		State:  payload[8],
+		Worker: worker,
+	}, nil
+}
@@ -0,0 +1,321 @@
+package remote
+
+import (
+	"atlas/compiler"
+	"atlas/parser"
+	"atlas/vm"
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func compileProgram(t *testing.T, input string) compiler.ByteCode {
+	t.Helper()
+
+	pars := parser.New(&input)
+	program := pars.Parse()
+	if len(pars.Errors) > 0 {
+		t.Fatalf("parsing failed: %v", pars.Errors)
+	}
+
+	comp := compiler.New()
+	err := comp.Compile(&program)
+	if err != nil {
+		t.Fatalf("compilation failed: %s", err)
+	}
+	return comp.ByteCode()
+}
+
+func startWorker(t *testing.T) *Worker {
+	t.Helper()
+
+	worker, err := NewWorker("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not start worker: %s", err)
+	}
+	go worker.Serve()
+	t.Cleanup(func() { worker.Close() })
+	return worker
+}
+
+func TestFrames(t *testing.T) {
+	var buffer bytes.Buffer
+	frames := []Frame{
+		{Type: MSG_JOB, Payload: []byte("bytecode")},
+		{Type: MSG_RESULT, Payload: []byte{}},
+	}
+	for _, frame := range frames {
+		err := WriteFrame(&buffer, frame)
+		if err != nil {
+			t.Fatalf("could not write frame: %s", err)
+		}
+	}
+
+	reader := bufio.NewReader(&buffer)
+	for _, expected := range frames {
+		frame, err := ReadFrame(reader)
+		if err != nil {
+			t.Fatalf("could not read frame: %s", err)
+		}
+		if frame.Type != expected.Type || !bytes.Equal(frame.Payload, expected.Payload) {
+			t.Errorf("wrong frame. expected=%+v, got=%+v", expected, frame)
+		}
+	}
+
+	_, err := ReadFrame(bufio.NewReader(bytes.NewReader([]byte{0, 0, 0, 9, MSG_JOB})))
+	if err == nil {
+		t.Errorf("expected an error for a truncated frame")
+	}
+}
+
+func TestExecuteOnWorker(t *testing.T) {
+	worker := startWorker(t)
+
+	client, err := Dial(worker.Addr().String())
+	if err != nil {
+		t.Fatalf("could not connect: %s", err)
+	}
+	defer client.Close()
+
+	var output strings.Builder
+	err = client.Execute(compileProgram(t, "var a = 20; return a + 1; return a * 2;"), &output)
+	if err != nil {
+		t.Fatalf("job failed: %s", err)
+	}
+	if output.String() != "21\n40\n" {
+		t.Errorf("wrong output. got=%q", output.String())
+	}
+
+	// Jobs on the same connection do not share globals
+	output.Reset()
+	err = client.Execute(compileProgram(t, "var b = 1; var c = b / 0;"), &output)
+	var remoteError *RemoteError
+	if !errors.As(err, &remoteError) || remoteError.Message != "1:22: division by zero" {
+		t.Fatalf("expected the runtime error of the job. got=%v", err)
+	}
+
+	err = client.Execute(compileProgram(t, "return 7;"), &output)
+	if err != nil || output.String() != "7\n" {
+		t.Errorf("connection unusable after a failed job. err=%v, output=%q", err, output.String())
+	}
+}
+
+func TestRejectsOtherProtocolVersions(t *testing.T) {
+	worker := startWorker(t)
+
+	conn, err := net.Dial("tcp", worker.Addr().String())
+	if err != nil {
+		t.Fatalf("could not connect: %s", err)
+	}
+	defer conn.Close()
+
+	WriteFrame(conn, Frame{Type: MSG_HELLO, Payload: []byte{0xff, 0xff}})
+	frame, err := ReadFrame(bufio.NewReader(conn))
+	if err != nil {
+		t.Fatalf("could not read answer: %s", err)
+	}
+	if frame.Type != MSG_RESULT || readResult(frame.Payload) == nil {
+		t.Errorf("expected an error result. got=%+v", frame)
+	}
+}
+
+// Functions called by the spawned one and the globals it reads are sent with the call. The
+// future in `a` is not, it stays with the spawning program.
+const SPAWNING_PROGRAM = `var base = 100;
+fun square(x: uint): uint { return x * x; }
+fun addSquare(x: uint): uint { return base + square(x); }
+fun fail(x: uint): uint { return x / 0; }
+var a = spawn addSquare(3);
+var b = spawn fail(1);
+return await a;
+return await b;`
+
+func TestSpawnOnWorker(t *testing.T) {
+	worker := startWorker(t)
+
+	var output strings.Builder
+	machine := vm.New(compileProgram(t, SPAWNING_PROGRAM), vm.WithExecutor(&Executor{Address: worker.Addr().String()}), vm.WithOutput(&output))
+	err := machine.Run()
+
+	if output.String() != "109\n" {
+		t.Errorf("wrong output. got=%q", output.String())
+	}
+
+	var spawnError *vm.SpawnError
+	var remoteError *RemoteError
+	if !errors.As(err, &spawnError) || spawnError.Function != "fail" || !errors.As(err, &remoteError) {
+		t.Fatalf("expected the remote error of the spawned call. got=%T (%v)", err, err)
+	}
+	if remoteError.Message != "4:36: division by zero" {
+		t.Errorf("wrong remote error. got=%q", remoteError.Message)
+	}
+}
+
+// Channels stay with the spawning program, the calls running on the worker send on them and
+// receive from them through the connection
+const CHANNELS_PROGRAM = `fun produce(c: chan uint, n: uint): uint {
+	var i: uint = 0;
+	loop i < n { send(c, i + 1); i = i + 1; }
+	close(c);
+	return n;
+}
+fun double(from: chan uint, to: chan uint): uint { send(to, recv(from) * 2); return 0; }
+var c = chan();
+var h = spawn produce(c, 3);
+var sum: uint = 0;
+var i: uint = 0;
+loop i < 4 { sum = sum + recv(c); i = i + 1; }
+return sum;
+return await h;
+var from = chan();
+var to = chan(1);
+var d = spawn double(from, to);
+send(from, 21);
+return recv(to);
+return await d;`
+
+func TestChannelsAcrossNodes(t *testing.T) {
+	worker := startWorker(t)
+
+	var output strings.Builder
+	machine := vm.New(compileProgram(t, CHANNELS_PROGRAM), vm.WithExecutor(&Executor{Address: worker.Addr().String()}), vm.WithOutput(&output))
+	err := machine.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if output.String() != "6\n3\n42\n0\n" {
+		t.Errorf("wrong output. got=%q", output.String())
+	}
+
+	input := "fun fill(c: chan uint): uint { send(c, 1); return 0; } var c = chan(1); close(c); await spawn fill(c);"
+	machine = vm.New(compileProgram(t, input), vm.WithExecutor(&Executor{Address: worker.Addr().String()}))
+	err = machine.Run()
+	if err == nil || !strings.Contains(err.Error(), "send on closed channel") {
+		t.Errorf("expected the error of the channel operation. got=%v", err)
+	}
+}
+
+func TestWorkerLimits(t *testing.T) {
+	worker := startWorker(t)
+	worker.MaxInstructions = 10000
+
+	client, err := Dial(worker.Addr().String())
+	if err != nil {
+		t.Fatalf("could not connect: %s", err)
+	}
+	defer client.Close()
+
+	err = client.Execute(compileProgram(t, "loop true {}"), &strings.Builder{})
+	var remoteError *RemoteError
+	if !errors.As(err, &remoteError) || !strings.Contains(remoteError.Message, "instruction limit reached") {
+		t.Errorf("expected the job to hit the instruction limit. got=%v", err)
+	}
+
+	input := "fun spin(): uint { loop true {} return 0; } await spawn spin();"
+	machine := vm.New(compileProgram(t, input), vm.WithExecutor(&Executor{Address: worker.Addr().String()}))
+	err = machine.Run()
+	if !errors.As(err, &remoteError) || !strings.Contains(remoteError.Message, "instruction limit reached") {
+		t.Errorf("expected the call to hit the instruction limit. got=%v", err)
+	}
+}
+
+// Jobs and calls have no input, they never read the stdin of the worker nor the input of the
+// program that spawned them
+func TestRemoteInput(t *testing.T) {
+	worker := startWorker(t)
+
+	client, err := Dial(worker.Addr().String())
+	if err != nil {
+		t.Fatalf("could not connect: %s", err)
+	}
+	defer client.Close()
+
+	err = client.Execute(compileProgram(t, "var x = 0; in x; println(x * 2);"), &strings.Builder{})
+	var remoteError *RemoteError
+	if !errors.As(err, &remoteError) || !strings.Contains(remoteError.Message, "end of input") {
+		t.Errorf("expected the job to reach the end of its input. got=%v", err)
+	}
+
+	input := "fun read(): uint { var x: uint = 0; in x; return x; } await spawn read();"
+	machine := vm.New(compileProgram(t, input), vm.WithExecutor(&Executor{Address: worker.Addr().String()}), vm.WithInput(strings.NewReader("21")))
+	err = machine.Run()
+	if !errors.As(err, &remoteError) || !strings.Contains(remoteError.Message, "end of input") {
+		t.Errorf("expected the call to reach the end of its input. got=%v", err)
+	}
+}
+
+// Frames carry no job id, so the calls and jobs sent at once on a connection must not
+// interleave
+func TestWorkerRunsRequestsInOrder(t *testing.T) {
+	worker := startWorker(t)
+
+	client, err := Dial(worker.Addr().String())
+	if err != nil {
+		t.Fatalf("could not connect: %s", err)
+	}
+	defer client.Close()
+
+	byteCode := compileProgram(t, `fun slow(): uint { var i = 0; loop i < 50 { println("a"); i = i + 1; } return 1; }
+fun fast(): uint { println("b"); return 2; }`)
+	requests := []Frame{}
+	for _, name := range []string{"slow", "fast"} {
+		for _, constant := range byteCode.Constants {
+			function, ok := constant.(*compiler.CompiledFunction)
+			if !ok || function.Name != name {
+				continue
+			}
+			payload, _, err := encodeCall(&vm.Call{Function: function, Constants: byteCode.Constants, Debug: byteCode.Debug})
+			if err != nil {
+				t.Fatalf("could not encode call: %s", err)
+			}
+			requests = append(requests, Frame{Type: MSG_CALL, Payload: payload})
+		}
+	}
+	job := compileProgram(t, `println("c");`)
+	data, err := job.MarshalBinary()
+	if err != nil {
+		t.Fatalf("could not encode job: %s", err)
+	}
+	requests = append(requests, Frame{Type: MSG_JOB, Payload: data})
+
+	for _, request := range requests {
+		err = WriteFrame(client.conn, request)
+		if err != nil {
+			t.Fatalf("could not send request: %s", err)
+		}
+	}
+
+	expected := []string{strings.Repeat("a\n", 50) + "1", "b\n2", "c\n"}
+	for i, request := range requests {
+		var output strings.Builder
+		for {
+			frame, err := ReadFrame(client.reader)
+			if err != nil {
+				t.Fatalf("could not read frame: %s", err)
+			}
+			if frame.Type == MSG_OUTPUT {
+				output.Write(frame.Payload)
+				continue
+			}
+			if frame.Type != MSG_RESULT {
+				t.Fatalf("unexpected message %d", frame.Type)
+			}
+			if request.Type == MSG_CALL {
+				value, err := readValue(frame.Payload)
+				if err != nil {
+					t.Fatalf("call %d failed: %s", i, err)
+				}
+				output.WriteString(value.Inspect())
+			} else if err := readResult(frame.Payload); err != nil {
+				t.Fatalf("job failed: %s", err)
+			}
+			break
+		}
+		if output.String() != expected[i] {
+			t.Errorf("wrong output of request %d. expected=%q, got=%q", i, expected[i], output.String())
+		}
+	}
+}
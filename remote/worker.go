@@ -0,0 +1,202 @@
+package remote
+
+import (
+	"atlas/compiler"
+	"atlas/vm"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Node running the jobs submitted over its connections. Limits are set before Serve is
+// called, programs from other nodes cannot keep the worker busy forever then.
+type Worker struct {
+	listener     net.Listener
+	registration net.Conn // Connection to the coordinator the worker joined, if any
+
+	MaxInstructions int           // Instructions a job or call may run, unlimited when 0
+	Timeout         time.Duration // Time a job or call may run, unlimited when 0
+}
+
+// Creates a worker listening on address. Connections are accepted once Serve is called.
+func NewWorker(address string) (*Worker, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &Worker{listener: listener}, nil
+}
+
+func (worker *Worker) Addr() net.Addr {
+	return worker.listener.Addr()
+}
+
+// Accepts connections until the worker is closed. Every connection is served by its own goroutine.
+func (worker *Worker) Serve() error {
+	for {
+		conn, err := worker.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go worker.handleConnection(conn)
+	}
+}
+
+// Stops accepting connections and leaves the coordinator. Jobs already running go on until they end.
+func (worker *Worker) Close() error {
+	if worker.registration != nil {
+		worker.registration.Close()
+	}
+	return worker.listener.Close()
+}
+
+// Joins the coordinator at coordinatorAddress, which will send jobs to advertisedAddress.
+// The worker stays registered until it is closed.
+func (worker *Worker) Register(coordinatorAddress string, advertisedAddress string) error {
+	client, err := Dial(coordinatorAddress)
+	if err != nil {
+		return err
+	}
+
+	err = WriteFrame(client.conn, Frame{Type: MSG_REGISTER, Payload: appendString(nil, advertisedAddress)})
+	if err == nil {
+		var frame Frame
+		frame, err = ReadFrame(client.reader)
+		if err == nil && frame.Type != MSG_RESULT {
+			err = fmt.Errorf("unexpected message %d, expected the registration result", frame.Type)
+		} else if err == nil {
+			err = readResult(frame.Payload)
+		}
+	}
+	if err != nil {
+		client.Close()
+		return fmt.Errorf("could not register to coordinator: %w", err)
+	}
+
+	worker.registration = client.conn
+	return nil
+}
+
+func (worker *Worker) handleConnection(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	err := acceptHello(conn, reader)
+	if err != nil {
+		return
+	}
+
+	// Jobs and calls run while the connection is read, for the replies to the channel
+	// requests of calls. Frames carry no job id, so each one waits for the one sent before it
+	// to end.
+	session := newChannelSession(conn)
+	defer session.fail(errors.New("connection to the client lost"))
+	var previous chan struct{}
+
+	for {
+		frame, err := ReadFrame(reader)
+		if err != nil {
+			return
+		}
+
+		switch frame.Type {
+		case MSG_JOB, MSG_CALL:
+			done := make(chan struct{})
+			go func(request Frame, previous <-chan struct{}) {
+				defer close(done)
+				if previous != nil {
+					<-previous
+				}
+				if worker.run(request, conn, session) != nil {
+					conn.Close()
+				}
+			}(frame, previous)
+			previous = done
+		case MSG_CHANNEL_REPLY:
+			if session.reply(frame.Payload) != nil {
+				return
+			}
+		default:
+			WriteFrame(conn, resultFrame(fmt.Errorf("unexpected message %d, expected a job or a call", frame.Type)))
+			return
+		}
+	}
+}
+
+// Runs a job or call and sends its result, failing only when the result cannot be sent
+func (worker *Worker) run(request Frame, conn net.Conn, session *channelSession) error {
+	output := &outputWriter{conn: conn}
+	if request.Type == MSG_CALL {
+		value, err := runCall(request.Payload, output, session, worker.limits()...)
+		return WriteFrame(conn, callResultFrame(value, err))
+	}
+	err := runJob(request.Payload, output, worker.limits()...)
+	return WriteFrame(conn, resultFrame(err))
+}
+
+// Options of the VM running a job or call starting now
+func (worker *Worker) limits() []vm.Option {
+	options := []vm.Option{vm.WithMaxInstructions(worker.MaxInstructions)}
+	if worker.Timeout > 0 {
+		options = append(options, vm.WithDeadline(time.Now().Add(worker.Timeout)))
+	}
+	return options
+}
+
+// Answers the hello of a client, or tells it why the connection cannot go on
+func acceptHello(conn io.Writer, reader *bufio.Reader) error {
+	frame, err := ReadFrame(reader)
+	if err != nil {
+		return err
+	}
+
+	version, err := readHello(frame)
+	if err == nil && version != PROTOCOL_VERSION {
+		err = fmt.Errorf("protocol version %d is not supported, this node speaks version %d", version, PROTOCOL_VERSION)
+	}
+	if err != nil {
+		WriteFrame(conn, resultFrame(err))
+		return err
+	}
+
+	return WriteFrame(conn, helloFrame())
+}
+
+// Loads and runs a job in a new VM. A panic caused by malformed bytecode fails the job only.
+// Jobs have no input, `in` statements fail rather than read the stdin of the worker.
+func runJob(data []byte, output io.Writer, options ...vm.Option) (err error) {
+	var byteCode compiler.ByteCode
+	err = byteCode.UnmarshalBinary(data)
+	if err != nil {
+		return fmt.Errorf("could not load bytecode: %w", err)
+	}
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("job crashed: %v", recovered)
+		}
+	}()
+
+	machine := vm.New(byteCode, append(options, vm.WithInput(strings.NewReader("")), vm.WithOutput(output))...)
+	return machine.Run()
+}
+
+// Sends what a job prints to the client as it is written
+type outputWriter struct {
+	conn io.Writer
+}
+
+func (writer *outputWriter) Write(data []byte) (int, error) {
+	err := WriteFrame(writer.conn, Frame{Type: MSG_OUTPUT, Payload: data})
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
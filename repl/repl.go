@@ -0,0 +1,227 @@
+package repl
+
+import (
+	"atlas/checker"
+	"atlas/cli"
+	"atlas/compiler"
+	"atlas/diagnostic"
+	"atlas/lexer"
+	"atlas/parser"
+	"atlas/vm"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Name given to the inputs in diagnostics and runtime errors
+const REPL_FILE = "<repl>"
+
+const PROMPT = ">> "
+const CONTINUATION_PROMPT = ".. "
+
+const HELP = `Type statements to run them. Expression values are echoed.
+Input continues on the next line while braces are not balanced.
+
+Commands:
+  :globals  List the global variables and functions with their values
+  :disasm   Disassemble the bytecode of the last input
+  :reset    Forget every declaration
+  :help     Show this message
+  :quit     Leave the REPL`
+
+// State kept between the inputs of a session. An input that fails declares nothing, but the
+// assignments it ran before failing are kept.
+type session struct {
+	checker      *checker.Checker
+	symbolTable  *compiler.SymbolTable
+	constants    []compiler.Object
+	globals      []compiler.Object
+	lastByteCode *compiler.ByteCode
+}
+
+func newSession() *session {
+	return &session{
+		checker:     checker.New(),
+		symbolTable: compiler.NewSymbolTable(),
+		constants:   []compiler.Object{},
+		globals:     make([]compiler.Object, vm.GLOBALS_SIZE),
+	}
+}
+
+// Reads inputs from in until it ends or `:quit` is entered, and writes results to out
+func Start(in io.Reader, out io.Writer) {
+	scanner := bufio.NewScanner(in)
+	programInput := &lineReader{scanner: scanner}
+	session := newSession()
+
+	for {
+		fmt.Fprint(out, PROMPT)
+		input, ok := readInput(scanner, out)
+		if !ok {
+			fmt.Fprintln(out)
+			return
+		}
+
+		trimmed := strings.TrimSpace(input)
+		if trimmed == "" {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, ":") {
+			if trimmed == ":quit" {
+				return
+			}
+			session = session.runCommand(trimmed, out)
+			continue
+		}
+
+		session.eval(input, programInput, out)
+	}
+}
+
+// Gives the lines following an input to the `in` statements it runs
+type lineReader struct {
+	scanner *bufio.Scanner
+	pending []byte
+}
+
+func (reader *lineReader) Read(data []byte) (int, error) {
+	if len(reader.pending) == 0 {
+		if !reader.scanner.Scan() {
+			return 0, io.EOF
+		}
+		reader.pending = append(append(reader.pending, reader.scanner.Bytes()...), '\n')
+	}
+	read := copy(data, reader.pending)
+	reader.pending = reader.pending[read:]
+	return read, nil
+}
+
+// Reads lines until braces are balanced
+func readInput(scanner *bufio.Scanner, out io.Writer) (string, bool) {
+	var input strings.Builder
+
+	for scanner.Scan() {
+		input.WriteString(scanner.Text())
+		input.WriteRune('\n')
+
+		if braceDepth(input.String()) <= 0 {
+			return input.String(), true
+		}
+		fmt.Fprint(out, CONTINUATION_PROMPT)
+	}
+
+	// The last input may end without a new line
+	return input.String(), input.Len() > 0
+}
+
+// Number of braces left open in code. Braces in comments are ignored.
+func braceDepth(code string) int {
+	tokenizer := lexer.New(&code)
+	depth := 0
+	for {
+		token, err := tokenizer.NextToken()
+		if err != nil || token.Type == lexer.EOF {
+			return depth
+		}
+		switch token.Type {
+		case lexer.LBRACE:
+			depth++
+		case lexer.RBRACE:
+			depth--
+		}
+	}
+}
+
+func (session *session) runCommand(command string, out io.Writer) *session {
+	switch command {
+	case ":globals":
+		for _, symbol := range session.symbolTable.Symbols() {
+			value := session.globals[symbol.Index]
+			if value == nil {
+				continue
+			}
+			fmt.Fprintf(out, "%s = %s\n", symbol.Name, value.Inspect())
+		}
+	case ":disasm":
+		if session.lastByteCode == nil {
+			fmt.Fprintln(out, "Nothing compiled yet")
+		} else {
+			fmt.Fprint(out, session.lastByteCode.Disassemble())
+		}
+	case ":reset":
+		return newSession()
+	case ":help":
+		fmt.Fprintln(out, HELP)
+	default:
+		fmt.Fprintf(out, "Unknown command `%s`, type :help to list commands\n", command)
+	}
+	return session
+}
+
+func (session *session) eval(input string, programInput io.Reader, out io.Writer) {
+	code := terminateStatement(input)
+
+	pars := parser.New(&code)
+	program := pars.Parse()
+	if len(pars.Errors) > 0 {
+		cli.RenderDiagnostics(out, REPL_FILE, code, pars.Errors)
+		return
+	}
+
+	// Checked and compiled with copies, kept only if the input runs successfully
+	check := session.checker.Copy()
+	check.Check(&program)
+	if len(check.Errors) > 0 {
+		cli.RenderDiagnostics(out, REPL_FILE, code, check.Errors)
+		return
+	}
+
+	symbolTable := session.symbolTable.Copy()
+	comp := compiler.NewWithState(symbolTable, session.constants)
+	err := comp.Compile(&program)
+	var compileError *compiler.Error
+	if errors.As(err, &compileError) {
+		cli.RenderDiagnostics(out, REPL_FILE, code, []diagnostic.Diagnostic{compileError.Diagnostic})
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return
+	}
+
+	byteCode := comp.ByteCode()
+	byteCode.Debug.File = REPL_FILE
+	byteCode.Debug.Source = code
+
+	machine := vm.NewWithGlobals(byteCode, session.globals, vm.WithInput(programInput), vm.WithOutput(out))
+	err = machine.Run()
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return
+	}
+
+	session.checker = check
+	session.symbolTable = symbolTable
+	session.constants = byteCode.Constants
+	session.lastByteCode = &byteCode
+
+	if len(program.Statements) > 0 {
+		// Calls returning nothing, like `println`, already showed what they had to
+		_, ok := program.Statements[len(program.Statements)-1].(*parser.ExpressionStatement)
+		if value := machine.PoppedGhost(); ok && value != compiler.Null {
+			fmt.Fprintln(out, value.Inspect())
+		}
+	}
+}
+
+// Adds the semicolon that is easy to forget when typing a single statement
+func terminateStatement(input string) string {
+	trimmed := strings.TrimSpace(input)
+	if strings.HasSuffix(trimmed, ";") || strings.HasSuffix(trimmed, "}") {
+		return input
+	}
+	return trimmed + ";\n"
+}
@@ -0,0 +1,110 @@
+package repl
+
+import (
+	"strings"
+	"testing"
+)
+
+func runSession(input string) string {
+	var out strings.Builder
+	Start(strings.NewReader(input), &out)
+	return out.String()
+}
+
+func TestEchoAndPersistence(t *testing.T) {
+	output := runSession("var a = 5;\na * 2\nfun square(n: uint): uint {\n\treturn n * n;\n}\nsquare(a)\n")
+
+	expected := ">> >> 10\n>> .. .. >> 25\n>> \n"
+	if output != expected {
+		t.Errorf("wrong output. expected=%q, got=%q", expected, output)
+	}
+}
+
+func TestCallsWithoutValueEchoNothing(t *testing.T) {
+	output := runSession("println(1, 2)\nprint(3)\n")
+
+	expected := ">> 1 2\n>> 3>> \n"
+	if output != expected {
+		t.Errorf("wrong output. expected=%q, got=%q", expected, output)
+	}
+}
+
+func TestFailedInputDeclaresNothing(t *testing.T) {
+	output := runSession("var a = 1 / 0;\nvar a = 3;\na\n")
+
+	if !strings.Contains(output, "division by zero") {
+		t.Errorf("runtime error not reported. got=%q", output)
+	}
+	if strings.Contains(output, "already declared") || !strings.Contains(output, ">> 3\n") {
+		t.Errorf("declaration of the failed input was kept. got=%q", output)
+	}
+}
+
+func TestCompilerErrorDiagnostics(t *testing.T) {
+	output := runSession("if true { fun f(): uint { return 1; } }\n")
+
+	if !strings.Contains(output, "error[C001]: function `f` must be declared at top level") || !strings.Contains(output, "--> <repl>:1:11") {
+		t.Errorf("compiler error not rendered as a diagnostic. got=%q", output)
+	}
+}
+
+func TestInputAfterFailedFunction(t *testing.T) {
+	output := runSession("fun f(): uint { fun g(): uint { return 1; } return 2; }\nfun f(): uint { return 3; }\nf()\n")
+
+	if !strings.Contains(output, "error[C001]: function `g` must be declared at top level") {
+		t.Errorf("compiler error not rendered. got=%q", output)
+	}
+	if !strings.HasSuffix(output, ">> >> 3\n>> \n") {
+		t.Errorf("wrong output after the failed declaration. got=%q", output)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var a = 1;\nvar b = true;\n:globals\n", "a = 1\nb = true\n"},
+		{"var a = 1;\n:reset\na\n", "Undefined symbol `a`"},
+		{"1 + 2\n:disasm\n", "    0003 CONST 1 (2)\n    0006 ADD\n"},
+		{":disasm\n", "Nothing compiled yet"},
+		{":nope\n", "Unknown command `:nope`"},
+		{":quit\n1 + 2\n", ">> "},
+	}
+
+	for _, tt := range tests {
+		output := runSession(tt.input)
+		if !strings.Contains(output, tt.expected) {
+			t.Errorf("wrong output for %q. expected to contain %q, got=%q", tt.input, tt.expected, output)
+		}
+	}
+}
+
+func TestBraceDepth(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"if true {", 1},
+		{"if true { } else {", 1},
+		{"fun f(): uint { if true { return 1; } return 2; }", 0},
+		{"var a = 1; @ comment with {", 0},
+	}
+
+	for _, tt := range tests {
+		if depth := braceDepth(tt.input); depth != tt.expected {
+			t.Errorf("wrong depth for %q. expected=%d, got=%d", tt.input, tt.expected, depth)
+		}
+	}
+}
+
+func TestProgramsReadTheFollowingLines(t *testing.T) {
+	output := runSession("var a: uint = 0;\nin a;\n41\na + 1\nin a;\n")
+
+	if !strings.Contains(output, ">> 42\n") {
+		t.Errorf("value not read from the next line. got=%q", output)
+	}
+	if !strings.Contains(output, "end of input") {
+		t.Errorf("end of input not reported. got=%q", output)
+	}
+}
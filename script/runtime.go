@@ -0,0 +1,194 @@
+package script
+
+import (
+	"atlas/compiler"
+	"atlas/vm"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+var ErrInstructionLimit = vm.ErrInstructionLimit
+var ErrNoProgram = errors.New("no program ran on this runtime")
+
+// Function of the host, called by programs with the values of their arguments. The error it
+// returns fails the program where the call is.
+type NativeFunction func(args []Object) (Object, error)
+
+// Configures a runtime when it is created
+type Option func(runtime *Runtime)
+
+// Reads the values of `in` statements from input. Programs have no input without it.
+func WithInput(input io.Reader) Option {
+	return func(runtime *Runtime) {
+		runtime.input = input
+	}
+}
+
+// Writes the values printed by programs to output instead of stdout
+func WithOutput(output io.Writer) Option {
+	return func(runtime *Runtime) {
+		runtime.output = output
+	}
+}
+
+// Stops each run after count instructions with ErrInstructionLimit. Values below 1 are ignored.
+func WithMaxInstructions(count int) Option {
+	return func(runtime *Runtime) {
+		runtime.maxInstructions = count
+	}
+}
+
+// Stops each run once it ran for timeout, with context.DeadlineExceeded
+func WithTimeout(timeout time.Duration) Option {
+	return func(runtime *Runtime) {
+		runtime.timeout = timeout
+	}
+}
+
+// Runs programs with the functions registered by the host. The globals of a program are kept
+// after its run, until another program runs. A runtime runs one program at a time.
+type Runtime struct {
+	natives map[string]*compiler.NativeFunction
+
+	program *Program // Last program run, owning globals
+	globals []compiler.Object
+
+	input           io.Reader
+	output          io.Writer
+	maxInstructions int
+	timeout         time.Duration
+}
+
+func NewRuntime(options ...Option) *Runtime {
+	runtime := &Runtime{natives: make(map[string]*compiler.NativeFunction)}
+	for _, option := range options {
+		option(runtime)
+	}
+	return runtime
+}
+
+// Makes function callable by programs as name, replacing the function registered before
+func (runtime *Runtime) Register(name string, function NativeFunction) {
+	runtime.natives[name] = &compiler.NativeFunction{Name: name, Function: function}
+}
+
+func (runtime *Runtime) Run(program *Program) error {
+	return runtime.RunContext(context.Background(), program)
+}
+
+// Runs program until it ends or ctx is done. Running the same program again keeps the
+// globals set by the previous run and by SetGlobal.
+func (runtime *Runtime) RunContext(ctx context.Context, program *Program) error {
+	if runtime.program != program {
+		runtime.program = program
+		runtime.globals = make([]compiler.Object, vm.GLOBALS_SIZE)
+	}
+	for name, index := range program.natives {
+		native, ok := runtime.natives[name]
+		if !ok {
+			return fmt.Errorf("function `%s` called by the program is not registered", name)
+		}
+		runtime.globals[index] = native
+	}
+
+	machine := vm.NewWithGlobals(program.byteCode, runtime.globals, runtime.vmOptions()...)
+	return machine.RunContext(ctx)
+}
+
+func (runtime *Runtime) vmOptions() []vm.Option {
+	options := []vm.Option{vm.WithMaxInstructions(runtime.maxInstructions)}
+	if runtime.input != nil {
+		options = append(options, vm.WithInput(runtime.input))
+	}
+	if runtime.output != nil {
+		options = append(options, vm.WithOutput(runtime.output))
+	}
+	if runtime.timeout > 0 {
+		options = append(options, vm.WithDeadline(time.Now().Add(runtime.timeout)))
+	}
+	return options
+}
+
+// Value of a global declared at top level by the last program run. Returns false when the
+// program does not declare it or did not set it.
+func (runtime *Runtime) Global(name string) (Object, bool) {
+	if runtime.program == nil {
+		return nil, false
+	}
+	index, ok := runtime.program.globals[name]
+	if !ok || runtime.globals[index] == nil {
+		return nil, false
+	}
+	return runtime.globals[index], true
+}
+
+// Sets a global declared at top level by the last program run, for the functions called with
+// Call. Running the program again sets its globals again with their declarations. The value
+// must have the type of the value the global holds.
+func (runtime *Runtime) SetGlobal(name string, value Object) error {
+	if runtime.program == nil {
+		return ErrNoProgram
+	}
+	index, ok := runtime.program.globals[name]
+	if !ok {
+		return fmt.Errorf("the program declares no global `%s`", name)
+	}
+	if value == nil {
+		return fmt.Errorf("cannot set `%s` to no value", name)
+	}
+	current := runtime.globals[index]
+	if current != nil && current.Type() != value.Type() {
+		return fmt.Errorf("cannot set `%s` holding a value of type %s to a value of type %s", name, current.Type(), value.Type())
+	}
+	runtime.globals[index] = value
+	return nil
+}
+
+func (runtime *Runtime) Call(name string, args ...Object) (Object, error) {
+	return runtime.CallContext(context.Background(), name, args...)
+}
+
+// Calls a function declared at top level by the last program run, until it returns or ctx is
+// done. The function sees the globals left by the run and by SetGlobal, and the globals it sets
+// stay set. The arguments must have the types of the parameters.
+func (runtime *Runtime) CallContext(ctx context.Context, name string, args ...Object) (Object, error) {
+	if runtime.program == nil {
+		return nil, ErrNoProgram
+	}
+	index, ok := runtime.program.globals[name]
+	if !ok {
+		return nil, fmt.Errorf("the program declares no function `%s`", name)
+	}
+	if _, ok := runtime.globals[index].(*compiler.CompiledFunction); !ok {
+		return nil, fmt.Errorf("`%s` is not a function", name)
+	}
+
+	// The arguments are constants of a main function doing nothing but the call
+	program := runtime.program.byteCode
+	constants := append(program.Constants[:len(program.Constants):len(program.Constants)], args...)
+	instructions := compiler.MakeInstruction(compiler.GLOBAL_GET, index)
+	for i, arg := range args {
+		if arg == nil {
+			return nil, fmt.Errorf("cannot call `%s` with no value as argument %d", name, i+1)
+		}
+		instructions = append(instructions, compiler.MakeInstruction(compiler.CONST, len(program.Constants)+i)...)
+	}
+	instructions = append(instructions, compiler.MakeInstruction(compiler.CALL, len(args))...)
+
+	byteCode := compiler.ByteCode{Instructions: instructions, Constants: constants}
+	if program.Debug != nil {
+		// The main function has no place in the source
+		debug := *program.Debug
+		debug.Lines = nil
+		byteCode.Debug = &debug
+	}
+	machine := vm.NewWithGlobals(byteCode, runtime.globals, runtime.vmOptions()...)
+	err := machine.RunContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return machine.StackTop(), nil
+}
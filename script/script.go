@@ -0,0 +1,91 @@
+// Package script runs Atlas programs inside Go programs. Programs are compiled once with
+// Compile and run by a Runtime, which gives them the functions registered by the host and
+// lets the host read and set their globals by name and call their functions.
+package script
+
+import (
+	"atlas/checker"
+	"atlas/cli"
+	"atlas/compiler"
+	"atlas/diagnostic"
+	"atlas/parser"
+	"errors"
+	"strings"
+)
+
+// Name given to the source of programs in diagnostics and runtime errors
+const SCRIPT_FILE = "<script>"
+
+// Program compiled by Compile, ready to run on any runtime registering the functions it calls
+type Program struct {
+	byteCode compiler.ByteCode
+	globals  map[string]int // Indexes of the globals declared at top level
+	natives  map[string]int // Indexes of the globals holding the functions of the host
+}
+
+// Failure to parse or check the source of a program
+type CompileError struct {
+	Source      string
+	Diagnostics []diagnostic.Diagnostic
+}
+
+func (err *CompileError) Error() string {
+	var message strings.Builder
+	cli.RenderDiagnostics(&message, SCRIPT_FILE, err.Source, err.Diagnostics)
+	return strings.TrimRight(message.String(), "\n")
+}
+
+// Compiles the source of a program. Functions called without being declared are functions of
+// the host: a runtime running the program must register them.
+func Compile(source string) (*Program, error) {
+	pars := parser.New(&source)
+	program := pars.Parse()
+	if len(pars.Errors) > 0 {
+		return nil, &CompileError{Source: source, Diagnostics: pars.Errors}
+	}
+
+	check := checker.New()
+	check.AllowNatives()
+	check.Check(&program)
+	if len(check.Errors) > 0 {
+		return nil, &CompileError{Source: source, Diagnostics: check.Errors}
+	}
+
+	// Functions of the host come first, the globals of the program follow
+	symbolTable := compiler.NewSymbolTable()
+	natives := make(map[string]int)
+	for _, name := range check.Natives() {
+		natives[name] = symbolTable.Define(name).Index
+	}
+
+	comp := compiler.NewWithState(symbolTable, []compiler.Object{})
+	err := comp.Compile(&program)
+	var compileError *compiler.Error
+	if errors.As(err, &compileError) {
+		return nil, &CompileError{Source: source, Diagnostics: []diagnostic.Diagnostic{compileError.Diagnostic}}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	globals := make(map[string]int)
+	for _, symbol := range symbolTable.Symbols() {
+		if _, ok := natives[symbol.Name]; !ok {
+			globals[symbol.Name] = symbol.Index
+		}
+	}
+
+	byteCode := comp.ByteCode()
+	byteCode.Debug.File = SCRIPT_FILE
+	byteCode.Debug.Source = source
+	return &Program{byteCode: byteCode, globals: globals, natives: natives}, nil
+}
+
+// Functions of the host the program calls, in the order of their first call
+func (program *Program) Natives() []string {
+	names := make([]string, len(program.natives))
+	for name, index := range program.natives {
+		names[index] = name
+	}
+	return names
+}
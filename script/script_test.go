@@ -0,0 +1,213 @@
+package script
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func compile(t *testing.T, source string) *Program {
+	t.Helper()
+
+	program, err := Compile(source)
+	if err != nil {
+		t.Fatalf("compilation failed: %s", err)
+	}
+	return program
+}
+
+func TestNativeFunctions(t *testing.T) {
+	program := compile(t, `fun quadruple(n: uint): uint { return double(double(n)); }
+var total: uint = quadruple(10);
+var logged = log(total, true);
+var h = spawn quadruple(1);
+return await h;`)
+	if strings.Join(program.Natives(), " ") != "double log" {
+		t.Errorf("wrong natives. got=%v", program.Natives())
+	}
+
+	var output strings.Builder
+	logs := []string{}
+	runtime := NewRuntime(WithOutput(&output))
+	runtime.Register("double", func(args []Object) (Object, error) {
+		return Uint(Value(args[0]).(uint64) * 2), nil
+	})
+	runtime.Register("log", func(args []Object) (Object, error) {
+		for _, arg := range args {
+			logs = append(logs, arg.Inspect())
+		}
+		return Bool(true), nil
+	})
+
+	err := runtime.Run(program)
+	if err != nil {
+		t.Fatalf("run failed: %s", err)
+	}
+	if output.String() != "4\n" {
+		t.Errorf("wrong output. got=%q", output.String())
+	}
+	if strings.Join(logs, " ") != "40 true" {
+		t.Errorf("wrong arguments of the host function. got=%v", logs)
+	}
+
+	total, ok := runtime.Global("total")
+	if !ok || Value(total) != uint64(40) {
+		t.Errorf("wrong global. got=%v", total)
+	}
+	if _, ok := runtime.Global("double"); ok {
+		t.Errorf("host functions are not globals of the program")
+	}
+}
+
+func TestNativeFunctionErrors(t *testing.T) {
+	program := compile(t, "var a = fail(1);")
+
+	runtime := NewRuntime()
+	err := runtime.Run(program)
+	if err == nil || err.Error() != "function `fail` called by the program is not registered" {
+		t.Errorf("expected the missing function. got=%v", err)
+	}
+
+	failure := errors.New("out of stock")
+	runtime.Register("fail", func(args []Object) (Object, error) {
+		return nil, failure
+	})
+	err = runtime.Run(program)
+	if !errors.Is(err, failure) || !strings.HasPrefix(err.Error(), "<script>:1:13: call to `fail` failed: out of stock") {
+		t.Errorf("expected the error of the host function. got=%v", err)
+	}
+
+	runtime.Register("fail", func(args []Object) (Object, error) {
+		return nil, nil
+	})
+	err = runtime.Run(program)
+	if err == nil || !strings.Contains(err.Error(), "native function `fail` returned no value") {
+		t.Errorf("expected the missing value. got=%v", err)
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	program := compile(t, "var limit: uint = 3; var count: uint = 0; loop count < limit { count = count + 1; }")
+
+	runtime := NewRuntime()
+	err := runtime.SetGlobal("limit", Uint(5))
+	if !errors.Is(err, ErrNoProgram) {
+		t.Errorf("expected %q. got=%v", ErrNoProgram, err)
+	}
+
+	err = runtime.Run(program)
+	if err != nil {
+		t.Fatalf("run failed: %s", err)
+	}
+	count, _ := runtime.Global("count")
+	if Value(count) != uint64(3) {
+		t.Errorf("wrong count. got=%v", count)
+	}
+
+	tests := []struct {
+		name     string
+		value    Object
+		expected string
+	}{
+		{"missing", Uint(1), "the program declares no global `missing`"},
+		{"count", Bool(true), "cannot set `count` holding a value of type UNSIGNED_INTEGER to a value of type BOOLEAN"},
+		{"count", nil, "cannot set `count` to no value"},
+	}
+	for _, tt := range tests {
+		err := runtime.SetGlobal(tt.name, tt.value)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error setting %s. expected=%q, got=%v", tt.name, tt.expected, err)
+		}
+	}
+
+	err = runtime.SetGlobal("count", Uint(41))
+	if err != nil {
+		t.Fatalf("could not set global: %s", err)
+	}
+	count, _ = runtime.Global("count")
+	if Value(count) != uint64(41) {
+		t.Errorf("global not set. got=%v", count)
+	}
+}
+
+// Values set by the host are seen by the functions it calls afterwards
+func TestCall(t *testing.T) {
+	program := compile(t, `var greeting = "hello";
+var calls: uint = 0;
+fun greet(name: string): string { calls = calls + 1; println(greeting, name); return greeting + " " + name; }
+greet("bob");`)
+
+	var output strings.Builder
+	runtime := NewRuntime(WithOutput(&output))
+	_, err := runtime.Call("greet", String("ann"))
+	if !errors.Is(err, ErrNoProgram) {
+		t.Errorf("expected %q. got=%v", ErrNoProgram, err)
+	}
+
+	err = runtime.Run(program)
+	if err != nil {
+		t.Fatalf("run failed: %s", err)
+	}
+	err = runtime.SetGlobal("greeting", String("hi"))
+	if err != nil {
+		t.Fatalf("could not set global: %s", err)
+	}
+	value, err := runtime.Call("greet", String("ann"))
+	if err != nil {
+		t.Fatalf("call failed: %s", err)
+	}
+	if Value(value) != "hi ann" || output.String() != "hello bob\nhi ann\n" {
+		t.Errorf("host value not used. value=%v, output=%q", value, output.String())
+	}
+	calls, _ := runtime.Global("calls")
+	if Value(calls) != uint64(2) {
+		t.Errorf("global set by the call not kept. got=%v", calls)
+	}
+
+	tests := []struct {
+		name     string
+		args     []Object
+		expected string
+	}{
+		{"missing", nil, "the program declares no function `missing`"},
+		{"greeting", nil, "`greeting` is not a function"},
+		{"greet", []Object{nil}, "cannot call `greet` with no value as argument 1"},
+		{"greet", nil, "wrong number of arguments"},
+	}
+	for _, tt := range tests {
+		_, err := runtime.Call(tt.name, tt.args...)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error calling %s. expected=%q, got=%v", tt.name, tt.expected, err)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	_, err := Compile("var a: bool = 1;")
+	var compileError *CompileError
+	if !errors.As(err, &compileError) || len(compileError.Diagnostics) != 1 {
+		t.Fatalf("expected the diagnostic of the checker. got=%v", err)
+	}
+	if !strings.Contains(err.Error(), "--> <script>:1:15") {
+		t.Errorf("diagnostic not rendered. got=%q", err.Error())
+	}
+
+	_, err = Compile("var a = ;")
+	if !errors.As(err, &compileError) {
+		t.Errorf("expected the diagnostic of the parser. got=%v", err)
+	}
+
+	_, err = Compile("if true {\n\tfun f(): uint { return 1; }\n}")
+	if !errors.As(err, &compileError) || !strings.Contains(err.Error(), "error[C001]") || !strings.Contains(err.Error(), "--> <script>:2:2") {
+		t.Errorf("expected the diagnostic of the compiler. got=%v", err)
+	}
+}
+
+func TestRuntimeLimits(t *testing.T) {
+	program := compile(t, "loop true {}")
+	runtime := NewRuntime(WithMaxInstructions(100))
+	err := runtime.Run(program)
+	if !errors.Is(err, ErrInstructionLimit) {
+		t.Errorf("expected the instruction limit. got=%v", err)
+	}
+}
@@ -0,0 +1,44 @@
+package script
+
+import "atlas/compiler"
+
+// Value of a program, passed to and returned by the functions of the host
+type Object = compiler.Object
+
+func Int(value int64) Object {
+	return &compiler.Integer{Value: value}
+}
+
+func Uint(value uint64) Object {
+	return &compiler.UnsignedInteger{Value: value}
+}
+
+func Float(value float64) Object {
+	return &compiler.Float{Value: value}
+}
+
+func Bool(value bool) Object {
+	return compiler.ParseBooleanFromNative(value)
+}
+
+func String(value string) Object {
+	return &compiler.String{Value: value}
+}
+
+// Go value of an object: int64, uint64, float64, bool or string. Nil for the objects without
+// one, like functions and channels.
+func Value(object Object) any {
+	switch object := object.(type) {
+	case *compiler.Integer:
+		return object.Value
+	case *compiler.UnsignedInteger:
+		return object.Value
+	case *compiler.Float:
+		return object.Value
+	case *compiler.Boolean:
+		return object.Value
+	case *compiler.String:
+		return object.Value
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package vm
+
+import (
+	"atlas/compiler"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"print(1, true); print(2);", "1 true2"},
+		{"println(); println(1, -2, false);", "\n1 -2 false\n"},
+		{"var c = chan(3); send(c, 1); send(c, 2); println(len(c)); recv(c); println(len(c));", "2\n1\n"},
+		{"println(abs(-5), abs(7), abs(-2 * 2));", "5 7 4\n"},
+		{"println(min(3), min(4, 2, 9), max(4, 2, 9));", "3 2 9\n"},
+		{"var a = -1; println(min(a, 5), max(a, 5), max(a, -7));", "-1 5 -1\n"},
+		{"assert(1 < 2); println(1);", "1\n"},
+		{"var x = print(1); return x;", "1null\n"},
+		{"fun print(a: uint): uint { return a; } return print(3);", "3\n"},
+		{"fun show(a: uint): uint { println(a); return a; } var h = spawn show(4); await h;", "4\n"},
+	}
+
+	for _, tt := range tests {
+		output, err := runWithOptions(t, tt.input)
+		if err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		if output != tt.expected {
+			t.Errorf("wrong output for %q. expected=%q, got=%q", tt.input, tt.expected, output)
+		}
+	}
+
+	vm, err := runProgram(t, "var a = -1; max(a, 5);")
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if integer, ok := vm.PoppedGhost().(*compiler.Integer); !ok || integer.Value != 5 {
+		t.Errorf("max of signed and unsigned integers not signed. got=%T (%+v)", vm.PoppedGhost(), vm.PoppedGhost())
+	}
+}
+
+func TestBuiltinErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"assert(1 > 2);", "1:7: assertion failed"},
+		{"panic(42);", "1:6: panic: 42"},
+		{"fun f(x: uint): uint { if x == 0 { panic(false); } return f(x - 1); } f(3);", "panic: false"},
+		{"len(1);", "cannot take the length of a value of type `UNSIGNED_INTEGER`"},
+		{"abs(true);", "cannot apply `abs` on a value of type `BOOLEAN`"},
+		{"abs(1, 2);", "wrong number of arguments when calling `abs`: expected 1, got 2"},
+		{"min();", "wrong number of arguments when calling `min`: expected at least 1, got 0"},
+		{"var a = -1; max(a, 18446744073709551615);", "overflow error when converting `18446744073709551615` to a signed integer"},
+		{"var a = -9223372036854775807; abs(a - 1);", "overflow error when trying to apply `abs` on `-9223372036854775808`"},
+		{"var h = spawn print(1);", "cannot spawn a value of type `BUILTIN`"},
+	}
+
+	for _, tt := range tests {
+		_, err := runWithOptions(t, tt.input)
+		if err == nil {
+			t.Fatalf("expected error for %q", tt.input)
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+
+	_, err := runWithOptions(t, "assert(false);")
+	if !errors.Is(err, compiler.ErrAssertion) {
+		t.Errorf("expected %q. got=%v", compiler.ErrAssertion, err)
+	}
+}
+
+// Built-in functions waiting on the stack for their arguments are saved by snapshots
+func TestSnapshotWithBuiltins(t *testing.T) {
+	byteCode := compileProgram(t, "fun f(): uint { return 7; } var h = spawn f(); println(1, await h);", false)
+
+	for limit := 1; limit < 20; limit++ {
+		var before strings.Builder
+		machine := New(byteCode, WithQuantum(1), WithMaxInstructions(limit), WithOutput(&before))
+		err := machine.Run()
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrInstructionLimit) {
+			t.Fatalf("expected the instruction limit after %d instructions. got=%v", limit, err)
+		}
+		snapshot, err := machine.Snapshot()
+		if err != nil {
+			t.Fatalf("could not snapshot after %d instructions: %s", limit, err)
+		}
+
+		var after strings.Builder
+		restored, err := Restore(byteCode, snapshot, WithQuantum(1), WithOutput(&after))
+		if err != nil {
+			t.Fatalf("could not restore after %d instructions: %s", limit, err)
+		}
+		err = restored.Run()
+		if err != nil {
+			t.Fatalf("vm error after restoring at %d instructions: %s", limit, err)
+		}
+		if before.String()+after.String() != "1 7\n" {
+			t.Errorf("wrong output when stopping after %d instructions. got=%q+%q", limit, before.String(), after.String())
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package vm
+
+import (
+	"atlas/compiler"
+	"fmt"
+)
+
+func (vm *VM) makeChannel() error {
+	capacity := vm.pop()
+	if !compiler.IsObjectNumber(capacity) {
+		return fmt.Errorf("channel capacity must be an integer, got `%s`", capacity.Type())
+	}
+	value, err := signedValue(capacity)
+	if err != nil {
+		return err
+	}
+	if value < 0 {
+		return fmt.Errorf("negative channel capacity `%d`", value)
+	}
+	return vm.push(compiler.NewChannel(int(value)))
+}
+
+// Arrays and maps are sent as copies, the receiving task may run on another goroutine or node
+func (vm *VM) sendOnChannel() error {
+	value := compiler.DeepCopy(vm.pop())
+	channel, err := vm.popChannel("send on")
+	if err != nil {
+		return err
+	}
+	return vm.block(&blocking{instruction: compiler.SEND, op: channel.Send(value), external: channel.IsProxy()})
+}
+
+// Receives from the channel on top of the stack. Once the channel is closed and empty, the
+// constant at zeroIndex is received instead.
+func (vm *VM) receiveFromChannel(zeroIndex int) error {
+	channel, err := vm.popChannel("receive from")
+	if err != nil {
+		return err
+	}
+	return vm.block(&blocking{instruction: compiler.RECV, op: channel.Recv(), zeroIndex: zeroIndex, external: channel.IsProxy()})
+}
+
+func (vm *VM) closeChannel() error {
+	channel, err := vm.popChannel("close")
+	if err != nil {
+		return err
+	}
+	return vm.block(&blocking{instruction: compiler.CLOSE, op: channel.Close(), external: channel.IsProxy()})
+}
+
+func (vm *VM) popChannel(operation string) (*compiler.Channel, error) {
+	operand := vm.pop()
+	channel, ok := operand.(*compiler.Channel)
+	if !ok {
+		return nil, fmt.Errorf("cannot %s a value of type `%s`", operation, operand.Type())
+	}
+	return channel, nil
+}
@@ -0,0 +1,117 @@
+package vm
+
+import (
+	"atlas/compiler"
+	"fmt"
+	"strconv"
+)
+
+// Replaces the count values on top of the stack with an array of them, the first one pushed first
+func (vm *VM) makeArray(count int) error {
+	elements := make([]compiler.Object, count)
+	copy(elements, vm.stack[vm.sp-count:vm.sp])
+	vm.sp -= count
+	return vm.push(&compiler.Array{Elements: elements})
+}
+
+// Replaces the count pairs of keys and values on top of the stack with a map of them. A key
+// written twice keeps its last value.
+func (vm *VM) makeMap(count int) error {
+	hashMap := compiler.NewMap()
+	for i := vm.sp - 2*count; i < vm.sp; i += 2 {
+		hashKey, err := mapKey(vm.stack[i])
+		if err != nil {
+			return err
+		}
+		hashMap.Pairs[hashKey] = compiler.MapPair{Key: vm.stack[i], Value: vm.stack[i+1]}
+	}
+	vm.sp -= 2 * count
+	return vm.push(hashMap)
+}
+
+func (vm *VM) getIndex() error {
+	index := vm.pop()
+	switch collection := vm.pop().(type) {
+	case *compiler.Array:
+		position, err := arrayPosition(collection, index)
+		if err != nil {
+			return err
+		}
+		return vm.push(collection.Elements[position])
+	case *compiler.Map:
+		hashKey, err := mapKey(index)
+		if err != nil {
+			return err
+		}
+		pair, ok := collection.Pairs[hashKey]
+		if !ok {
+			return fmt.Errorf("key %s not found in map", inspectKey(index))
+		}
+		return vm.push(pair.Value)
+	default:
+		return fmt.Errorf("cannot index a value of type `%s`", collection.Type())
+	}
+}
+
+func (vm *VM) setIndex() error {
+	value := vm.pop()
+	index := vm.pop()
+	switch collection := vm.pop().(type) {
+	case *compiler.Array:
+		position, err := arrayPosition(collection, index)
+		if err != nil {
+			return err
+		}
+		collection.Elements[position] = value
+	case *compiler.Map:
+		hashKey, err := mapKey(index)
+		if err != nil {
+			return err
+		}
+		collection.Pairs[hashKey] = compiler.MapPair{Key: index, Value: value}
+	default:
+		return fmt.Errorf("cannot assign to an index of a value of type `%s`", collection.Type())
+	}
+	return nil
+}
+
+// Position of the element of array at index, which must be an integer within its bounds
+func arrayPosition(array *compiler.Array, index compiler.Object) (int, error) {
+	switch index := index.(type) {
+	case *compiler.Integer:
+		if index.Value >= 0 && index.Value < int64(len(array.Elements)) {
+			return int(index.Value), nil
+		}
+		return 0, fmt.Errorf("index %d out of bounds for array of length %d", index.Value, len(array.Elements))
+	case *compiler.UnsignedInteger:
+		if index.Value < uint64(len(array.Elements)) {
+			return int(index.Value), nil
+		}
+		return 0, fmt.Errorf("index %d out of bounds for array of length %d", index.Value, len(array.Elements))
+	}
+	return 0, fmt.Errorf("array index must be an integer, got `%s`", index.Type())
+}
+
+func mapKey(key compiler.Object) (compiler.HashKey, error) {
+	hashable, ok := key.(compiler.Hashable)
+	if !ok {
+		return compiler.HashKey{}, fmt.Errorf("cannot use a value of type `%s` as map key", key.Type())
+	}
+	return hashable.HashKey(), nil
+}
+
+// Strings are quoted, so that the empty string shows
+func inspectKey(key compiler.Object) string {
+	if str, ok := key.(*compiler.String); ok {
+		return strconv.Quote(str.Value)
+	}
+	return key.Inspect()
+}
+
+// Copies the arrays and maps among values, which leave the task for another one that must not
+// share them
+func copyCollections(values []compiler.Object) {
+	for i, value := range values {
+		values[i] = compiler.DeepCopy(value)
+	}
+}
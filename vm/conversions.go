@@ -0,0 +1,101 @@
+package vm
+
+import (
+	"atlas/compiler"
+	"fmt"
+	"math"
+)
+
+// Replaces the value on top of the stack with its conversion to the type of the object tag.
+// Conversions fail rather than give a value the converted one does not have.
+func (vm *VM) executeConversion(tag byte) error {
+	value := vm.pop()
+	var converted compiler.Object
+	var err error
+	switch tag {
+	case compiler.TAG_INTEGER:
+		var signed int64
+		signed, err = signedValue(value)
+		converted = &compiler.Integer{Value: signed}
+	case compiler.TAG_UNSIGNED_INTEGER:
+		var unsigned uint64
+		unsigned, err = unsignedValue(value)
+		converted = &compiler.UnsignedInteger{Value: unsigned}
+	case compiler.TAG_FLOAT:
+		float, ok := compiler.FloatValue(value)
+		if boolean, isBoolean := value.(*compiler.Boolean); isBoolean {
+			float, ok = boolToNumber[float64](boolean), true
+		}
+		if !ok {
+			return fmt.Errorf("cannot convert a value of type `%s` to `%s`", value.Type(), compiler.FLOAT)
+		}
+		converted = &compiler.Float{Value: float}
+	case compiler.TAG_BOOLEAN:
+		if boolean, ok := value.(*compiler.Boolean); ok {
+			converted = boolean
+			break
+		}
+		float, ok := compiler.FloatValue(value)
+		if !ok {
+			return fmt.Errorf("cannot convert a value of type `%s` to `%s`", value.Type(), compiler.BOOLEAN)
+		}
+		converted = compiler.ParseBooleanFromNative(float != 0)
+	default:
+		return fmt.Errorf("unknown conversion to object tag %d", tag)
+	}
+	if err != nil {
+		return err
+	}
+	return vm.push(converted)
+}
+
+// Value of an integer, float or boolean as a signed integer. Floats are truncated, values out
+// of range are errors instead of being reinterpreted.
+func signedValue(value compiler.Object) (int64, error) {
+	switch value := value.(type) {
+	case *compiler.Integer:
+		return value.Value, nil
+	case *compiler.UnsignedInteger:
+		if value.Value > math.MaxInt64 {
+			return 0, fmt.Errorf("overflow error when converting `%d` to a signed integer", value.Value)
+		}
+		return int64(value.Value), nil
+	case *compiler.Float:
+		// -2^63 is exact as a float, 2^63 is the first float above the range
+		if math.IsNaN(value.Value) || value.Value < math.MinInt64 || value.Value >= math.MaxInt64 {
+			return 0, fmt.Errorf("overflow error when converting `%s` to a signed integer", value.Inspect())
+		}
+		return int64(value.Value), nil
+	case *compiler.Boolean:
+		return boolToNumber[int64](value), nil
+	}
+	return 0, fmt.Errorf("cannot convert a value of type `%s` to `%s`", value.Type(), compiler.INTEGER)
+}
+
+func unsignedValue(value compiler.Object) (uint64, error) {
+	switch value := value.(type) {
+	case *compiler.UnsignedInteger:
+		return value.Value, nil
+	case *compiler.Integer:
+		if value.Value < 0 {
+			return 0, fmt.Errorf("overflow error when converting `%d` to an unsigned integer", value.Value)
+		}
+		return uint64(value.Value), nil
+	case *compiler.Float:
+		// Truncation toward zero keeps the floats above -1
+		if math.IsNaN(value.Value) || value.Value <= -1 || value.Value >= math.MaxUint64 {
+			return 0, fmt.Errorf("overflow error when converting `%s` to an unsigned integer", value.Inspect())
+		}
+		return uint64(value.Value), nil
+	case *compiler.Boolean:
+		return boolToNumber[uint64](value), nil
+	}
+	return 0, fmt.Errorf("cannot convert a value of type `%s` to `%s`", value.Type(), compiler.UNSIGNED_INTEGER)
+}
+
+func boolToNumber[T int64 | uint64 | float64](boolean *compiler.Boolean) T {
+	if boolean.Value {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,136 @@
+package vm
+
+import (
+	"atlas/compiler"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Error raised while running an instruction, located in the source it was compiled from
+type RuntimeError struct {
+	Err      error
+	Function string // Name of the function running the instruction, "main" at top level
+	File     string
+	Row      int
+	Col      int
+	Line     string // Source line of the instruction, empty if the source is unknown
+}
+
+func (err *RuntimeError) Error() string {
+	var message strings.Builder
+	if err.File != "" {
+		fmt.Fprintf(&message, "%s:", err.File)
+	}
+
+	// The error of a spawned call is located in the source too, it is shown after the await
+	var spawnError *SpawnError
+	if errors.As(err.Err, &spawnError) {
+		fmt.Fprintf(&message, "%d:%d: spawned call to `%s` failed", err.Row, err.Col, spawnError.Function)
+	} else {
+		fmt.Fprintf(&message, "%d:%d: %s", err.Row, err.Col, err.Err)
+	}
+
+	if err.Line != "" {
+		gutter := fmt.Sprintf("%d", err.Row)
+		fmt.Fprintf(&message, "\n %s | %s", gutter, err.Line)
+		fmt.Fprintf(&message, "\n %s | %s^", strings.Repeat(" ", len(gutter)), caretIndent(err.Line, err.Col))
+	}
+	if spawnError != nil {
+		fmt.Fprintf(&message, "\ncaused by: %s", spawnError.Err)
+	}
+	return message.String()
+}
+
+func (err *RuntimeError) Unwrap() error {
+	return err.Err
+}
+
+// Failure of a spawned call, raised where its future is awaited
+type SpawnError struct {
+	Function string
+	Err      error
+}
+
+func (err *SpawnError) Error() string {
+	return fmt.Sprintf("spawned call to `%s` failed: %s", err.Function, err.Err)
+}
+
+func (err *SpawnError) Unwrap() error {
+	return err.Err
+}
+
+var ErrInstructionLimit = errors.New("instruction limit reached")
+var ErrStackLimit = errors.New("stack limit reached")
+var ErrGlobalsLimit = errors.New("globals limit reached")
+
+// Limit hit by a run, set by the options of the VM or by its context. The VM stops before
+// the instruction at Offset, leaving it for the next run: calling RunContext again with a new
+// context, or restoring a snapshot with other limits, goes on from there.
+type LimitError struct {
+	Err      error // ErrInstructionLimit, ErrStackLimit, ErrGlobalsLimit or the error of the context
+	Function string
+	Offset   int // Offset of the instruction in the instructions of Function
+}
+
+func (err *LimitError) Error() string {
+	return fmt.Sprintf("%s at offset %d of `%s`", err.Err, err.Offset, err.Function)
+}
+
+func (err *LimitError) Unwrap() error {
+	return err.Err
+}
+
+// Blanks the characters before col, keeping tabs so that the caret stays aligned
+func caretIndent(line string, col int) string {
+	var indent strings.Builder
+	for i := 0; i < col-1 && i < len(line); i++ {
+		if line[i] == '\t' {
+			indent.WriteByte('\t')
+		} else {
+			indent.WriteByte(' ')
+		}
+	}
+	return indent.String()
+}
+
+// Wraps err in a RuntimeError located at the instruction at ip of frame. The error is
+// returned as is when the bytecode has no debug information.
+func (vm *VM) locateError(err error, frame *Frame, ip int) error {
+	if vm.debug == nil {
+		return err
+	}
+	position, ok := vm.lines[frame.function].Lookup(ip)
+	if !ok {
+		return err
+	}
+
+	runtimeError := &RuntimeError{
+		Err:      err,
+		Function: frame.function.Name,
+		File:     vm.debug.File,
+		Row:      position.Row,
+		Col:      position.Col,
+	}
+	sourceLines := strings.Split(vm.debug.Source, "\n")
+	if position.Row-1 < len(sourceLines) {
+		runtimeError.Line = strings.TrimRight(sourceLines[position.Row-1], "\r")
+	}
+	return runtimeError
+}
+
+// Line tables of the main function and of the functions in the constant pool
+func functionLines(mainFunction *compiler.CompiledFunction, byteCode compiler.ByteCode) map[*compiler.CompiledFunction]compiler.LineTable {
+	lines := map[*compiler.CompiledFunction]compiler.LineTable{
+		mainFunction: byteCode.Debug.Lines,
+	}
+	for index, table := range byteCode.Debug.FunctionLines {
+		if index >= len(byteCode.Constants) {
+			continue
+		}
+		if function, ok := byteCode.Constants[index].(*compiler.CompiledFunction); ok {
+			lines[function] = table
+		}
+	}
+	return lines
+}
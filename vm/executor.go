@@ -0,0 +1,98 @@
+package vm
+
+import (
+	"atlas/compiler"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Runs the calls spawned by programs instead of the scheduler of the VM. Spawn must not
+// block: the outcome of the call is delivered through the returned future.
+type Executor interface {
+	Spawn(call *Call) *compiler.Future
+}
+
+// Function call spawned by a program, with everything needed to run it apart from the VM
+// that spawned it. Globals are a snapshot taken when the call was spawned: the call and its
+// spawner do not see the globals set by each other afterwards.
+type Call struct {
+	Function  *compiler.CompiledFunction
+	Args      []compiler.Object
+	Constants []compiler.Object // Constants of the program the function belongs to
+	Globals   []compiler.Object // Up to the last global set
+	Debug     *compiler.DebugInfo
+	Input     io.Reader
+	Output    io.Writer
+}
+
+// Runs the call in a new VM, returning the value of the function
+func (call *Call) Run(options ...Option) (compiler.Object, error) {
+	byteCode := compiler.ByteCode{
+		Instructions: compiler.MakeInstruction(compiler.CALL, len(call.Args)),
+		Constants:    call.Constants,
+	}
+	if call.Debug != nil {
+		// The main function is the CALL above, it has no place in the source
+		debug := *call.Debug
+		debug.Lines = nil
+		byteCode.Debug = &debug
+	}
+
+	globals := make([]compiler.Object, GLOBALS_SIZE)
+	copy(globals, call.Globals)
+
+	if call.Input != nil {
+		options = append([]Option{WithInput(call.Input)}, options...)
+	}
+	if call.Output != nil {
+		options = append([]Option{WithOutput(call.Output)}, options...)
+	}
+	machine := NewWithGlobals(byteCode, globals, options...)
+
+	err := machine.push(call.Function)
+	for _, arg := range call.Args {
+		if err == nil {
+			err = machine.push(arg)
+		}
+	}
+	if err == nil {
+		err = machine.Run()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return machine.StackTop(), nil
+}
+
+// Serializes the writes of a VM and of the calls it spawned, which share its output
+type syncWriter struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+func (writer *syncWriter) Write(data []byte) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	return writer.writer.Write(data)
+}
+
+// Serializes the reads of a VM and of the calls it spawned, which share its input
+type syncReader struct {
+	mutex  sync.Mutex
+	reader io.Reader
+}
+
+func (reader *syncReader) Read(data []byte) (int, error) {
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+	return reader.reader.Read(data)
+}
+
+// Reads the next value separated by spaces or new lines into target
+func (reader *syncReader) scan(target any) error {
+	reader.mutex.Lock()
+	defer reader.mutex.Unlock()
+	_, err := fmt.Fscan(reader.reader, target)
+	return err
+}
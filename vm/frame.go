@@ -0,0 +1,22 @@
+package vm
+
+import "atlas/compiler"
+
+// Call frame of a running function
+type Frame struct {
+	function    *compiler.CompiledFunction
+	ip          int // Offset of the instruction being executed, also the return address of callees
+	basePointer int // Stack index of the first local, locals are stored right above it
+}
+
+func NewFrame(function *compiler.CompiledFunction, basePointer int) *Frame {
+	return &Frame{
+		function:    function,
+		ip:          -1,
+		basePointer: basePointer,
+	}
+}
+
+func (frame *Frame) Instructions() compiler.Instructions {
+	return frame.function.Instructions
+}
@@ -0,0 +1,139 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInstructionLimit(t *testing.T) {
+	byteCode := compileProgram(t, "var i: uint = 0; loop true { i = i + 1; }", false)
+	machine := New(byteCode, WithMaxInstructions(1000))
+	err := machine.Run()
+
+	var limitError *LimitError
+	if !errors.As(err, &limitError) || !errors.Is(err, ErrInstructionLimit) {
+		t.Fatalf("expected the instruction limit. got=%T (%v)", err, err)
+	}
+	if limitError.Function != "main" || limitError.Offset < 0 || limitError.Offset >= len(byteCode.Instructions) {
+		t.Errorf("wrong location of the limit. got=%+v", limitError)
+	}
+	if machine.executed != 1000 {
+		t.Errorf("wrong number of instructions run. got=%d", machine.executed)
+	}
+
+	// Spawned tasks share the budget of the VM
+	byteCode = compileProgram(t, "fun spin(): uint { loop true {} return 0; } var a = spawn spin(); await a;", false)
+	machine = New(byteCode, WithMaxInstructions(5000))
+	err = machine.Run()
+	if !errors.As(err, &limitError) || limitError.Function != "spin" {
+		t.Errorf("expected the instruction limit in the spawned task. got=%v", err)
+	}
+}
+
+func TestDeadlineAndCancellation(t *testing.T) {
+	byteCode := compileProgram(t, "loop true {}", false)
+	machine := New(byteCode, WithDeadline(time.Now().Add(20*time.Millisecond)))
+	err := machine.Run()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to stop the run. got=%v", err)
+	}
+
+	machine = New(byteCode)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	err = machine.RunContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the cancellation to stop the run. got=%v", err)
+	}
+
+	// Tasks waiting for a call are stopped too
+	byteCode = compileProgram(t, "fun f(): uint { return 1; } var a = spawn f(); await a;", false)
+	machine = New(byteCode, WithExecutor(stalledExecutor{}))
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = machine.RunContext(ctx)
+	var limitError *LimitError
+	if !errors.As(err, &limitError) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to stop the waiting task. got=%v", err)
+	}
+	if machine.current != machine.main {
+		t.Errorf("main task not current after the run stopped")
+	}
+}
+
+func TestStackAndGlobalsLimits(t *testing.T) {
+	byteCode := compileProgram(t, "fun down(n: uint): uint { if n == 0 { return 0; } return down(n - 1); } return down(100);", false)
+	machine := New(byteCode, WithMaxStack(64), WithOutput(&strings.Builder{}))
+	err := machine.Run()
+	if !errors.Is(err, ErrStackLimit) {
+		t.Errorf("expected the stack limit. got=%v", err)
+	}
+
+	byteCode = compileProgram(t, "var a = 1; var b = 2; var c = 3;", false)
+	machine = New(byteCode, WithMaxGlobals(2))
+	err = machine.Run()
+	var limitError *LimitError
+	if !errors.As(err, &limitError) || !errors.Is(err, ErrGlobalsLimit) {
+		t.Fatalf("expected the globals limit. got=%v", err)
+	}
+	// Stopped before the GLOBAL_SET of c, after the CONST of its value
+	if limitError.Offset != 15 {
+		t.Errorf("wrong offset of the limit. got=%d", limitError.Offset)
+	}
+}
+
+// Runs stopped by a limit go on from where they stopped
+func TestRunsGoOnAfterLimits(t *testing.T) {
+	byteCode := compileProgram(t, SNAPSHOT_PROGRAM, false)
+
+	var expected strings.Builder
+	machine := New(byteCode, WithQuantum(3), WithOutput(&expected))
+	err := machine.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	for _, limit := range []int{1, 10, 50, 100, 200} {
+		var before strings.Builder
+		machine := New(byteCode, WithQuantum(3), WithMaxInstructions(limit), WithOutput(&before))
+		err := machine.Run()
+		if !errors.Is(err, ErrInstructionLimit) {
+			t.Fatalf("expected the instruction limit after %d instructions. got=%v", limit, err)
+		}
+
+		snapshot, err := machine.Snapshot()
+		if err != nil {
+			t.Fatalf("could not snapshot after %d instructions: %s", limit, err)
+		}
+		var after strings.Builder
+		restored, err := Restore(byteCode, snapshot, WithQuantum(3), WithOutput(&after))
+		if err != nil {
+			t.Fatalf("could not restore after %d instructions: %s", limit, err)
+		}
+		err = restored.Run()
+		if err != nil {
+			t.Fatalf("vm error after restoring at %d instructions: %s", limit, err)
+		}
+		if before.String()+after.String() != expected.String() {
+			t.Errorf("wrong output when stopping after %d instructions. expected=%q, got=%q+%q", limit, expected.String(), before.String(), after.String())
+		}
+	}
+
+	// A cancelled run goes on with the next context
+	var output strings.Builder
+	machine = New(byteCode, WithQuantum(3), WithOutput(&output))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = machine.RunContext(ctx)
+	var limitError *LimitError
+	if !errors.As(err, &limitError) || limitError.Offset != 0 {
+		t.Fatalf("expected the run to stop before the first instruction. got=%v", err)
+	}
+	err = machine.Run()
+	if err != nil || output.String() != expected.String() {
+		t.Errorf("wrong run after the cancellation. err=%v, output=%q", err, output.String())
+	}
+}
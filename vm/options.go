@@ -0,0 +1,93 @@
+package vm
+
+import (
+	"io"
+	"math/rand"
+	"time"
+)
+
+// Configures a VM when it is created
+type Option func(vm *VM)
+
+// Reads the values of `in` statements from input. Without it the VM has no input and `in`
+// fails, the CLI gives it stdin.
+func WithInput(input io.Reader) Option {
+	return func(vm *VM) {
+		// The input of a spawned call is already shared with the VM that spawned it
+		if reader, ok := input.(*syncReader); ok {
+			vm.input = reader
+			return
+		}
+		vm.input = &syncReader{reader: input}
+	}
+}
+
+// Writes the values printed by the program to output instead of stdout
+func WithOutput(output io.Writer) Option {
+	return func(vm *VM) {
+		vm.output = output
+	}
+}
+
+// Hands the calls spawned by the program to executor instead of running them as tasks of the VM
+func WithExecutor(executor Executor) Option {
+	return func(vm *VM) {
+		vm.executor = executor
+	}
+}
+
+// Lets tasks run quantum instructions before another one gets its turn, instead of QUANTUM.
+// Values below 1 are ignored.
+func WithQuantum(quantum int) Option {
+	return func(vm *VM) {
+		if quantum > 0 {
+			vm.quantum = quantum
+		}
+	}
+}
+
+// Picks the task to run next at random, from a generator seeded with seed, instead of running
+// tasks in turn. Runs with the same seed interleave the tasks the same way, as long as they do
+// not wait for reads or for calls of another executor.
+func WithSeed(seed int64) Option {
+	return func(vm *VM) {
+		vm.random = rand.New(rand.NewSource(seed))
+	}
+}
+
+// Stops the run with a LimitError once count instructions ran, counting the instructions of
+// every task since the VM was created or restored. Values below 1 are ignored.
+func WithMaxInstructions(count int) Option {
+	return func(vm *VM) {
+		if count > 0 {
+			vm.maxInstructions = count
+		}
+	}
+}
+
+// Stops the run with a LimitError once deadline passed, like a context with this deadline
+func WithDeadline(deadline time.Time) Option {
+	return func(vm *VM) {
+		vm.deadline = deadline
+	}
+}
+
+// Stops the run with a LimitError when a task needs more than size values on its stack,
+// instead of failing past STACK_SIZE. Values below 1 are ignored.
+func WithMaxStack(size int) Option {
+	return func(vm *VM) {
+		if size > 0 {
+			vm.maxStack = size
+		}
+	}
+}
+
+// Stops the run with a LimitError when the program sets a global with an index of count or
+// more. Values below 1 are ignored.
+func WithMaxGlobals(count int) Option {
+	return func(vm *VM) {
+		if count > 0 {
+			vm.maxGlobals = count
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package vm
+
+import (
+	"atlas/compiler"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+const QUANTUM int = 1000          // Instructions a task runs before another one gets its turn
+const INITIAL_STACK_SIZE int = 32 // Stacks grow as needed, up to STACK_SIZE
+
+var ErrDeadlock = errors.New("all tasks are blocked: deadlock")
+
+// Lightweight thread of a program, run by the VM in turn with the others. The main task runs
+// the program itself, the other ones run spawned calls. The registers of the running task are
+// held by the VM and saved here when it leaves the processor.
+type task struct {
+	stack       []compiler.Object
+	sp          int
+	frames      []*Frame
+	framesIndex int
+	globals     []compiler.Object // Snapshot taken when the call was spawned, like for other executors
+
+	future  *compiler.Future // Resolved with the value of the call when the task ends, nil for the main task
+	blocked *blocking        // Set while the task is parked
+}
+
+// Instruction a task is parked on, until its channel operation, read or future completes
+type blocking struct {
+	instruction compiler.OpCode     // SEND, RECV, CLOSE, IN or AWAIT
+	op          *compiler.ChannelOp // Completed with the outcome of the instruction, but for AWAIT
+	future      *compiler.Future
+	zeroIndex   int  // Operand of RECV
+	external    bool // Completed from outside the VM, like a read or a remote channel operation
+	frame       *Frame
+	ip          int
+}
+
+func (blocked *blocking) done() <-chan struct{} {
+	if blocked.future != nil {
+		return blocked.future.Done()
+	}
+	return blocked.op.Done()
+}
+
+// Creates the task running a spawned call and queues it after the ready ones
+func (vm *VM) spawnTask(function *compiler.CompiledFunction, args []compiler.Object, globals []compiler.Object) *compiler.Future {
+	entry := &compiler.CompiledFunction{Name: function.Name, Instructions: compiler.MakeInstruction(compiler.CALL, len(args))}
+
+	stack := make([]compiler.Object, max(INITIAL_STACK_SIZE, len(args)+1))
+	stack[0] = function
+	copy(stack[1:], args)
+
+	spawned := &task{
+		stack:       stack,
+		sp:          len(args) + 1,
+		frames:      []*Frame{NewFrame(entry, 0)},
+		framesIndex: 1,
+		globals:     globals,
+		future:      compiler.NewFuture(function.Name),
+	}
+	vm.spawned[spawned.future] = true
+	vm.ready = append(vm.ready, spawned)
+	return spawned.future
+}
+
+// Runs the tasks until the main one ends. Tasks still running then are abandoned.
+func (vm *VM) Run() error {
+	return vm.RunContext(context.Background())
+}
+
+// Runs the tasks like Run until ctx is done, which stops the VM with a LimitError. The run
+// goes on from there when RunContext is called again.
+func (vm *VM) RunContext(ctx context.Context) error {
+	if !vm.deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, vm.deadline)
+		defer cancel()
+	}
+
+	for {
+		ended, err := vm.step(ctx)
+		if ended || err != nil {
+			return err
+		}
+	}
+}
+
+// Runs the current task for a quantum, then switches to the next one. Returns true once the
+// main task ended.
+func (vm *VM) step(ctx context.Context) (bool, error) {
+	err := ctx.Err()
+	if err != nil {
+		return false, vm.stop(err)
+	}
+
+	current := vm.current
+	finished, err := vm.runCurrent()
+	if isLimitError(err) {
+		// The task stays the current one, to go on with the next run
+		return false, err
+	}
+	if current == vm.main && (finished || err != nil) {
+		return true, err
+	}
+
+	switch {
+	case finished || err != nil:
+		vm.endTask(current, err)
+	case current.blocked != nil:
+		vm.parked = append(vm.parked, current)
+	default:
+		vm.ready = append(vm.ready, current)
+	}
+
+	next, err := vm.nextTask(ctx)
+	if err != nil {
+		// The main task is parked, otherwise it would be ready or the run over
+		vm.unpark(vm.main)
+		vm.switchTo(vm.main)
+		if errors.Is(err, ErrDeadlock) {
+			blocked := vm.main.blocked
+			return true, vm.locateError(err, blocked.frame, blocked.ip)
+		}
+		return false, vm.stop(err)
+	}
+	vm.switchTo(next)
+	return false, nil
+}
+
+// Limits hit by this VM, not by the VMs of the calls it spawned
+func isLimitError(err error) bool {
+	var spawnError *SpawnError
+	var limitError *LimitError
+	return !errors.As(err, &spawnError) && errors.As(err, &limitError)
+}
+
+// Stops the run at the next instruction of the current task, or at the one it is parked on
+func (vm *VM) stop(err error) error {
+	frame, ip := vm.currentFrame(), vm.currentFrame().ip+1
+	if blocked := vm.current.blocked; blocked != nil {
+		frame, ip = blocked.frame, blocked.ip
+	}
+	limitError := &LimitError{Err: err, Function: frame.function.Name, Offset: ip}
+	return vm.locateError(limitError, frame, ip)
+}
+
+// Runs the current task for a quantum, after finishing the instruction it was parked on.
+// Returns true once the task ended. A task still parked, like when a run resumes, does not run.
+func (vm *VM) runCurrent() (bool, error) {
+	if blocked := vm.current.blocked; blocked != nil {
+		select {
+		case <-blocked.done():
+		default:
+			return false, nil
+		}
+
+		vm.current.blocked = nil
+		err := vm.finish(blocked)
+		if err != nil {
+			return false, vm.locateError(err, blocked.frame, blocked.ip)
+		}
+	}
+	return vm.execute(vm.quantum)
+}
+
+func (vm *VM) endTask(ended *task, err error) {
+	var value compiler.Object
+	if err == nil {
+		value = vm.StackTop()
+	}
+	delete(vm.spawned, ended.future)
+	ended.future.Resolve(value, err)
+}
+
+// Parks the current task until the instruction can complete. The task goes on right away
+// when it already can.
+func (vm *VM) block(blocked *blocking) error {
+	select {
+	case <-blocked.done():
+		return vm.finish(blocked)
+	default:
+	}
+	vm.current.blocked = blocked
+	return nil
+}
+
+// Completes the instruction the current task was blocked on
+func (vm *VM) finish(blocked *blocking) error {
+	if blocked.instruction == compiler.AWAIT {
+		value, err := blocked.future.Wait()
+		if err != nil {
+			return &SpawnError{Function: blocked.future.Function, Err: err}
+		}
+		return vm.push(value)
+	}
+
+	value, received, err := blocked.op.Wait()
+	if err != nil {
+		return err
+	}
+	switch blocked.instruction {
+	case compiler.RECV:
+		if !received {
+			if blocked.zeroIndex == compiler.NO_ZERO_VALUE {
+				return fmt.Errorf("receive from closed channel")
+			}
+			value = vm.constants[blocked.zeroIndex]
+		}
+		return vm.push(value)
+	case compiler.IN:
+		return vm.push(value)
+	}
+	return nil
+}
+
+// Picks the task to run next, waiting for a parked one to be woken if none is ready. Fails
+// with ErrDeadlock when none can be, or with the error of ctx when it is done first.
+func (vm *VM) nextTask(ctx context.Context) (*task, error) {
+	for {
+		vm.wakeParked()
+		if len(vm.ready) > 0 {
+			index := 0
+			if vm.random != nil {
+				index = vm.random.Intn(len(vm.ready))
+			}
+			next := vm.ready[index]
+			vm.ready = append(vm.ready[:index], vm.ready[index+1:]...)
+			return next, nil
+		}
+
+		if !vm.waitForEvent(ctx) {
+			return nil, ErrDeadlock
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (vm *VM) unpark(waiting *task) {
+	for index, parked := range vm.parked {
+		if parked == waiting {
+			vm.parked = append(vm.parked[:index], vm.parked[index+1:]...)
+			return
+		}
+	}
+}
+
+// Makes the parked tasks whose instruction can be finished ready, in the order they were parked
+func (vm *VM) wakeParked() {
+	parked := vm.parked[:0]
+	for _, waiting := range vm.parked {
+		select {
+		case <-waiting.blocked.done():
+			vm.ready = append(vm.ready, waiting)
+		default:
+			parked = append(parked, waiting)
+		}
+	}
+	vm.parked = parked
+}
+
+// Blocks until something happens outside the VM: a read, a remote channel operation, a call
+// handed to the executor or the end of ctx. Returns false when only tasks of the VM could
+// wake the parked ones, which then wait for each other forever.
+func (vm *VM) waitForEvent(ctx context.Context) bool {
+	vm.prunePending()
+
+	// Calls of the executor may use the channels the tasks are parked on
+	external := len(vm.pending) > 0
+	cases := []reflect.SelectCase{}
+	for _, waiting := range vm.parked {
+		external = external || waiting.blocked.external
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(waiting.blocked.done())})
+	}
+	if !external {
+		return false
+	}
+
+	for _, future := range vm.pending {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(future.Done())})
+	}
+	if ctx.Done() != nil {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())})
+	}
+	reflect.Select(cases)
+	return true
+}
+
+// Forgets the calls of the executor that ended
+func (vm *VM) prunePending() {
+	pending := vm.pending[:0]
+	for _, future := range vm.pending {
+		select {
+		case <-future.Done():
+		default:
+			pending = append(pending, future)
+		}
+	}
+	vm.pending = pending
+}
+
+// Saves the registers of the running task and loads the ones of next
+func (vm *VM) switchTo(next *task) {
+	if next == vm.current {
+		return
+	}
+	vm.saveRegisters()
+	vm.loadRegisters(next)
+}
+
+func (vm *VM) saveRegisters() {
+	current := vm.current
+	current.stack, current.sp, current.globals = vm.stack, vm.sp, vm.globals
+	current.frames, current.framesIndex = vm.frames, vm.framesIndex
+}
+
+func (vm *VM) loadRegisters(next *task) {
+	vm.stack, vm.sp, vm.globals = next.stack, next.sp, next.globals
+	vm.frames, vm.framesIndex = next.frames, next.framesIndex
+	vm.current = next
+}
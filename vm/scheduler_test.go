@@ -0,0 +1,116 @@
+package vm
+
+import (
+	"errors"
+	"testing"
+)
+
+// Each worker sends its id three times, the program prints the ids in the order they were sent
+const INTERLEAVING_PROGRAM = `fun worker(c: chan uint, id: uint): uint {
+	var i: uint = 0;
+	loop i < 3 { send(c, id); i = i + 1; }
+	return 0;
+}
+var c = chan(9);
+var a = spawn worker(c, 1);
+var b = spawn worker(c, 2);
+var d = spawn worker(c, 3);
+await a; await b; await d;
+var order: uint = 0;
+var i: uint = 0;
+loop i < 9 { order = order * 10 + recv(c); i = i + 1; }
+return order;`
+
+func TestTasksTakeTurns(t *testing.T) {
+	output, err := runWithOptions(t, INTERLEAVING_PROGRAM)
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if output != "111222333\n" {
+		t.Errorf("tasks interrupted before the end of their quantum. got=%q", output)
+	}
+
+	output, err = runWithOptions(t, INTERLEAVING_PROGRAM, WithQuantum(1))
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if output == "111222333\n" {
+		t.Errorf("tasks not preempted. got=%q", output)
+	}
+}
+
+func TestSeededRunsAreReproducible(t *testing.T) {
+	interleavings := map[string]bool{}
+	for seed := int64(1); seed <= 5; seed++ {
+		first, err := runWithOptions(t, INTERLEAVING_PROGRAM, WithQuantum(3), WithSeed(seed))
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		second, _ := runWithOptions(t, INTERLEAVING_PROGRAM, WithQuantum(3), WithSeed(seed))
+		if first != second {
+			t.Errorf("runs with seed %d differ. first=%q, second=%q", seed, first, second)
+		}
+		interleavings[first] = true
+	}
+
+	if len(interleavings) < 2 {
+		t.Errorf("every seed gives the same interleaving. got=%v", interleavings)
+	}
+}
+
+func TestPreemption(t *testing.T) {
+	// The spinning task does not keep the others from running, and is abandoned when the
+	// program ends
+	input := `fun spin(): uint { loop true { } return 0; }
+	fun one(): uint { return 1; }
+	var s = spawn spin();
+	return await spawn one();`
+
+	output, err := runWithOptions(t, input)
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if output != "1\n" {
+		t.Errorf("wrong output. got=%q", output)
+	}
+}
+
+func TestManyTasks(t *testing.T) {
+	input := `fun work(c: chan uint, x: uint): uint { send(c, x); return x; }
+	var c = chan();
+	var i: uint = 0;
+	loop i < 1000 { spawn work(c, i); i = i + 1; }
+	var sum: uint = 0;
+	i = 0;
+	loop i < 1000 { sum = sum + recv(c); i = i + 1; }
+	return sum;`
+
+	output, err := runWithOptions(t, input)
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if output != "499500\n" {
+		t.Errorf("wrong output. got=%q", output)
+	}
+}
+
+func TestDeadlockDetection(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var c = chan(); send(c, 1);", "1:17: all tasks are blocked: deadlock"},
+		{"fun wait(c: chan uint): uint { return recv(c); } var c = chan(); await spawn wait(c);", "1:66: all tasks are blocked: deadlock"},
+		{"var c = chan(1); send(c, 1); send(c, 2);", "1:30: all tasks are blocked: deadlock"},
+	}
+
+	for _, tt := range tests {
+		_, err := runWithOptions(t, tt.input)
+		if !errors.Is(err, ErrDeadlock) {
+			t.Fatalf("expected a deadlock for %q. got=%v", tt.input, err)
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
@@ -0,0 +1,1002 @@
+package vm
+
+import (
+	"atlas/compiler"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+/*
+	VM snapshot format
+
+	Written by VM.Snapshot between two runs and loaded by Restore. All integers are big
+	endian, like in the bytecode format.
+
+	Header, 38 bytes:
+		magic     [4]byte   "ATLS"
+		version   uint16    SNAPSHOT_VERSION of the writer
+		bytecode  [32]byte  SHA-256 of the bytecode file of the program, without debug section
+
+	Tasks count uint32, then for each task, the main one first:
+		future id uint32, unused for the main task
+		stack pointer uint32, then the values of the stack below it
+		frames count uint32, then for each frame its function, ip + 1 uint32 and base pointer uint32
+		globals count uint32, then for each global set its index uint32 and value
+		parked uint8, then for a parked task its instruction uint8, frame index uint32, ip uint32,
+		RECV operand uint32 and the id uint32 of its future for AWAIT or of its channel operation
+
+	Then the current task index uint32, the ready tasks count uint32 and their indexes uint32
+	in turn order, and the parked tasks count uint32 and their indexes uint32 in parking order.
+
+	Functions of frames are FUNCTION_MAIN, FUNCTION_CONSTANT followed by the index uint32 of the
+	constant they are, or FUNCTION_OBJECT followed by a function object. Values are VALUE_NIL,
+	VALUE_OBJECT followed by an object in the encoding of the bytecode constants, VALUE_CONSTANT
+	followed by a constant index uint32, or VALUE_FUTURE, VALUE_CHANNEL, VALUE_ARRAY and VALUE_MAP
+	followed by an id uint32. Arrays and maps have ids so that the values sharing one still do
+	once restored.
+
+	Futures, channels, channel operations, arrays and maps come after the tasks, in the order of
+	their ids:
+		futures count uint32, then for each its function name string and FUTURE_RUNNING for the
+		future of a task, FUTURE_RESOLVED and its value, or FUTURE_FAILED and the error message string
+
+		channels count uint32, then for each its capacity uint32, closed uint8, buffered values
+		count uint32 and values, waiting senders count uint32 then for each its operation id
+		uint32 and value, and waiting receivers count uint32 then their operation ids uint32
+
+		operations count uint32, then for each complete uint8, followed for a complete operation
+		by received uint8, its value and its error message string, empty without error
+
+		arrays count uint32, then for each its elements count uint32 and values
+
+		maps count uint32, then for each its pairs count uint32 and their keys and values, in
+		the order of the keys
+
+	Trailer:
+		CRC-32 (IEEE) uint32 of header and body
+
+	Strings are a uint32 length followed by UTF-8 bytes. SNAPSHOT_VERSION must be incremented
+	whenever this layout changes.
+*/
+
+var SNAPSHOT_MAGIC = [4]byte{'A', 'T', 'L', 'S'}
+
+const SNAPSHOT_VERSION uint16 = 3
+
+const SNAPSHOT_HEADER_SIZE = 38
+
+const (
+	FUNCTION_MAIN byte = iota
+	FUNCTION_CONSTANT
+	FUNCTION_OBJECT
+)
+
+const (
+	VALUE_NIL byte = iota
+	VALUE_OBJECT
+	VALUE_CONSTANT
+	VALUE_FUTURE
+	VALUE_CHANNEL
+	VALUE_ARRAY
+	VALUE_MAP
+)
+
+const (
+	FUTURE_RUNNING byte = iota
+	FUTURE_RESOLVED
+	FUTURE_FAILED
+)
+
+var ErrBadSnapshot = errors.New("not an Atlas VM snapshot (bad magic number)")
+var ErrSnapshotTruncated = errors.New("snapshot is truncated")
+var ErrSnapshotChecksum = errors.New("snapshot is corrupted (checksum mismatch)")
+var ErrProgramMismatch = errors.New("snapshot was taken from another program")
+
+// Encodes the state of the VM between two runs: its tasks with their stacks, frames and
+// globals, and the futures and channels they use. Restore continues from there, on this
+// node or on another one. Calls handed to the executor, reads and channels living on other
+// nodes cannot be saved while in progress.
+func (vm *VM) Snapshot() ([]byte, error) {
+	vm.saveRegisters()
+
+	vm.prunePending()
+	if len(vm.pending) > 0 {
+		return nil, fmt.Errorf("cannot snapshot while calls handed to the executor are running")
+	}
+
+	hash, err := programHash(vm.program())
+	if err != nil {
+		return nil, err
+	}
+
+	enc := snapshotEncoder{
+		vm:         vm,
+		futureIDs:  make(map[*compiler.Future]uint32),
+		channelIDs: make(map[*compiler.Channel]uint32),
+		opIDs:      make(map[*compiler.ChannelOp]uint32),
+		arrayIDs:   make(map[*compiler.Array]uint32),
+		mapIDs:     make(map[*compiler.Map]uint32),
+	}
+	data := append([]byte{}, SNAPSHOT_MAGIC[:]...)
+	data = binary.BigEndian.AppendUint16(data, SNAPSHOT_VERSION)
+	data = append(data, hash[:]...)
+
+	tasks := vm.tasks()
+	indexes := make(map[*task]uint32)
+	for index, saved := range tasks {
+		indexes[saved] = uint32(index)
+	}
+
+	body := &snapshotWriter{}
+	body.uint32(uint32(len(tasks)))
+	for _, saved := range tasks {
+		err := enc.task(body, saved)
+		if err != nil {
+			return nil, err
+		}
+	}
+	body.uint32(indexes[vm.current])
+	body.uint32(uint32(len(vm.ready)))
+	for _, ready := range vm.ready {
+		body.uint32(indexes[ready])
+	}
+	body.uint32(uint32(len(vm.parked)))
+	for _, parked := range vm.parked {
+		body.uint32(indexes[parked])
+	}
+
+	err = enc.tables(body)
+	if err != nil {
+		return nil, err
+	}
+
+	data = append(data, body.data...)
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(data)), nil
+}
+
+// Creates a VM continuing from a snapshot taken by VM.Snapshot. byteCode must be the program
+// of the VM the snapshot was taken from, with or without debug information. Options apply
+// like for New: the scheduler starts again from them.
+func Restore(byteCode compiler.ByteCode, snapshot []byte, options ...Option) (VM, error) {
+	if len(snapshot) < SNAPSHOT_HEADER_SIZE+crc32.Size {
+		return VM{}, ErrSnapshotTruncated
+	}
+	if !bytes.Equal(snapshot[:4], SNAPSHOT_MAGIC[:]) {
+		return VM{}, ErrBadSnapshot
+	}
+	version := binary.BigEndian.Uint16(snapshot[4:])
+	if version != SNAPSHOT_VERSION {
+		return VM{}, fmt.Errorf("unsupported snapshot version %d, expected %d", version, SNAPSHOT_VERSION)
+	}
+
+	content := snapshot[:len(snapshot)-crc32.Size]
+	checksum := binary.BigEndian.Uint32(snapshot[len(content):])
+	if crc32.ChecksumIEEE(content) != checksum {
+		return VM{}, ErrSnapshotChecksum
+	}
+
+	hash, err := programHash(byteCode)
+	if err != nil {
+		return VM{}, err
+	}
+	if !bytes.Equal(snapshot[6:SNAPSHOT_HEADER_SIZE], hash[:]) {
+		return VM{}, ErrProgramMismatch
+	}
+
+	machine := New(byteCode, options...)
+	dec := snapshotDecoder{
+		data:         content[SNAPSHOT_HEADER_SIZE:],
+		constants:    byteCode.Constants,
+		mainFunction: machine.frames[0].function,
+		futures:      make(map[uint32]*compiler.Future),
+		channels:     make(map[uint32]*compiler.Channel),
+		ops:          make(map[uint32]*compiler.ChannelOp),
+		arrays:       make(map[uint32]*compiler.Array),
+		maps:         make(map[uint32]*compiler.Map),
+	}
+
+	tasksCount := dec.uint32()
+	if dec.err == nil && tasksCount == 0 {
+		return VM{}, fmt.Errorf("snapshot has no main task")
+	}
+	tasks := []*task{}
+	for i := 0; i < tasksCount && dec.err == nil; i++ {
+		restored := dec.task(i == 0)
+		if restored != nil && restored.future != nil {
+			machine.spawned[restored.future] = true
+		}
+		tasks = append(tasks, restored)
+	}
+	if dec.err != nil {
+		return VM{}, dec.err
+	}
+
+	current := dec.taskIndex(len(tasks))
+	readyCount := dec.uint32()
+	for i := 0; i < readyCount && dec.err == nil; i++ {
+		machine.ready = append(machine.ready, tasks[dec.taskIndex(len(tasks))])
+	}
+	parkedCount := dec.uint32()
+	for i := 0; i < parkedCount && dec.err == nil; i++ {
+		machine.parked = append(machine.parked, tasks[dec.taskIndex(len(tasks))])
+	}
+
+	dec.tables()
+	if dec.err == nil && len(dec.data) > 0 {
+		dec.err = fmt.Errorf("snapshot has %d unexpected bytes at the end", len(dec.data))
+	}
+	if dec.err != nil {
+		return VM{}, dec.err
+	}
+
+	machine.main = tasks[0]
+	machine.current = tasks[current]
+	machine.loadRegisters(tasks[current])
+	return machine, nil
+}
+
+// Program run by the VM, as found in the bytecode it was created from
+func (vm *VM) program() compiler.ByteCode {
+	mainFunction := vm.main.frames[0].function
+	return compiler.ByteCode{Instructions: mainFunction.Instructions, Constants: vm.constants, NumLocals: mainFunction.NumLocals}
+}
+
+// SHA-256 of the bytecode file of the program. Debug information is left out so that the
+// stripped build of a program matches too.
+func programHash(byteCode compiler.ByteCode) ([32]byte, error) {
+	byteCode.Debug = nil
+	data, err := byteCode.MarshalBinary()
+	if err != nil {
+		return [32]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
+
+// Every task of the VM, the main one first
+func (vm *VM) tasks() []*task {
+	tasks := []*task{vm.main}
+	if vm.current != vm.main {
+		tasks = append(tasks, vm.current)
+	}
+	for _, waiting := range append(append([]*task{}, vm.ready...), vm.parked...) {
+		if waiting != vm.main {
+			tasks = append(tasks, waiting)
+		}
+	}
+	return tasks
+}
+
+type snapshotWriter struct {
+	data []byte
+}
+
+func (writer *snapshotWriter) byte(value byte) {
+	writer.data = append(writer.data, value)
+}
+
+func (writer *snapshotWriter) uint32(value uint32) {
+	writer.data = binary.BigEndian.AppendUint32(writer.data, value)
+}
+
+func (writer *snapshotWriter) string(value string) {
+	writer.uint32(uint32(len(value)))
+	writer.data = append(writer.data, value...)
+}
+
+func (writer *snapshotWriter) boolean(value bool) {
+	if value {
+		writer.byte(1)
+	} else {
+		writer.byte(0)
+	}
+}
+
+// Gives ids to the futures, channels, operations, arrays and maps met while encoding the tasks, in
+// the order they are met
+type snapshotEncoder struct {
+	vm *VM
+
+	futures    []*compiler.Future
+	futureIDs  map[*compiler.Future]uint32
+	channels   []*compiler.Channel
+	channelIDs map[*compiler.Channel]uint32
+	ops        []*compiler.ChannelOp
+	opIDs      map[*compiler.ChannelOp]uint32
+	arrays     []*compiler.Array
+	arrayIDs   map[*compiler.Array]uint32
+	maps       []*compiler.Map
+	mapIDs     map[*compiler.Map]uint32
+}
+
+func (enc *snapshotEncoder) futureID(future *compiler.Future) uint32 {
+	id, ok := enc.futureIDs[future]
+	if !ok {
+		id = uint32(len(enc.futures))
+		enc.futureIDs[future] = id
+		enc.futures = append(enc.futures, future)
+	}
+	return id
+}
+
+func (enc *snapshotEncoder) channelID(channel *compiler.Channel) uint32 {
+	id, ok := enc.channelIDs[channel]
+	if !ok {
+		id = uint32(len(enc.channels))
+		enc.channelIDs[channel] = id
+		enc.channels = append(enc.channels, channel)
+	}
+	return id
+}
+
+func (enc *snapshotEncoder) opID(op *compiler.ChannelOp) uint32 {
+	id, ok := enc.opIDs[op]
+	if !ok {
+		id = uint32(len(enc.ops))
+		enc.opIDs[op] = id
+		enc.ops = append(enc.ops, op)
+	}
+	return id
+}
+
+func (enc *snapshotEncoder) arrayID(array *compiler.Array) uint32 {
+	id, ok := enc.arrayIDs[array]
+	if !ok {
+		id = uint32(len(enc.arrays))
+		enc.arrayIDs[array] = id
+		enc.arrays = append(enc.arrays, array)
+	}
+	return id
+}
+
+func (enc *snapshotEncoder) mapID(hashMap *compiler.Map) uint32 {
+	id, ok := enc.mapIDs[hashMap]
+	if !ok {
+		id = uint32(len(enc.maps))
+		enc.mapIDs[hashMap] = id
+		enc.maps = append(enc.maps, hashMap)
+	}
+	return id
+}
+
+func (enc *snapshotEncoder) task(writer *snapshotWriter, saved *task) error {
+	if saved.future != nil {
+		writer.uint32(enc.futureID(saved.future))
+	} else {
+		writer.uint32(0)
+	}
+
+	writer.uint32(uint32(saved.sp))
+	for _, value := range saved.stack[:saved.sp] {
+		err := enc.value(writer, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.uint32(uint32(saved.framesIndex))
+	for _, frame := range saved.frames[:saved.framesIndex] {
+		enc.function(writer, frame.function)
+		writer.uint32(uint32(frame.ip + 1))
+		writer.uint32(uint32(frame.basePointer))
+	}
+
+	globalsCount := 0
+	for _, global := range saved.globals {
+		if global != nil {
+			globalsCount++
+		}
+	}
+	writer.uint32(uint32(globalsCount))
+	for index, global := range saved.globals {
+		if global == nil {
+			continue
+		}
+		writer.uint32(uint32(index))
+		err := enc.value(writer, global)
+		if err != nil {
+			return err
+		}
+	}
+
+	blocked := saved.blocked
+	writer.boolean(blocked != nil)
+	if blocked == nil {
+		return nil
+	}
+	select {
+	case <-blocked.done():
+	default:
+		if blocked.external {
+			return fmt.Errorf("cannot snapshot while a task waits for a read or another node")
+		}
+	}
+
+	frameIndex := 0
+	for index, frame := range saved.frames[:saved.framesIndex] {
+		if frame == blocked.frame {
+			frameIndex = index
+		}
+	}
+	writer.byte(byte(blocked.instruction))
+	writer.uint32(uint32(frameIndex))
+	writer.uint32(uint32(blocked.ip))
+	writer.uint32(uint32(blocked.zeroIndex))
+	if blocked.instruction == compiler.AWAIT {
+		writer.uint32(enc.futureID(blocked.future))
+	} else {
+		writer.uint32(enc.opID(blocked.op))
+	}
+	return nil
+}
+
+func (enc *snapshotEncoder) function(writer *snapshotWriter, function *compiler.CompiledFunction) {
+	if function == enc.vm.main.frames[0].function {
+		writer.byte(FUNCTION_MAIN)
+		return
+	}
+	for index, constant := range enc.vm.constants {
+		if constant == function {
+			writer.byte(FUNCTION_CONSTANT)
+			writer.uint32(uint32(index))
+			return
+		}
+	}
+	// Entry functions of spawned tasks, which only hold the CALL of the spawned function
+	writer.byte(FUNCTION_OBJECT)
+	writer.data, _ = compiler.AppendObject(writer.data, function)
+}
+
+func (enc *snapshotEncoder) value(writer *snapshotWriter, value compiler.Object) error {
+	switch value := value.(type) {
+	case nil:
+		writer.byte(VALUE_NIL)
+		return nil
+	case *compiler.CompiledFunction:
+		for index, constant := range enc.vm.constants {
+			if constant == value {
+				writer.byte(VALUE_CONSTANT)
+				writer.uint32(uint32(index))
+				return nil
+			}
+		}
+	case *compiler.Future:
+		writer.byte(VALUE_FUTURE)
+		writer.uint32(enc.futureID(value))
+		return nil
+	case *compiler.Channel:
+		if value.IsProxy() {
+			return fmt.Errorf("cannot snapshot a channel living on another node")
+		}
+		writer.byte(VALUE_CHANNEL)
+		writer.uint32(enc.channelID(value))
+		return nil
+	case *compiler.Array:
+		writer.byte(VALUE_ARRAY)
+		writer.uint32(enc.arrayID(value))
+		return nil
+	case *compiler.Map:
+		writer.byte(VALUE_MAP)
+		writer.uint32(enc.mapID(value))
+		return nil
+	}
+
+	var err error
+	writer.byte(VALUE_OBJECT)
+	writer.data, err = compiler.AppendObject(writer.data, value)
+	return err
+}
+
+// Writes the futures, channels, operations, arrays and maps met so far, and the ones their
+// values refer to
+func (enc *snapshotEncoder) tables(writer *snapshotWriter) error {
+	futures, channels, ops := &snapshotWriter{}, &snapshotWriter{}, &snapshotWriter{}
+	arrays, maps := &snapshotWriter{}, &snapshotWriter{}
+	f, c, o, a, m := 0, 0, 0, 0, 0
+	for f < len(enc.futures) || c < len(enc.channels) || o < len(enc.ops) || a < len(enc.arrays) || m < len(enc.maps) {
+		for ; f < len(enc.futures); f++ {
+			err := enc.future(futures, enc.futures[f])
+			if err != nil {
+				return err
+			}
+		}
+		for ; c < len(enc.channels); c++ {
+			err := enc.channel(channels, enc.channels[c])
+			if err != nil {
+				return err
+			}
+		}
+		for ; o < len(enc.ops); o++ {
+			err := enc.op(ops, enc.ops[o])
+			if err != nil {
+				return err
+			}
+		}
+		for ; a < len(enc.arrays); a++ {
+			err := enc.array(arrays, enc.arrays[a])
+			if err != nil {
+				return err
+			}
+		}
+		for ; m < len(enc.maps); m++ {
+			err := enc.hashMap(maps, enc.maps[m])
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	writer.uint32(uint32(len(enc.futures)))
+	writer.data = append(writer.data, futures.data...)
+	writer.uint32(uint32(len(enc.channels)))
+	writer.data = append(writer.data, channels.data...)
+	writer.uint32(uint32(len(enc.ops)))
+	writer.data = append(writer.data, ops.data...)
+	writer.uint32(uint32(len(enc.arrays)))
+	writer.data = append(writer.data, arrays.data...)
+	writer.uint32(uint32(len(enc.maps)))
+	writer.data = append(writer.data, maps.data...)
+	return nil
+}
+
+func (enc *snapshotEncoder) future(writer *snapshotWriter, future *compiler.Future) error {
+	writer.string(future.Function)
+	if enc.vm.spawned[future] {
+		writer.byte(FUTURE_RUNNING)
+		return nil
+	}
+
+	select {
+	case <-future.Done():
+	default:
+		return fmt.Errorf("cannot snapshot the future of a call running outside the VM")
+	}
+	value, err := future.Wait()
+	if err != nil {
+		writer.byte(FUTURE_FAILED)
+		writer.string(err.Error())
+		return nil
+	}
+	writer.byte(FUTURE_RESOLVED)
+	return enc.value(writer, value)
+}
+
+func (enc *snapshotEncoder) channel(writer *snapshotWriter, channel *compiler.Channel) error {
+	state := channel.State()
+	writer.uint32(uint32(state.Capacity))
+	writer.boolean(state.Closed)
+
+	writer.uint32(uint32(len(state.Buffer)))
+	for _, value := range state.Buffer {
+		err := enc.value(writer, value)
+		if err != nil {
+			return err
+		}
+	}
+	writer.uint32(uint32(len(state.Senders)))
+	for i, sender := range state.Senders {
+		writer.uint32(enc.opID(sender))
+		err := enc.value(writer, state.Sent[i])
+		if err != nil {
+			return err
+		}
+	}
+	writer.uint32(uint32(len(state.Receivers)))
+	for _, receiver := range state.Receivers {
+		writer.uint32(enc.opID(receiver))
+	}
+	return nil
+}
+
+func (enc *snapshotEncoder) array(writer *snapshotWriter, array *compiler.Array) error {
+	writer.uint32(uint32(len(array.Elements)))
+	for _, element := range array.Elements {
+		err := enc.value(writer, element)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pairs are written in the order of their keys, so that a state always gives the same snapshot
+func (enc *snapshotEncoder) hashMap(writer *snapshotWriter, hashMap *compiler.Map) error {
+	pairs := hashMap.SortedPairs()
+	writer.uint32(uint32(len(pairs)))
+	for _, pair := range pairs {
+		err := enc.value(writer, pair.Key)
+		if err != nil {
+			return err
+		}
+		err = enc.value(writer, pair.Value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Operations still waiting are found in the queue of their channel
+func (enc *snapshotEncoder) op(writer *snapshotWriter, op *compiler.ChannelOp) error {
+	select {
+	case <-op.Done():
+	default:
+		writer.boolean(false)
+		return nil
+	}
+
+	value, received, failure := op.Wait()
+	writer.boolean(true)
+	writer.boolean(received)
+	err := enc.value(writer, value)
+	if err != nil {
+		return err
+	}
+	if failure != nil {
+		writer.string(failure.Error())
+	} else {
+		writer.string("")
+	}
+	return nil
+}
+
+// Reads a snapshot body in order. Futures, channels, operations, arrays and maps are created
+// when their id is first met and filled in when their table is read. The first failure is kept in err.
+type snapshotDecoder struct {
+	data         []byte
+	constants    []compiler.Object
+	mainFunction *compiler.CompiledFunction
+	err          error
+
+	futures  map[uint32]*compiler.Future
+	channels map[uint32]*compiler.Channel
+	ops      map[uint32]*compiler.ChannelOp
+	arrays   map[uint32]*compiler.Array
+	maps     map[uint32]*compiler.Map
+}
+
+func (dec *snapshotDecoder) read(length int) []byte {
+	if dec.err != nil {
+		return nil
+	}
+	if length < 0 || length > len(dec.data) {
+		dec.err = ErrSnapshotTruncated
+		return nil
+	}
+	value := dec.data[:length]
+	dec.data = dec.data[length:]
+	return value
+}
+
+func (dec *snapshotDecoder) byte() byte {
+	value := dec.read(1)
+	if value == nil {
+		return 0
+	}
+	return value[0]
+}
+
+func (dec *snapshotDecoder) uint32() int {
+	value := dec.read(4)
+	if value == nil {
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(value))
+}
+
+func (dec *snapshotDecoder) string() string {
+	return string(dec.read(dec.uint32()))
+}
+
+func (dec *snapshotDecoder) boolean() bool {
+	return dec.byte() != 0
+}
+
+func (dec *snapshotDecoder) fail(format string, args ...any) {
+	if dec.err == nil {
+		dec.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (dec *snapshotDecoder) future(id uint32) *compiler.Future {
+	future, ok := dec.futures[id]
+	if !ok {
+		future = compiler.NewFuture("")
+		dec.futures[id] = future
+	}
+	return future
+}
+
+func (dec *snapshotDecoder) channel(id uint32) *compiler.Channel {
+	channel, ok := dec.channels[id]
+	if !ok {
+		channel = compiler.NewChannel(0)
+		dec.channels[id] = channel
+	}
+	return channel
+}
+
+func (dec *snapshotDecoder) op(id uint32) *compiler.ChannelOp {
+	op, ok := dec.ops[id]
+	if !ok {
+		op = compiler.NewChannelOp()
+		dec.ops[id] = op
+	}
+	return op
+}
+
+func (dec *snapshotDecoder) array(id uint32) *compiler.Array {
+	array, ok := dec.arrays[id]
+	if !ok {
+		array = &compiler.Array{Elements: []compiler.Object{}}
+		dec.arrays[id] = array
+	}
+	return array
+}
+
+func (dec *snapshotDecoder) hashMap(id uint32) *compiler.Map {
+	hashMap, ok := dec.maps[id]
+	if !ok {
+		hashMap = compiler.NewMap()
+		dec.maps[id] = hashMap
+	}
+	return hashMap
+}
+
+func (dec *snapshotDecoder) taskIndex(count int) int {
+	index := dec.uint32()
+	if dec.err == nil && index >= count {
+		dec.fail("snapshot refers to unknown task %d", index)
+	}
+	if dec.err != nil {
+		return 0
+	}
+	return index
+}
+
+func (dec *snapshotDecoder) task(main bool) *task {
+	restored := &task{}
+	futureID := uint32(dec.uint32())
+	if !main {
+		restored.future = dec.future(futureID)
+	}
+
+	restored.sp = dec.uint32()
+	if restored.sp > STACK_SIZE {
+		dec.fail("stack of %d values is larger than the stack size", restored.sp)
+		return nil
+	}
+	restored.stack = make([]compiler.Object, max(INITIAL_STACK_SIZE, restored.sp))
+	for i := 0; i < restored.sp && dec.err == nil; i++ {
+		restored.stack[i] = dec.value()
+	}
+
+	restored.framesIndex = dec.uint32()
+	if dec.err == nil && (restored.framesIndex == 0 || restored.framesIndex > MAX_FRAMES) {
+		dec.fail("wrong frames count %d", restored.framesIndex)
+	}
+	for i := 0; i < restored.framesIndex && dec.err == nil; i++ {
+		function := dec.function()
+		frame := NewFrame(function, 0)
+		frame.ip = dec.uint32() - 1
+		frame.basePointer = dec.uint32()
+		restored.frames = append(restored.frames, frame)
+	}
+
+	if main {
+		restored.globals = make([]compiler.Object, GLOBALS_SIZE)
+	}
+	globalsCount := dec.uint32()
+	for i := 0; i < globalsCount && dec.err == nil; i++ {
+		index := dec.uint32()
+		value := dec.value()
+		if dec.err == nil && index >= GLOBALS_SIZE {
+			dec.fail("global index %d is out of range", index)
+		}
+		if dec.err != nil {
+			break
+		}
+		if index >= len(restored.globals) {
+			restored.globals = append(restored.globals, make([]compiler.Object, index+1-len(restored.globals))...)
+		}
+		restored.globals[index] = value
+	}
+
+	if dec.boolean() {
+		blocked := &blocking{instruction: compiler.OpCode(dec.byte())}
+		frameIndex := dec.uint32()
+		blocked.ip = dec.uint32()
+		blocked.zeroIndex = dec.uint32()
+		id := uint32(dec.uint32())
+		if dec.err == nil && frameIndex >= len(restored.frames) {
+			dec.fail("parked task refers to unknown frame %d", frameIndex)
+		}
+		if dec.err != nil {
+			return nil
+		}
+		blocked.frame = restored.frames[frameIndex]
+
+		switch blocked.instruction {
+		case compiler.AWAIT:
+			blocked.future = dec.future(id)
+		case compiler.SEND, compiler.RECV, compiler.CLOSE, compiler.IN:
+			blocked.op = dec.op(id)
+		default:
+			dec.fail("task parked on instruction %d", blocked.instruction)
+		}
+		restored.blocked = blocked
+	}
+	return restored
+}
+
+func (dec *snapshotDecoder) function() *compiler.CompiledFunction {
+	switch kind := dec.byte(); kind {
+	case FUNCTION_MAIN:
+		return dec.mainFunction
+	case FUNCTION_CONSTANT:
+		index := dec.uint32()
+		if dec.err == nil && index < len(dec.constants) {
+			if function, ok := dec.constants[index].(*compiler.CompiledFunction); ok {
+				return function
+			}
+		}
+		dec.fail("frame refers to constant %d, which is not a function", index)
+	case FUNCTION_OBJECT:
+		object, read, err := compiler.ReadObject(dec.data)
+		if err != nil {
+			dec.fail("%s", err)
+			return nil
+		}
+		dec.data = dec.data[read:]
+		if function, ok := object.(*compiler.CompiledFunction); ok {
+			return function
+		}
+		dec.fail("frame runs an object of type `%s`", object.Type())
+	default:
+		dec.fail("unknown function kind %d", kind)
+	}
+	return nil
+}
+
+func (dec *snapshotDecoder) value() compiler.Object {
+	switch kind := dec.byte(); kind {
+	case VALUE_NIL:
+		return nil
+	case VALUE_OBJECT:
+		object, read, err := compiler.ReadObject(dec.data)
+		if err != nil {
+			dec.fail("%s", err)
+			return nil
+		}
+		dec.data = dec.data[read:]
+		return object
+	case VALUE_CONSTANT:
+		index := dec.uint32()
+		if dec.err == nil && index >= len(dec.constants) {
+			dec.fail("snapshot refers to unknown constant %d", index)
+		}
+		if dec.err != nil {
+			return nil
+		}
+		return dec.constants[index]
+	case VALUE_FUTURE:
+		return dec.future(uint32(dec.uint32()))
+	case VALUE_CHANNEL:
+		return dec.channel(uint32(dec.uint32()))
+	case VALUE_ARRAY:
+		return dec.array(uint32(dec.uint32()))
+	case VALUE_MAP:
+		return dec.hashMap(uint32(dec.uint32()))
+	default:
+		dec.fail("unknown value kind %d", kind)
+	}
+	return nil
+}
+
+// Fills in the futures, channels, operations, arrays and maps created while reading the tasks
+func (dec *snapshotDecoder) tables() {
+	futuresCount := dec.uint32()
+	for id := uint32(0); id < uint32(futuresCount) && dec.err == nil; id++ {
+		future := dec.future(id)
+		future.Function = dec.string()
+		switch state := dec.byte(); state {
+		case FUTURE_RUNNING:
+		case FUTURE_RESOLVED:
+			future.Resolve(dec.value(), nil)
+		case FUTURE_FAILED:
+			future.Resolve(nil, errors.New(dec.string()))
+		default:
+			dec.fail("unknown future state %d", state)
+		}
+	}
+
+	channelsCount := dec.uint32()
+	for id := uint32(0); id < uint32(channelsCount) && dec.err == nil; id++ {
+		state := compiler.ChannelState{Capacity: dec.uint32(), Closed: dec.boolean()}
+		bufferCount := dec.uint32()
+		for i := 0; i < bufferCount && dec.err == nil; i++ {
+			state.Buffer = append(state.Buffer, dec.value())
+		}
+		sendersCount := dec.uint32()
+		for i := 0; i < sendersCount && dec.err == nil; i++ {
+			state.Senders = append(state.Senders, dec.op(uint32(dec.uint32())))
+			state.Sent = append(state.Sent, dec.value())
+		}
+		receiversCount := dec.uint32()
+		for i := 0; i < receiversCount && dec.err == nil; i++ {
+			state.Receivers = append(state.Receivers, dec.op(uint32(dec.uint32())))
+		}
+		if dec.err == nil {
+			dec.channel(id).Restore(state)
+		}
+	}
+
+	opsCount := dec.uint32()
+	for id := uint32(0); id < uint32(opsCount) && dec.err == nil; id++ {
+		if !dec.boolean() {
+			continue
+		}
+		received := dec.boolean()
+		value := dec.value()
+		message := dec.string()
+		var err error
+		if message != "" {
+			err = errors.New(message)
+		}
+		if dec.err == nil {
+			dec.op(id).Complete(value, received, err)
+		}
+	}
+
+	arraysCount := dec.uint32()
+	for id := uint32(0); id < uint32(arraysCount) && dec.err == nil; id++ {
+		elementsCount := dec.uint32()
+		elements := []compiler.Object{}
+		for i := 0; i < elementsCount && dec.err == nil; i++ {
+			elements = append(elements, dec.value())
+		}
+		dec.array(id).Elements = elements
+	}
+
+	mapsCount := dec.uint32()
+	for id := uint32(0); id < uint32(mapsCount) && dec.err == nil; id++ {
+		pairsCount := dec.uint32()
+		hashMap := dec.hashMap(id)
+		for i := 0; i < pairsCount && dec.err == nil; i++ {
+			key := dec.value()
+			value := dec.value()
+			hashable, ok := key.(compiler.Hashable)
+			if !ok {
+				dec.fail("snapshot holds a map key that cannot be hashed")
+				break
+			}
+			hashMap.Pairs[hashable.HashKey()] = compiler.MapPair{Key: key, Value: value}
+		}
+	}
+
+	for id := range dec.futures {
+		dec.checkID("future", id, futuresCount)
+	}
+	for id := range dec.channels {
+		dec.checkID("channel", id, channelsCount)
+	}
+	for id := range dec.ops {
+		dec.checkID("channel operation", id, opsCount)
+	}
+	for id := range dec.arrays {
+		dec.checkID("array", id, arraysCount)
+	}
+	for id := range dec.maps {
+		dec.checkID("map", id, mapsCount)
+	}
+}
+
+// Ids met must have an entry in their table
+func (dec *snapshotDecoder) checkID(kind string, id uint32, count int) {
+	if id >= uint32(count) {
+		dec.fail("snapshot refers to unknown %s %d", kind, id)
+	}
+}
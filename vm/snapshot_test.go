@@ -0,0 +1,198 @@
+package vm
+
+import (
+	"atlas/compiler"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Tasks parked on both ends of an unbuffered channel, a buffered one holding values, futures
+// resolved and running, globals and nested frames
+const SNAPSHOT_PROGRAM = `var base: uint = 100;
+fun square(x: uint): uint { return x * x; }
+fun produce(c: chan uint, n: uint): uint {
+	var i: uint = 0;
+	loop i < n { send(c, base + square(i)); i = i + 1; }
+	close(c);
+	return n;
+}
+fun collect(c: chan uint, n: uint, results: chan uint): uint {
+	var sum: uint = 0;
+	var i: uint = 0;
+	loop i < n { sum = sum + recv(c); i = i + 1; }
+	send(results, sum);
+	return sum;
+}
+var c = chan();
+var results = chan(1);
+var p = spawn produce(c, 5);
+var q = spawn collect(c, 5, results);
+return recv(results);
+return await p;
+return await q;
+return base;`
+
+func TestSnapshotAndRestore(t *testing.T) {
+	byteCode := compileProgram(t, SNAPSHOT_PROGRAM, false)
+
+	var expected strings.Builder
+	machine := New(byteCode, WithQuantum(3), WithOutput(&expected))
+	err := machine.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	// Interrupts the run after each number of steps, and goes on from a snapshot
+	for steps := 0; ; steps++ {
+		var before strings.Builder
+		machine := New(byteCode, WithQuantum(3), WithOutput(&before))
+		ended := false
+		for i := 0; i < steps && !ended; i++ {
+			ended, err = machine.step(context.Background())
+			if err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+		}
+		if ended {
+			break
+		}
+
+		snapshot, err := machine.Snapshot()
+		if err != nil {
+			t.Fatalf("could not snapshot after %d steps: %s", steps, err)
+		}
+
+		// The debug information is not needed to restore
+		stripped := byteCode
+		stripped.Debug = nil
+		var after strings.Builder
+		restored, err := Restore(stripped, snapshot, WithQuantum(3), WithOutput(&after))
+		if err != nil {
+			t.Fatalf("could not restore after %d steps: %s", steps, err)
+		}
+		err = restored.Run()
+		if err != nil {
+			t.Fatalf("vm error after restoring at %d steps: %s", steps, err)
+		}
+
+		if before.String()+after.String() != expected.String() {
+			t.Errorf("wrong output when restoring after %d steps. expected=%q, got=%q+%q", steps, expected.String(), before.String(), after.String())
+		}
+	}
+}
+
+func TestRestoreErrors(t *testing.T) {
+	byteCode := compileProgram(t, SNAPSHOT_PROGRAM, false)
+	machine := New(byteCode, WithQuantum(3), WithOutput(&strings.Builder{}))
+	machine.step(context.Background())
+	snapshot, err := machine.Snapshot()
+	if err != nil {
+		t.Fatalf("could not snapshot: %s", err)
+	}
+
+	_, err = Restore(compileProgram(t, "return 1;", false), snapshot)
+	if !errors.Is(err, ErrProgramMismatch) {
+		t.Errorf("expected %q. got=%v", ErrProgramMismatch, err)
+	}
+
+	corrupted := append([]byte{}, snapshot...)
+	corrupted[len(corrupted)/2] ^= 0xff
+	_, err = Restore(byteCode, corrupted)
+	if !errors.Is(err, ErrSnapshotChecksum) {
+		t.Errorf("expected %q. got=%v", ErrSnapshotChecksum, err)
+	}
+
+	_, err = Restore(byteCode, snapshot[:len(snapshot)-10])
+	if !errors.Is(err, ErrSnapshotChecksum) {
+		t.Errorf("expected %q for a truncated snapshot. got=%v", ErrSnapshotChecksum, err)
+	}
+
+	_, err = Restore(byteCode, []byte("ATL"))
+	if !errors.Is(err, ErrSnapshotTruncated) {
+		t.Errorf("expected %q. got=%v", ErrSnapshotTruncated, err)
+	}
+}
+
+// Variables sharing an array still do once restored
+func TestSnapshotWithArrays(t *testing.T) {
+	byteCode := compileProgram(t, "var a = [1, [2]]; var b = a; var c = chan(1); send(c, a); b[0] = 3; println(a, recv(c));", false)
+
+	for limit := 1; limit < 30; limit++ {
+		var before strings.Builder
+		machine := New(byteCode, WithMaxInstructions(limit), WithOutput(&before))
+		err := machine.Run()
+		if err == nil {
+			break
+		}
+		snapshot, err := machine.Snapshot()
+		if err != nil {
+			t.Fatalf("could not snapshot after %d instructions: %s", limit, err)
+		}
+
+		var after strings.Builder
+		restored, err := Restore(byteCode, snapshot, WithOutput(&after))
+		if err != nil {
+			t.Fatalf("could not restore after %d instructions: %s", limit, err)
+		}
+		err = restored.Run()
+		if err != nil {
+			t.Fatalf("vm error after restoring at %d instructions: %s", limit, err)
+		}
+		if before.String()+after.String() != "[3, [2]] [1, [2]]\n" {
+			t.Errorf("wrong output when stopping after %d instructions. got=%q+%q", limit, before.String(), after.String())
+		}
+	}
+}
+
+func TestSnapshotWithMaps(t *testing.T) {
+	byteCode := compileProgram(t, `var m = {"b": {1: true}, "a": {}}; var n = m; var c = chan(1); send(c, m); n["a"][2] = false; println(m, recv(c));`, false)
+
+	for limit := 1; limit < 40; limit++ {
+		var before strings.Builder
+		machine := New(byteCode, WithMaxInstructions(limit), WithOutput(&before))
+		err := machine.Run()
+		if err == nil {
+			break
+		}
+		snapshot, err := machine.Snapshot()
+		if err != nil {
+			t.Fatalf("could not snapshot after %d instructions: %s", limit, err)
+		}
+
+		var after strings.Builder
+		restored, err := Restore(byteCode, snapshot, WithOutput(&after))
+		if err != nil {
+			t.Fatalf("could not restore after %d instructions: %s", limit, err)
+		}
+		err = restored.Run()
+		if err != nil {
+			t.Fatalf("vm error after restoring at %d instructions: %s", limit, err)
+		}
+		if before.String()+after.String() != `{"a": {2: false}, "b": {1: true}} {"a": {}, "b": {1: true}}`+"\n" {
+			t.Errorf("wrong output when stopping after %d instructions. got=%q+%q", limit, before.String(), after.String())
+		}
+	}
+}
+
+// Never resolves the calls it is given
+type stalledExecutor struct{}
+
+func (stalledExecutor) Spawn(call *Call) *compiler.Future {
+	return compiler.NewFuture(call.Function.Name)
+}
+
+func TestSnapshotRefusesCallsInProgress(t *testing.T) {
+	byteCode := compileProgram(t, "fun f(): uint { return 1; } var a = spawn f();", false)
+	machine := New(byteCode, WithExecutor(stalledExecutor{}))
+	err := machine.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	_, err = machine.Snapshot()
+	if err == nil || !strings.Contains(err.Error(), "executor") {
+		t.Errorf("expected an error for the call in progress. got=%v", err)
+	}
+}
@@ -2,29 +2,88 @@ package vm
 
 import (
 	"atlas/compiler"
+	"errors"
 	"fmt"
+	"io"
 	"math"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
 )
 
 const STACK_SIZE int = 2048
 const GLOBALS_SIZE int = 65536
+const MAX_FRAMES int = 1024
 
 type VM struct {
-	instructions compiler.Instructions
-	constants    []compiler.Object
-	stack        []compiler.Object
-	sp           int
-	globals      []compiler.Object
+	constants []compiler.Object
+	stack     []compiler.Object // Registers of the running task, see switchTo
+	sp        int
+	globals   []compiler.Object
+
+	frames      []*Frame
+	framesIndex int
+
+	current *task
+	main    *task
+	ready   []*task                   // Tasks waiting for their turn
+	parked  []*task                   // Tasks blocked on an instruction, in the order they blocked
+	spawned map[*compiler.Future]bool // Futures of the tasks still running
+	pending []*compiler.Future        // Futures of the calls handed to the executor, until resolved
+	quantum int
+	random  *rand.Rand // Picks the next task when seeded, tasks run in turn otherwise
+
+	debug *compiler.DebugInfo                               // Nil when the bytecode was stripped
+	lines map[*compiler.CompiledFunction]compiler.LineTable // Line tables of every function, from debug
+
+	input    *syncReader
+	output   io.Writer
+	executor Executor // Runs the calls spawned by the program, nil to run them as tasks of the VM
+
+	executed        int // Instructions run since the VM was created or restored
+	maxInstructions int // Limits set by the options, 0 when unlimited
+	maxStack        int
+	maxGlobals      int
+	deadline        time.Time
+}
+
+func New(byteCode compiler.ByteCode, options ...Option) VM {
+	return NewWithGlobals(byteCode, make([]compiler.Object, GLOBALS_SIZE), options...)
 }
 
-func New(byteCode compiler.ByteCode) VM {
-	return VM{
-		instructions: byteCode.Instructions,
-		constants:    byteCode.Constants,
-		stack:        make([]compiler.Object, STACK_SIZE),
-		sp:           0,
-		globals:      make([]compiler.Object, GLOBALS_SIZE),
+// Creates a VM using globals as its globals store, so that values set by previous runs stay
+// visible, like between the inputs of the REPL
+func NewWithGlobals(byteCode compiler.ByteCode, globals []compiler.Object, options ...Option) VM {
+	mainFunction := &compiler.CompiledFunction{Name: "main", Instructions: byteCode.Instructions, NumLocals: byteCode.NumLocals}
+	mainFrame := NewFrame(mainFunction, 0)
+
+	mainTask := &task{}
+	machine := VM{
+		constants:   byteCode.Constants,
+		stack:       make([]compiler.Object, max(INITIAL_STACK_SIZE, mainFunction.NumLocals)),
+		sp:          mainFunction.NumLocals,
+		globals:     globals,
+		frames:      []*Frame{mainFrame},
+		framesIndex: 1,
+		current:     mainTask,
+		main:        mainTask,
+		spawned:     make(map[*compiler.Future]bool),
+		quantum:     QUANTUM,
+		input:       &syncReader{reader: strings.NewReader("")}, // No input unless given one, see WithInput
+		output:      os.Stdout,
+	}
+
+	if byteCode.Debug != nil {
+		machine.debug = byteCode.Debug
+		machine.lines = functionLines(mainFunction, byteCode)
 	}
+
+	for _, option := range options {
+		option(&machine)
+	}
+
+	return machine
 }
 
 func (vm *VM) StackTop() compiler.Object {
@@ -35,87 +94,374 @@ func (vm *VM) StackTop() compiler.Object {
 }
 
 func (vm *VM) PoppedGhost() compiler.Object {
+	if vm.sp >= len(vm.stack) {
+		return nil
+	}
 	return vm.stack[vm.sp]
 }
 
-func (vm *VM) Run() error {
-	for ip := 0; ip < len(vm.instructions); ip++ {
-		operation := compiler.OpCode(vm.instructions[ip])
-		
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(frame *Frame) error {
+	if vm.framesIndex >= MAX_FRAMES {
+		return fmt.Errorf("stack overflow: more than %d nested calls", MAX_FRAMES)
+	}
+	if vm.framesIndex == len(vm.frames) {
+		vm.frames = append(vm.frames, frame)
+	} else {
+		vm.frames[vm.framesIndex] = frame
+	}
+	vm.framesIndex++
+	return nil
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// Runs up to quantum instructions of the current task, stopping early when it parks. Returns
+// true once the task ended.
+func (vm *VM) execute(quantum int) (bool, error) {
+	for executed := 0; executed < quantum; executed++ {
+		if vm.currentFrame().ip >= len(vm.currentFrame().Instructions())-1 {
+			return true, nil
+		}
+		if vm.maxInstructions > 0 && vm.executed >= vm.maxInstructions {
+			return false, vm.stop(ErrInstructionLimit)
+		}
+		vm.executed++
+		vm.currentFrame().ip++
+
+		frame := vm.currentFrame()
+		ip := frame.ip
+		sp, framesIndex := vm.sp, vm.framesIndex
+		instructions := frame.Instructions()
+		operation := compiler.OpCode(instructions[ip])
+
 		var err error
 
 		switch operation {
 		case compiler.CONST:
-			constIndex := compiler.ReadUint16(vm.instructions[ip+1:])
-			ip += 2
+			constIndex := compiler.ReadUint16(instructions[ip+1:])
+			frame.ip += 2
 			err = vm.push(vm.constants[constIndex])
 		case compiler.EQ, compiler.NEQ, compiler.GT, compiler.GEQ:
 			err = vm.executeComparison(operation)
 		case compiler.ADD, compiler.SUB, compiler.MUL, compiler.DIV:
 			err = vm.executeBinaryOp(operation)
+		case compiler.BIT_AND, compiler.BIT_OR, compiler.BIT_XOR, compiler.SHL, compiler.SHR:
+			err = vm.executeBitwiseOp(operation)
 		case compiler.BANG:
 			err = vm.executeBangOperation()
 		case compiler.MINUS:
 			err = vm.executeMinusOperation()
+		case compiler.BIT_NOT:
+			err = vm.executeBitNotOperation()
+		case compiler.CONVERT:
+			tag := compiler.ReadUint8(instructions[ip+1:])
+			frame.ip += 1
+			err = vm.executeConversion(tag)
 		case compiler.TRUE:
 			err = vm.push(compiler.True)
 		case compiler.FALSE:
 			err = vm.push(compiler.False)
 		case compiler.JUMP:
-			targetInstruction := compiler.ReadUint16(vm.instructions[ip+1:])
-			ip = int(targetInstruction - 1)
+			targetInstruction := compiler.ReadUint16(instructions[ip+1:])
+			frame.ip = int(targetInstruction) - 1
 		case compiler.JNT:
-			targetInstruction := compiler.ReadUint16(vm.instructions[ip+1:])
-			conditionEval := vm.pop()
-			if !conditionEval.(*compiler.Boolean).Value {
-				ip = int(targetInstruction - 1)
+			targetInstruction := compiler.ReadUint16(instructions[ip+1:])
+			conditionEval, ok := vm.pop().(*compiler.Boolean)
+			if !ok {
+				err = fmt.Errorf("condition must be a boolean")
+			} else if !conditionEval.Value {
+				frame.ip = int(targetInstruction) - 1
 			} else {
-				ip += 2
+				frame.ip += 2
 			}
 		case compiler.GLOBAL_SET:
-			globalIndex := compiler.ReadUint16(vm.instructions[ip+1:])
-			ip += 2
+			globalIndex := compiler.ReadUint16(instructions[ip+1:])
+			frame.ip += 2
 
-			vm.globals[globalIndex] = vm.pop()
+			err = vm.setGlobal(int(globalIndex), vm.pop())
 		case compiler.GLOBAL_GET:
-			globalIndex := compiler.ReadUint16(vm.instructions[ip+1:])
-			ip += 2
-			err := vm.push(vm.globals[globalIndex])
-			if err != nil {
-				return err
+			globalIndex := compiler.ReadUint16(instructions[ip+1:])
+			frame.ip += 2
+			err = vm.push(vm.getGlobal(int(globalIndex)))
+		case compiler.LOCAL_SET:
+			localIndex := compiler.ReadUint8(instructions[ip+1:])
+			frame.ip += 1
+
+			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
+		case compiler.LOCAL_GET:
+			localIndex := compiler.ReadUint8(instructions[ip+1:])
+			frame.ip += 1
+			err = vm.push(vm.stack[frame.basePointer+int(localIndex)])
+		case compiler.BUILTIN_GET:
+			builtinIndex := compiler.ReadUint8(instructions[ip+1:])
+			frame.ip += 1
+			if int(builtinIndex) >= len(compiler.BUILTINS) {
+				err = fmt.Errorf("unknown built-in function %d", builtinIndex)
+			} else {
+				err = vm.push(compiler.BUILTINS[builtinIndex])
 			}
+		case compiler.CALL:
+			argsCount := compiler.ReadUint8(instructions[ip+1:])
+			frame.ip += 1
+			err = vm.callFunction(int(argsCount))
+		case compiler.RETURN_VALUE:
+			returnValue := vm.pop()
+			calleeFrame := vm.popFrame()
+			vm.sp = calleeFrame.basePointer - 1 // Also discards the callee
+			err = vm.push(returnValue)
+		case compiler.RETURN:
+			err = fmt.Errorf("function `%s` ended without returning a value", frame.function.Name)
+		case compiler.SPAWN:
+			argsCount := compiler.ReadUint8(instructions[ip+1:])
+			frame.ip += 1
+			err = vm.spawnFunction(int(argsCount))
+		case compiler.AWAIT:
+			err = vm.awaitFuture()
+		case compiler.MAKE_CHANNEL:
+			err = vm.makeChannel()
+		case compiler.SEND:
+			err = vm.sendOnChannel()
+		case compiler.RECV:
+			zeroIndex := compiler.ReadUint16(instructions[ip+1:])
+			frame.ip += 2
+			err = vm.receiveFromChannel(int(zeroIndex))
+		case compiler.CLOSE:
+			err = vm.closeChannel()
+		case compiler.ARRAY:
+			count := compiler.ReadUint16(instructions[ip+1:])
+			frame.ip += 2
+			err = vm.makeArray(int(count))
+		case compiler.MAP:
+			count := compiler.ReadUint16(instructions[ip+1:])
+			frame.ip += 2
+			err = vm.makeMap(int(count))
+		case compiler.INDEX_GET:
+			err = vm.getIndex()
+		case compiler.INDEX_SET:
+			err = vm.setIndex()
 		case compiler.IN:
-			globalIndex := compiler.ReadUint16(vm.instructions[ip+1:])
-			ip += 2
-
-			global := vm.globals[globalIndex]
-			switch global.Type() {
-			case compiler.UNSIGNED_INTEGER:
-				number := &compiler.UnsignedInteger{}
-				fmt.Scan(&number.Value)
-				vm.globals[globalIndex] = number
-			case compiler.INTEGER:
-				number := &compiler.Integer{}
-				fmt.Scan(&number.Value)
-				vm.globals[globalIndex] = number
-			case compiler.BOOLEAN:
-				number := &compiler.Boolean{}
-				fmt.Scan(&number.Value)
-				vm.globals[globalIndex] = number
-			}
+			err = vm.readInput()
 		case compiler.OUT:
 			output := vm.pop()
-			fmt.Println(output.Inspect())
+			_, err = fmt.Fprintln(vm.output, output.Inspect())
 		case compiler.POP:
 			vm.pop()
 		}
+		if errors.Is(err, ErrStackLimit) || errors.Is(err, ErrGlobalsLimit) {
+			// The instruction only popped its operands, the registers are enough to undo it
+			frame.ip, vm.sp, vm.framesIndex = ip-1, sp, framesIndex
+			return false, vm.stop(err)
+		}
 		if err != nil {
-			return err
+			return false, vm.locateError(err, frame, ip)
+		}
+		if blocked := vm.current.blocked; blocked != nil {
+			blocked.frame, blocked.ip = frame, ip
+			return false, nil
 		}
 	}
+	return false, nil
+}
+
+// Reads a value of the type of the operand from the input of the VM. The task is parked
+// during the read, which fails at the end of the input or on a value of another type.
+func (vm *VM) readInput() error {
+	current := vm.pop()
+
+	var value compiler.Object
+	var target any
+	var typeName string
+	switch current.Type() {
+	case compiler.UNSIGNED_INTEGER:
+		number := &compiler.UnsignedInteger{}
+		value, target, typeName = number, &number.Value, "uint"
+	case compiler.INTEGER:
+		number := &compiler.Integer{}
+		value, target, typeName = number, &number.Value, "int"
+	case compiler.BOOLEAN:
+		boolean := &compiler.Boolean{}
+		value, target, typeName = boolean, &boolean.Value, "bool"
+	case compiler.FLOAT:
+		number := &compiler.Float{}
+		value, target, typeName = number, &number.Value, "float"
+	case compiler.STRING:
+		str := &compiler.String{}
+		value, target, typeName = str, &str.Value, "string"
+	default:
+		return vm.push(current)
+	}
+
+	op := compiler.NewChannelOp()
+	input := vm.input
+	go func() {
+		err := input.scan(target)
+		switch {
+		case errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+			err = fmt.Errorf("could not read a `%s`: end of input", typeName)
+		case err != nil:
+			err = fmt.Errorf("could not read a `%s`: %s", typeName, err)
+		}
+		op.Complete(value, err == nil, err)
+	}()
+	return vm.block(&blocking{instruction: compiler.IN, op: op, external: true})
+}
+
+// Globals of spawned tasks hold the snapshot taken by spawn, they grow when set beyond it
+func (vm *VM) setGlobal(index int, value compiler.Object) error {
+	if vm.maxGlobals > 0 && index >= vm.maxGlobals {
+		return ErrGlobalsLimit
+	}
+	if index >= len(vm.globals) {
+		vm.globals = append(vm.globals, make([]compiler.Object, index+1-len(vm.globals))...)
+	}
+	vm.globals[index] = value
+	return nil
+}
+
+func (vm *VM) getGlobal(index int) compiler.Object {
+	if index >= len(vm.globals) {
+		return nil
+	}
+	return vm.globals[index]
+}
+
+// Calls the function placed below its arguments on the stack. Arguments become the first locals of the new frame.
+func (vm *VM) callFunction(argsCount int) error {
+	callee := vm.stack[vm.sp-1-argsCount]
+	switch callee := callee.(type) {
+	case *compiler.NativeFunction:
+		return vm.callNative(callee, argsCount)
+	case *compiler.Builtin:
+		return vm.callBuiltin(callee, argsCount)
+	}
+	function, ok := callee.(*compiler.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("cannot call a value of type `%s`", callee.Type())
+	}
+
+	if argsCount != function.NumParameters {
+		return fmt.Errorf("wrong number of arguments when calling `%s`: expected %d, got %d", function.Name, function.NumParameters, argsCount)
+	}
+
+	frame := NewFrame(function, vm.sp-argsCount)
+	if frame.basePointer+function.NumLocals >= STACK_SIZE {
+		return fmt.Errorf("stack overflow")
+	}
+
+	err := vm.growStack(frame.basePointer + function.NumLocals)
+	if err != nil {
+		return err
+	}
+	err = vm.pushFrame(frame)
+	if err != nil {
+		return err
+	}
+
+	vm.sp = frame.basePointer + function.NumLocals
 	return nil
 }
 
+// Calls the function of the host placed below its arguments on the stack, replacing them with
+// its value. The task is not parked, the function runs within the instruction.
+func (vm *VM) callNative(native *compiler.NativeFunction, argsCount int) error {
+	args := make([]compiler.Object, argsCount)
+	copy(args, vm.stack[vm.sp-argsCount:vm.sp])
+
+	value, err := native.Function(args)
+	if err != nil {
+		return fmt.Errorf("call to `%s` failed: %w", native.Name, err)
+	}
+	if value == nil {
+		return fmt.Errorf("native function `%s` returned no value", native.Name)
+	}
+
+	vm.sp -= argsCount + 1
+	return vm.push(value)
+}
+
+// Calls the built-in function placed below its arguments on the stack, replacing them with its
+// value. Its errors fail the program as they are, like the errors of instructions.
+func (vm *VM) callBuiltin(builtin *compiler.Builtin, argsCount int) error {
+	args := make([]compiler.Object, argsCount)
+	copy(args, vm.stack[vm.sp-argsCount:vm.sp])
+
+	value, err := builtin.Function(vm.output, args)
+	if err != nil {
+		return err
+	}
+
+	vm.sp -= argsCount + 1
+	return vm.push(value)
+}
+
+// Starts a task calling the function placed below its arguments on the stack, or hands the
+// call to the executor, replacing them with a future. The call gets copies of the arrays and
+// maps among its arguments and globals, wherever it runs.
+func (vm *VM) spawnFunction(argsCount int) error {
+	callee := vm.stack[vm.sp-1-argsCount]
+	function, ok := callee.(*compiler.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("cannot spawn a value of type `%s`", callee.Type())
+	}
+
+	if argsCount != function.NumParameters {
+		return fmt.Errorf("wrong number of arguments when spawning `%s`: expected %d, got %d", function.Name, function.NumParameters, argsCount)
+	}
+
+	args := make([]compiler.Object, argsCount)
+	copy(args, vm.stack[vm.sp-argsCount:vm.sp])
+	vm.sp -= argsCount + 1
+
+	lastGlobal := len(vm.globals) - 1
+	for lastGlobal >= 0 && vm.globals[lastGlobal] == nil {
+		lastGlobal--
+	}
+	globals := make([]compiler.Object, lastGlobal+1)
+	copy(globals, vm.globals)
+	copyCollections(args)
+	copyCollections(globals)
+
+	if vm.executor == nil {
+		return vm.push(vm.spawnTask(function, args, globals))
+	}
+
+	// From now on the program and the calls it spawns may print at the same time
+	if _, ok := vm.output.(*syncWriter); !ok {
+		vm.output = &syncWriter{writer: vm.output}
+	}
+
+	future := vm.executor.Spawn(&Call{
+		Function:  function,
+		Args:      args,
+		Constants: vm.constants,
+		Globals:   globals,
+		Debug:     vm.debug,
+		Input:     vm.input,
+		Output:    vm.output,
+	})
+	vm.pending = append(vm.pending, future)
+	return vm.push(future)
+}
+
+// Parks the task until the call of the future on top of the stack ends, then replaces the
+// future with its value
+func (vm *VM) awaitFuture() error {
+	operand := vm.pop()
+	future, ok := operand.(*compiler.Future)
+	if !ok {
+		return fmt.Errorf("cannot await a value of type `%s`", operand.Type())
+	}
+
+	return vm.block(&blocking{instruction: compiler.AWAIT, future: future, external: !vm.spawned[future]})
+}
+
 func (vm *VM) executeBangOperation() error {
 	operand := vm.pop()
 	switch operand {
@@ -138,17 +484,106 @@ func (vm *VM) executeMinusOperation() error {
 			return fmt.Errorf("overflow error when trying to apply `-` operator on `%d`", oper.Value)
 		}
 		return vm.push(&compiler.Integer{Value: -int64(oper.Value)})
+	case *compiler.Float:
+		return vm.push(&compiler.Float{Value: -oper.Value})
 	default:
 		return vm.push(compiler.False)
 	}
 }
 
+func (vm *VM) executeBitNotOperation() error {
+	operand := vm.pop()
+	switch oper := operand.(type) {
+	case *compiler.Integer:
+		return vm.push(&compiler.Integer{Value: ^oper.Value})
+	case *compiler.UnsignedInteger:
+		return vm.push(&compiler.UnsignedInteger{Value: ^oper.Value})
+	default:
+		return fmt.Errorf("cannot apply `~` operator on operand of type `%s`", operand.Type())
+	}
+}
+
+func (vm *VM) executeBitwiseOp(opCode compiler.OpCode) error {
+	right := vm.pop()
+	left := vm.pop()
+	if !compiler.IsObjectNumber(left) || !compiler.IsObjectNumber(right) {
+		return fmt.Errorf("cannot do bitwise operations on operands of type `%s` and `%s`", left.Type(), right.Type())
+	}
+
+	if opCode == compiler.SHL || opCode == compiler.SHR {
+		return vm.executeShiftOp(opCode, left, right)
+	}
+
+	// Like arithmetic, the result is unsigned only when both operands are
+	leftUnsigned, leftIsUnsigned := left.(*compiler.UnsignedInteger)
+	rightUnsigned, rightIsUnsigned := right.(*compiler.UnsignedInteger)
+	if leftIsUnsigned && rightIsUnsigned {
+		leftValue, rightValue := leftUnsigned.Value, rightUnsigned.Value
+		switch opCode {
+		case compiler.BIT_AND:
+			return vm.push(&compiler.UnsignedInteger{Value: leftValue & rightValue})
+		case compiler.BIT_OR:
+			return vm.push(&compiler.UnsignedInteger{Value: leftValue | rightValue})
+		case compiler.BIT_XOR:
+			return vm.push(&compiler.UnsignedInteger{Value: leftValue ^ rightValue})
+		}
+	} else {
+		leftValue, rightValue, err := signedOperands(left, right)
+		if err != nil {
+			return err
+		}
+		switch opCode {
+		case compiler.BIT_AND:
+			return vm.push(&compiler.Integer{Value: leftValue & rightValue})
+		case compiler.BIT_OR:
+			return vm.push(&compiler.Integer{Value: leftValue | rightValue})
+		case compiler.BIT_XOR:
+			return vm.push(&compiler.Integer{Value: leftValue ^ rightValue})
+		}
+	}
+	return fmt.Errorf("could not do bitwise op: %d", opCode)
+}
+
+// Shifts keep the type of the left operand
+func (vm *VM) executeShiftOp(opCode compiler.OpCode, left compiler.Object, right compiler.Object) error {
+	var count uint64
+	switch right := right.(type) {
+	case *compiler.Integer:
+		if right.Value < 0 {
+			return fmt.Errorf("negative shift count `%d`", right.Value)
+		}
+		count = uint64(right.Value)
+	case *compiler.UnsignedInteger:
+		count = right.Value
+	}
+
+	switch leftValue := left.(type) {
+	case *compiler.UnsignedInteger:
+		if opCode == compiler.SHL {
+			return vm.push(&compiler.UnsignedInteger{Value: leftValue.Value << count})
+		}
+		return vm.push(&compiler.UnsignedInteger{Value: leftValue.Value >> count})
+	case *compiler.Integer:
+		if opCode == compiler.SHL {
+			return vm.push(&compiler.Integer{Value: leftValue.Value << count})
+		}
+		return vm.push(&compiler.Integer{Value: leftValue.Value >> count})
+	}
+	return fmt.Errorf("could not do shift op: %d", opCode)
+}
+
 func (vm *VM) executeComparison(opCode compiler.OpCode) error {
 	right := vm.pop()
 	left := vm.pop()
 	if compiler.IsObjectNumber(left) && compiler.IsObjectNumber(right) {
 		return vm.executeIntegerComparison(opCode, left, right)
 	}
+	if leftValue, rightValue, ok := floatOperands(left, right); ok {
+		return vm.executeFloatComparison(opCode, leftValue, rightValue)
+	}
+	if left.Type() == compiler.STRING && right.Type() == compiler.STRING {
+		return vm.executeStringComparison(opCode, left.(*compiler.String).Value, right.(*compiler.String).Value)
+	}
 
 	switch opCode {
 	case compiler.EQ:
@@ -160,61 +595,47 @@ func (vm *VM) executeComparison(opCode compiler.OpCode) error {
 	}
 }
 
+// Strings are ordered lexicographically, byte by byte
+func (vm *VM) executeStringComparison(opCode compiler.OpCode, left string, right string) error {
+	switch opCode {
+	case compiler.EQ:
+		return vm.push(compiler.ParseBooleanFromNative(left == right))
+	case compiler.NEQ:
+		return vm.push(compiler.ParseBooleanFromNative(left != right))
+	case compiler.GT:
+		return vm.push(compiler.ParseBooleanFromNative(left > right))
+	case compiler.GEQ:
+		return vm.push(compiler.ParseBooleanFromNative(left >= right))
+	}
+	return fmt.Errorf("unknown operator: %d", opCode)
+}
+
+func (vm *VM) executeFloatComparison(opCode compiler.OpCode, left float64, right float64) error {
+	switch opCode {
+	case compiler.EQ:
+		return vm.push(compiler.ParseBooleanFromNative(left == right))
+	case compiler.NEQ:
+		return vm.push(compiler.ParseBooleanFromNative(left != right))
+	case compiler.GT:
+		return vm.push(compiler.ParseBooleanFromNative(left > right))
+	case compiler.GEQ:
+		return vm.push(compiler.ParseBooleanFromNative(left >= right))
+	}
+	return fmt.Errorf("unknown operator: %d", opCode)
+}
+
+// Integers are compared by their values, whatever their signedness
 func (vm *VM) executeIntegerComparison(opCode compiler.OpCode, left compiler.Object, right compiler.Object) error {
-	leftType := left.Type()
-	rightType := right.Type()
-	if leftType == compiler.INTEGER && rightType == compiler.UNSIGNED_INTEGER {
-		leftValue := left.(*compiler.Integer).Value
-		rightValue := right.(*compiler.UnsignedInteger).Value
-		switch opCode {
-		case compiler.EQ:
-			return vm.push(compiler.ParseBooleanFromNative(leftValue == int64(rightValue)))
-		case compiler.NEQ:
-			return vm.push(compiler.ParseBooleanFromNative(leftValue != int64(rightValue)))
-		case compiler.GT:
-			return vm.push(compiler.ParseBooleanFromNative(leftValue > int64(rightValue)))
-		case compiler.GEQ:
-			return vm.push(compiler.ParseBooleanFromNative(leftValue >= int64(rightValue)))
-		}
-	} else if leftType == compiler.UNSIGNED_INTEGER && rightType == compiler.INTEGER {
-		leftValue := left.(*compiler.UnsignedInteger).Value
-		rightValue := right.(*compiler.Integer).Value
-		switch opCode {
-		case compiler.EQ:
-			return vm.push(compiler.ParseBooleanFromNative(int64(leftValue) == rightValue))
-		case compiler.NEQ:
-			return vm.push(compiler.ParseBooleanFromNative(int64(leftValue) != rightValue))
-		case compiler.GT:
-			return vm.push(compiler.ParseBooleanFromNative(int64(leftValue) > rightValue))
-		case compiler.GEQ:
-			return vm.push(compiler.ParseBooleanFromNative(int64(leftValue) >= rightValue))
-		}
-	} else if leftType == compiler.UNSIGNED_INTEGER && rightType == compiler.UNSIGNED_INTEGER {
-		leftValue := left.(*compiler.UnsignedInteger).Value
-		rightValue := right.(*compiler.UnsignedInteger).Value
-		switch opCode {
-		case compiler.EQ:
-			return vm.push(compiler.ParseBooleanFromNative(leftValue == rightValue))
-		case compiler.NEQ:
-			return vm.push(compiler.ParseBooleanFromNative(leftValue != rightValue))
-		case compiler.GT:
-			return vm.push(compiler.ParseBooleanFromNative(leftValue > rightValue))
-		case compiler.GEQ:
-			return vm.push(compiler.ParseBooleanFromNative(leftValue >= rightValue))
-		}
-	} else /*if leftType == compiler.INTEGER && rightType == compiler.INTEGER*/ {
-		leftValue := left.(*compiler.Integer).Value
-		rightValue := right.(*compiler.Integer).Value
-		switch opCode {
-		case compiler.EQ:
-			return vm.push(compiler.ParseBooleanFromNative(leftValue == rightValue))
-		case compiler.NEQ:
-			return vm.push(compiler.ParseBooleanFromNative(leftValue != rightValue))
-		case compiler.GT:
-			return vm.push(compiler.ParseBooleanFromNative(leftValue > rightValue))
-		case compiler.GEQ:
-			return vm.push(compiler.ParseBooleanFromNative(leftValue >= rightValue))
-		}
+	comparison := compiler.CompareIntegers(left, right)
+	switch opCode {
+	case compiler.EQ:
+		return vm.push(compiler.ParseBooleanFromNative(comparison == 0))
+	case compiler.NEQ:
+		return vm.push(compiler.ParseBooleanFromNative(comparison != 0))
+	case compiler.GT:
+		return vm.push(compiler.ParseBooleanFromNative(comparison > 0))
+	case compiler.GEQ:
+		return vm.push(compiler.ParseBooleanFromNative(comparison >= 0))
 	}
 	return fmt.Errorf("unknown operator: %d", opCode)
 }
@@ -224,85 +645,106 @@ func (vm *VM) executeBinaryOp(opCode compiler.OpCode) error {
 	left := vm.pop()
 	leftType := left.Type()
 	rightType := right.Type()
-	if leftType == compiler.INTEGER || leftType == compiler.UNSIGNED_INTEGER || rightType == compiler.INTEGER || rightType == compiler.UNSIGNED_INTEGER {
+	if compiler.IsObjectNumber(left) && compiler.IsObjectNumber(right) {
 		return vm.executeBinaryIntegerOp(opCode, left, right)
 	}
+	if leftValue, rightValue, ok := floatOperands(left, right); ok {
+		return vm.executeBinaryFloatOp(opCode, leftValue, rightValue)
+	}
+	if leftType == compiler.STRING && rightType == compiler.STRING && opCode == compiler.ADD {
+		return vm.push(&compiler.String{Value: left.(*compiler.String).Value + right.(*compiler.String).Value})
+	}
 	return fmt.Errorf("cannot do binary operations on operands of type `%s` and `%s`", leftType, rightType)
 }
 
-func (vm *VM) executeBinaryIntegerOp(opCode compiler.OpCode, left compiler.Object, right compiler.Object) error {
+// Operands of an operation on floats: both numbers, one of them at least a float. The integer
+// one is promoted to a float.
+func floatOperands(left compiler.Object, right compiler.Object) (float64, float64, bool) {
+	if left.Type() != compiler.FLOAT && right.Type() != compiler.FLOAT {
+		return 0, 0, false
+	}
+	leftValue, leftOk := compiler.FloatValue(left)
+	rightValue, rightOk := compiler.FloatValue(right)
+	return leftValue, rightValue, leftOk && rightOk
+}
+
+func (vm *VM) executeBinaryFloatOp(opCode compiler.OpCode, left float64, right float64) error {
 	switch opCode {
-	case compiler.ADD: // TODO: Refactor this
-		if left.Type() == compiler.INTEGER {
-			leftValue := left.(*compiler.Integer).Value
-			if right.Type() == compiler.UNSIGNED_INTEGER {
-				return vm.push(&compiler.Integer{Value: leftValue + int64(right.(*compiler.UnsignedInteger).Value)})
-			} else {
-				return vm.push(&compiler.Integer{Value: leftValue + right.(*compiler.Integer).Value})
-			}
-		} else {
-			leftValue := left.(*compiler.UnsignedInteger).Value
-			if right.Type() == compiler.UNSIGNED_INTEGER {
-				return vm.push(&compiler.UnsignedInteger{Value: leftValue + right.(*compiler.UnsignedInteger).Value})
-			} else {
-				return vm.push(&compiler.Integer{Value: int64(leftValue) + right.(*compiler.Integer).Value})
-			}
-		}
+	case compiler.ADD:
+		return vm.push(&compiler.Float{Value: left + right})
 	case compiler.SUB:
-		if left.Type() == compiler.INTEGER {
-			leftValue := left.(*compiler.Integer).Value
-			if right.Type() == compiler.UNSIGNED_INTEGER {
-				return vm.push(&compiler.Integer{Value: leftValue - int64(right.(*compiler.UnsignedInteger).Value)})
-			} else {
-				return vm.push(&compiler.Integer{Value: leftValue - right.(*compiler.Integer).Value})
-			}
-		} else {
-			leftValue := left.(*compiler.UnsignedInteger).Value
-			if right.Type() == compiler.UNSIGNED_INTEGER {
-				return vm.push(&compiler.UnsignedInteger{Value: leftValue - right.(*compiler.UnsignedInteger).Value})
-			} else {
-				return vm.push(&compiler.Integer{Value: int64(leftValue) - right.(*compiler.Integer).Value})
-			}
-		}
+		return vm.push(&compiler.Float{Value: left - right})
 	case compiler.MUL:
-		if left.Type() == compiler.INTEGER {
-			leftValue := left.(*compiler.Integer).Value
-			if right.Type() == compiler.UNSIGNED_INTEGER {
-				return vm.push(&compiler.Integer{Value: leftValue * int64(right.(*compiler.UnsignedInteger).Value)})
-			} else {
-				return vm.push(&compiler.Integer{Value: leftValue * right.(*compiler.Integer).Value})
-			}
-		} else {
-			leftValue := left.(*compiler.UnsignedInteger).Value
-			if right.Type() == compiler.UNSIGNED_INTEGER {
-				return vm.push(&compiler.UnsignedInteger{Value: leftValue * right.(*compiler.UnsignedInteger).Value})
-			} else {
-				return vm.push(&compiler.Integer{Value: int64(leftValue) * right.(*compiler.Integer).Value})
+		return vm.push(&compiler.Float{Value: left * right})
+	case compiler.DIV:
+		// Like integers, rather than giving infinities
+		if right == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		return vm.push(&compiler.Float{Value: left / right})
+	}
+	return fmt.Errorf("could not do binary float op: %d", opCode)
+}
+
+// Like bitwise operations, the result is unsigned only when both operands are. Otherwise the
+// unsigned operand must fit in a signed integer.
+func (vm *VM) executeBinaryIntegerOp(opCode compiler.OpCode, left compiler.Object, right compiler.Object) error {
+	leftUnsigned, leftIsUnsigned := left.(*compiler.UnsignedInteger)
+	rightUnsigned, rightIsUnsigned := right.(*compiler.UnsignedInteger)
+	if leftIsUnsigned && rightIsUnsigned {
+		leftValue, rightValue := leftUnsigned.Value, rightUnsigned.Value
+		switch opCode {
+		case compiler.ADD:
+			return vm.push(&compiler.UnsignedInteger{Value: leftValue + rightValue})
+		case compiler.SUB:
+			return vm.push(&compiler.UnsignedInteger{Value: leftValue - rightValue})
+		case compiler.MUL:
+			return vm.push(&compiler.UnsignedInteger{Value: leftValue * rightValue})
+		case compiler.DIV:
+			if rightValue == 0 {
+				return fmt.Errorf("division by zero")
 			}
+			return vm.push(&compiler.UnsignedInteger{Value: leftValue / rightValue})
 		}
+		return fmt.Errorf("could not do binary integer op: %d", opCode)
+	}
+
+	leftValue, rightValue, err := signedOperands(left, right)
+	if err != nil {
+		return err
+	}
+	switch opCode {
+	case compiler.ADD:
+		return vm.push(&compiler.Integer{Value: leftValue + rightValue})
+	case compiler.SUB:
+		return vm.push(&compiler.Integer{Value: leftValue - rightValue})
+	case compiler.MUL:
+		return vm.push(&compiler.Integer{Value: leftValue * rightValue})
 	case compiler.DIV:
-		if left.Type() == compiler.INTEGER {
-			leftValue := left.(*compiler.Integer).Value
-			if right.Type() == compiler.UNSIGNED_INTEGER {
-				return vm.push(&compiler.Integer{Value: leftValue / int64(right.(*compiler.UnsignedInteger).Value)})
-			} else {
-				return vm.push(&compiler.Integer{Value: leftValue / right.(*compiler.Integer).Value})
-			}
-		} else {
-			leftValue := left.(*compiler.UnsignedInteger).Value
-			if right.Type() == compiler.UNSIGNED_INTEGER {
-				return vm.push(&compiler.UnsignedInteger{Value: leftValue / right.(*compiler.UnsignedInteger).Value})
-			} else {
-				return vm.push(&compiler.Integer{Value: int64(leftValue) / right.(*compiler.Integer).Value})
-			}
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero")
 		}
+		return vm.push(&compiler.Integer{Value: leftValue / rightValue})
 	}
 	return fmt.Errorf("could not do binary integer op: %d", opCode)
 }
 
+// Values of two integer operands as signed integers
+func signedOperands(left compiler.Object, right compiler.Object) (int64, int64, error) {
+	leftValue, err := signedValue(left)
+	if err != nil {
+		return 0, 0, err
+	}
+	rightValue, err := signedValue(right)
+	return leftValue, rightValue, err
+}
+
 func (vm *VM) push(obj compiler.Object) error {
-	if vm.sp >= STACK_SIZE {
-		return fmt.Errorf("stack overflow")
+	if vm.sp >= len(vm.stack) {
+		err := vm.growStack(vm.sp + 1)
+		if err != nil {
+			return err
+		}
 	}
 
 	vm.stack[vm.sp] = obj
@@ -311,6 +753,28 @@ func (vm *VM) push(obj compiler.Object) error {
 	return nil
 }
 
+// Enlarges the stack of the running task to hold size values, up to STACK_SIZE
+func (vm *VM) growStack(size int) error {
+	if size <= len(vm.stack) {
+		return nil
+	}
+	if vm.maxStack > 0 && size > vm.maxStack {
+		return ErrStackLimit
+	}
+	if size > STACK_SIZE {
+		return fmt.Errorf("stack overflow")
+	}
+
+	limit := STACK_SIZE
+	if vm.maxStack > 0 {
+		limit = min(vm.maxStack, STACK_SIZE)
+	}
+	grown := make([]compiler.Object, min(max(size, 2*len(vm.stack)), limit))
+	copy(grown, vm.stack)
+	vm.stack = grown
+	return nil
+}
+
 func (vm *VM) pop() compiler.Object {
 	obj := vm.stack[vm.sp-1]
 	vm.sp--
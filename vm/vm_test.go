@@ -0,0 +1,740 @@
+package vm
+
+import (
+	"atlas/checker"
+	"atlas/compiler"
+	"atlas/parser"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// Parses and compiles input, failing the test when it is invalid. Checked programs go through
+// the checker first, which settles the types of their literals.
+func compileProgram(t *testing.T, input string, checked bool) compiler.ByteCode {
+	t.Helper()
+
+	pars := parser.New(&input)
+	program := pars.Parse()
+	if len(pars.Errors) > 0 {
+		t.Fatalf("parsing failed: %v", pars.Errors)
+	}
+	if checked {
+		check := checker.New()
+		check.Check(&program)
+		if len(check.Errors) > 0 {
+			t.Fatalf("invalid program %q: %v", input, check.Errors)
+		}
+	}
+
+	comp := compiler.New()
+	err := comp.Compile(&program)
+	if err != nil {
+		t.Fatalf("compilation failed: %s", err)
+	}
+	return comp.ByteCode()
+}
+
+func runProgram(t *testing.T, input string) (*VM, error) {
+	t.Helper()
+
+	vm := New(compileProgram(t, input, false))
+	return &vm, vm.Run()
+}
+
+// Runs input with options and returns what it printed
+func runWithOptions(t *testing.T, input string, options ...Option) (string, error) {
+	t.Helper()
+	return run(compileProgram(t, input, false), options...)
+}
+
+// Runs input like runWithOptions once the checker accepted it, which settles the types of
+// its literals
+func runChecked(t *testing.T, input string, options ...Option) (string, error) {
+	t.Helper()
+	return run(compileProgram(t, input, true), options...)
+}
+
+func run(byteCode compiler.ByteCode, options ...Option) (string, error) {
+	var output strings.Builder
+	vm := New(byteCode, append(options, WithOutput(&output))...)
+	err := vm.Run()
+	return output.String(), err
+}
+
+func testUnsignedIntegerObject(t *testing.T, obj compiler.Object, expected uint64) {
+	t.Helper()
+
+	integer, ok := obj.(*compiler.UnsignedInteger)
+	if !ok {
+		t.Fatalf("object is not *UnsignedInteger. got=%T (%+v)", obj, obj)
+	}
+	if integer.Value != expected {
+		t.Errorf("integer.Value not %d. got=%d", expected, integer.Value)
+	}
+}
+
+func TestFunctionCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected uint64
+	}{
+		{"fun five(): uint { return 5; } five();", 5},
+		{"fun add(a: uint, b: uint): uint { return a + b; } add(2, 3);", 5},
+		{"fun add(a: uint, b: uint): uint { var c = a + b; return c; } add(add(1, 2), 3);", 6},
+		{"var x = 10; fun getX(): uint { return x; } getX();", 10},
+		{`fun fibonacci(n: uint): uint {
+			if n <= 1 {
+				return n;
+			}
+			return fibonacci(n - 1) + fibonacci(n - 2);
+		}
+		fibonacci(10);`, 55},
+	}
+
+	for _, tt := range tests {
+		vm, err := runProgram(t, tt.input)
+		if err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		testUnsignedIntegerObject(t, vm.PoppedGhost(), tt.expected)
+	}
+}
+
+func TestFunctionCallErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fun add(a: uint, b: uint): uint { return a + b; } add(1);", "wrong number of arguments when calling `add`: expected 2, got 1"},
+		{"fun nothing(): uint { var a = 1; } nothing();", "function `nothing` ended without returning a value"},
+		{"fun forever(): uint { return forever(); } forever();", "stack overflow"},
+		{"var x = 1; x();", "cannot call a value of type `UNSIGNED_INTEGER`"},
+		{"fun div(a: uint, b: uint): uint { return a / b; } div(1, 0);", "division by zero"},
+	}
+
+	for _, tt := range tests {
+		_, err := runProgram(t, tt.input)
+		if err == nil {
+			t.Fatalf("expected error for %q", tt.input)
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestBlockScopes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected uint64
+	}{
+		{"var a = 1; if true { var a = 2; a = a + 1; } a;", 1},
+		{"var a = 1; if true { var b = 2; a = a + b; } a;", 3},
+		{"var i = 0; var sum = 0; loop i < 3 { var twice = i * 2; sum = sum + twice; i = i + 1; } sum;", 6},
+		{"fun f(n: uint): uint { if n > 0 { var n = 10; return n; } return n; } f(1) + f(0);", 10},
+		{"var x = 1; if x > 5 { x = 2; } else if x < 3 { x = 3; } else { x = 4; } x;", 3},
+	}
+
+	for _, tt := range tests {
+		vm, err := runProgram(t, tt.input)
+		if err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		testUnsignedIntegerObject(t, vm.PoppedGhost(), tt.expected)
+	}
+}
+
+func TestBitwiseOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected uint64
+	}{
+		{"5 & 3;", 1},
+		{"5 | 2;", 7},
+		{"5 ^ 1;", 4},
+		{"1 << 4;", 16},
+		{"256 >> 4;", 16},
+		{"5 & 3 | 2;", 3},
+		{"1 | 6 ^ 3 & 2;", 5},
+		{"1 + 1 << 2;", 8},
+		{"~0 >> 60;", 15},
+	}
+
+	for _, tt := range tests {
+		vm, err := runProgram(t, tt.input)
+		if err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		testUnsignedIntegerObject(t, vm.PoppedGhost(), tt.expected)
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true && true;", true},
+		{"true && false;", false},
+		{"false || true;", true},
+		{"false || false;", false},
+		{"1 < 2 && 2 < 3;", true},
+		{"false && true || true;", true},
+		{"true || true && false;", true},
+		{"(10 & 1) == 0;", true},
+		// Right operands are not evaluated, the call would fail with a wrong arity
+		{"fun f(): bool { return true; } false && f(1);", false},
+		{"fun f(): bool { return true; } true || f(1);", true},
+	}
+
+	for _, tt := range tests {
+		vm, err := runProgram(t, tt.input)
+		if err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		boolean, ok := vm.PoppedGhost().(*compiler.Boolean)
+		if !ok {
+			t.Fatalf("object is not *Boolean for %q. got=%T", tt.input, vm.PoppedGhost())
+		}
+		if boolean.Value != tt.expected {
+			t.Errorf("wrong result for %q. expected=%t, got=%t", tt.input, tt.expected, boolean.Value)
+		}
+	}
+}
+
+func TestRuntimeErrorLocation(t *testing.T) {
+	input := "var a = 4;\nfun div(x: uint, y: uint): uint {\n\treturn x / y;\n}\nvar b = div(a, 0);"
+
+	pars := parser.New(&input)
+	program := pars.Parse()
+	comp := compiler.New()
+	err := comp.Compile(&program)
+	if err != nil {
+		t.Fatalf("compilation failed: %s", err)
+	}
+
+	byteCode := comp.ByteCode()
+	byteCode.Debug.File = "div.atl"
+	byteCode.Debug.Source = input
+
+	vm := New(byteCode)
+	err = vm.Run()
+
+	var runtimeError *RuntimeError
+	if !errors.As(err, &runtimeError) {
+		t.Fatalf("error is not *RuntimeError. got=%T (%v)", err, err)
+	}
+	if runtimeError.Function != "div" || runtimeError.Row != 3 || runtimeError.Col != 11 {
+		t.Errorf("wrong location. got=%s:%d:%d", runtimeError.Function, runtimeError.Row, runtimeError.Col)
+	}
+
+	expected := "div.atl:3:11: division by zero\n 3 | \treturn x / y;\n   | \t         ^"
+	if err.Error() != expected {
+		t.Errorf("wrong message. expected=%q, got=%q", expected, err.Error())
+	}
+
+	byteCode.Debug = nil
+	vm = New(byteCode)
+	err = vm.Run()
+	if err == nil || err.Error() != "division by zero" {
+		t.Errorf("wrong error without debug information. got=%v", err)
+	}
+}
+
+func TestSpawnAndAwait(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected uint64
+	}{
+		{"fun square(x: uint): uint { return x * x; } var h = spawn square(4); await h;", 16},
+		{"fun one(): uint { return 1; } var h = spawn one(); await h + await h;", 2},
+		{"var base = 10; fun addBase(x: uint): uint { return x + base; } var h = spawn addBase(1); base = 20; await h;", 11},
+		{`fun square(x: uint): uint { return x * x; }
+		fun sumSquares(a: uint, b: uint): uint {
+			var h = spawn square(a);
+			return square(b) + await h;
+		}
+		await spawn sumSquares(2, 3);`, 13},
+	}
+
+	for _, tt := range tests {
+		vm, err := runProgram(t, tt.input)
+		if err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		testUnsignedIntegerObject(t, vm.PoppedGhost(), tt.expected)
+	}
+}
+
+func TestSpawnErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fun add(a: uint, b: uint): uint { return a + b; } spawn add(1);", "wrong number of arguments when spawning `add`: expected 2, got 1"},
+		{"var x = 1; spawn x();", "cannot spawn a value of type `UNSIGNED_INTEGER`"},
+		{"var x = 1; await x;", "cannot await a value of type `UNSIGNED_INTEGER`"},
+		{"fun div(a: uint, b: uint): uint { return a / b; } var h = spawn div(1, 0); await h;", "1:76: spawned call to `div` failed\ncaused by: 1:44: division by zero"},
+	}
+
+	for _, tt := range tests {
+		_, err := runProgram(t, tt.input)
+		if err == nil {
+			t.Fatalf("expected error for %q", tt.input)
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+// Runs the spawned calls right away, recording the functions spawned
+type recordingExecutor struct {
+	functions []string
+}
+
+func (executor *recordingExecutor) Spawn(call *Call) *compiler.Future {
+	executor.functions = append(executor.functions, call.Function.Name)
+	future := compiler.NewFuture(call.Function.Name)
+	future.Resolve(call.Run(WithExecutor(executor)))
+	return future
+}
+
+func TestWithExecutor(t *testing.T) {
+	input := `fun double(x: uint): uint { return x * 2; }
+	fun quadruple(x: uint): uint { return await spawn double(await spawn double(x)); }
+	await spawn quadruple(3);`
+
+	pars := parser.New(&input)
+	program := pars.Parse()
+	comp := compiler.New()
+	err := comp.Compile(&program)
+	if err != nil {
+		t.Fatalf("compilation failed: %s", err)
+	}
+
+	executor := &recordingExecutor{}
+	vm := New(comp.ByteCode(), WithExecutor(executor))
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testUnsignedIntegerObject(t, vm.PoppedGhost(), 12)
+
+	expected := []string{"quadruple", "double", "double"}
+	if strings.Join(executor.functions, " ") != strings.Join(expected, " ") {
+		t.Errorf("wrong spawned functions. expected=%v, got=%v", expected, executor.functions)
+	}
+}
+
+func TestChannels(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected uint64
+	}{
+		{`fun produce(c: chan uint, n: uint): uint {
+			var i: uint = 0;
+			loop i < n { send(c, i * i); i = i + 1; }
+			close(c);
+			return n;
+		}
+		var c = chan();
+		var h = spawn produce(c, 4);
+		var sum: uint = 0;
+		var i: uint = 0;
+		loop i < 6 { sum = sum + recv(c); i = i + 1; }
+		sum + await h;`, 18},
+		{"var c = chan(2); send(c, 3); send(c, 4); recv(c) * 10 + recv(c);", 34},
+		{"var c: chan uint = chan(1); send(c, 5); close(c); recv(c) + recv(c);", 5},
+		{`fun relay(from: chan uint, to: chan uint): uint { send(to, recv(from) + 1); return 0; }
+		var a = chan(); var b = chan();
+		var h = spawn relay(a, b);
+		send(a, 41);
+		recv(b);`, 42},
+	}
+
+	for _, tt := range tests {
+		vm, err := runProgram(t, tt.input)
+		if err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		testUnsignedIntegerObject(t, vm.PoppedGhost(), tt.expected)
+	}
+}
+
+// The checker gives its element type to a receive, which gets the zero value of that type
+// once the channel is closed
+func TestChannelZeroValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected compiler.Object
+	}{
+		{"var c: chan bool = chan(); close(c); recv(c);", compiler.False},
+		{"var c: chan int = chan(); close(c); recv(c);", &compiler.Integer{Value: 0}},
+		{"var c: chan string = chan(); close(c); recv(c);", &compiler.String{Value: ""}},
+		{"var c: chan float = chan(); close(c); recv(c);", &compiler.Float{Value: 0}},
+		{"var c = chan(1); send(c, 1); close(c); recv(c) * recv(c);", &compiler.UnsignedInteger{Value: 0}},
+	}
+
+	for _, tt := range tests {
+		pars := parser.New(&tt.input)
+		program := pars.Parse()
+		check := checker.New()
+		check.Check(&program)
+		if len(pars.Errors) > 0 || len(check.Errors) > 0 {
+			t.Fatalf("invalid program %q: %v %v", tt.input, pars.Errors, check.Errors)
+		}
+
+		comp := compiler.New()
+		err := comp.Compile(&program)
+		if err != nil {
+			t.Fatalf("compilation failed: %s", err)
+		}
+		vm := New(comp.ByteCode())
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		if vm.PoppedGhost().Inspect() != tt.expected.Inspect() || vm.PoppedGhost().Type() != tt.expected.Type() {
+			t.Errorf("wrong zero value for %q. expected=%+v, got=%+v", tt.input, tt.expected, vm.PoppedGhost())
+		}
+	}
+}
+
+func TestChannelErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var c = chan(1); close(c); send(c, 1);", "send on closed channel"},
+		{"var c = chan(); close(c); close(c);", "close of closed channel"},
+		{"var a = 1; send(a, 1);", "cannot send on a value of type `UNSIGNED_INTEGER`"},
+		{"var a = true; close(a);", "cannot close a value of type `BOOLEAN`"},
+		{"var n: int = -1; var c = chan(n);", "negative channel capacity"},
+	}
+
+	for _, tt := range tests {
+		_, err := runProgram(t, tt.input)
+		if err == nil {
+			t.Fatalf("expected error for %q", tt.input)
+		}
+		if !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error for %q. expected=%q, got=%q", tt.input, tt.expected, err.Error())
+		}
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`var s = "Hello"; return s + ", " + "world\t!";`, "Hello, world\t!\n"},
+		{`return "abc" == "abc"; return "abc" != "abc"; return "" == "a";`, "true\nfalse\nfalse\n"},
+		{`return "apple" < "banana"; return "b" <= "a"; return "ab" > "a"; return "a" >= "a";`, "true\nfalse\ntrue\ntrue\n"},
+		{`var s = "é"; return len(s); return len("");`, "2\n0\n"},
+		{`fun greet(name: string): string { return "hi " + name; } println(greet("bob"));`, "hi bob\n"},
+	}
+
+	for _, tt := range tests {
+		output, err := runWithOptions(t, tt.input)
+		if err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		if output != tt.expected {
+			t.Errorf("wrong output for %q. expected=%q, got=%q", tt.input, tt.expected, output)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`var a = "a" - "b";`, "cannot do binary operations on operands of type `STRING` and `STRING`"},
+		{`var a = "a" + 1;`, "cannot do binary operations on operands of type `STRING` and `UNSIGNED_INTEGER`"},
+		{`var a = 1 < "b";`, "could not apply operator"},
+	}
+	for _, tt := range errorTests {
+		_, err := runWithOptions(t, tt.input)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error for %q. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestArrays(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var a = [1, 2, 3]; println(a, len(a), a[0] + a[2]);", "[1, 2, 3] 3 4\n"},
+		{"var a = [1, 2]; var b = a; b[1] = 5; println(a[1]); var i = -1; a[i + 1] = 7; println(a);", "5\n[7, 5]\n"},
+		{"var m = [[1], [2, 3], []]; m[1][0] = m[0][0]; println(m, len(m[2]));", "[[1], [1, 3], []] 0\n"},
+		{`var s = ["a b", "c"]; println(s, s[0]);`, "[\"a b\", \"c\"] a b\n"},
+		{"fun first(a: []uint): uint { a[0] = 9; return a[0]; } var a = [1]; println(first(a), a);", "9 [9]\n"},
+		// Spawned calls and receivers get copies of the arrays
+		{"fun set(a: []uint): uint { a[0] = 9; return a[0]; } var a = [1]; var h = spawn set(a); println(await h, a);", "9 [1]\n"},
+		{"var c = chan(1); var a = [1]; send(c, a); a[0] = 2; println(recv(c), a);", "[1] [2]\n"},
+	}
+
+	for _, tt := range tests {
+		output, err := runWithOptions(t, tt.input)
+		if err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		if output != tt.expected {
+			t.Errorf("wrong output for %q. expected=%q, got=%q", tt.input, tt.expected, output)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"var a = [1, 2, 3]; a[3] = 0;", "1:21: index 3 out of bounds for array of length 3"},
+		{"var a = [1]; var i = -1; println(a[i]);", "1:35: index -1 out of bounds for array of length 1"},
+		{"var a = []; a[0];", "index 0 out of bounds for array of length 0"},
+		{"var a = [1]; a[true];", "array index must be an integer, got `BOOLEAN`"},
+		{"var a = 1; a[0];", "cannot index a value of type `UNSIGNED_INTEGER`"},
+		{"var a = 1; a[0] = 2;", "cannot assign to an index of a value of type `UNSIGNED_INTEGER`"},
+	}
+	for _, tt := range errorTests {
+		_, err := runWithOptions(t, tt.input)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error for %q. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestMaps(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`var m = {"b": 2, "a": 1}; println(m, len(m), m["a"] + m["b"]);`, "{\"a\": 1, \"b\": 2} 2 3\n"},
+		{`var m = {"a": 1}; var n = m; n["a"] = 5; n["b"] = 6; println(m);`, "{\"a\": 5, \"b\": 6}\n"},
+		{`var m = {"a": 1, "b": 2}; delete(m, "a"); delete(m, "c"); println(m, has(m, "a"), has(m, "b"));`, "{\"b\": 2} false true\n"},
+		{"var m = {3: true, 1: false, 2: true}; var k = keys(m); var i = 0; loop i < len(k) { print(k[i], m[k[i]], \"\"); i = i + 1; }", "1 false 2 true 3 true "},
+		{"var m = {true: [1], false: []}; m[true][0] = 2; println(m[true], len(m[false]));", "[2] 0\n"},
+		// Signed and unsigned keys of the same value are the same key
+		{"var m = {1: \"a\", -1: \"b\"}; var k = -1; println(m[k + 2], m[k]);", "a b\n"},
+		{`var m = {"a": 1, "a": 2}; println(m);`, "{\"a\": 2}\n"},
+		// Spawned calls and receivers get copies of the maps
+		{`fun set(m: map[string]uint): uint { m["a"] = 9; return m["a"]; } var m = {"a": 1}; var h = spawn set(m); println(await h, m);`, "9 {\"a\": 1}\n"},
+		{`var c = chan(1); var m = {"a": [1]}; send(c, m); m["a"][0] = 2; println(recv(c), m);`, "{\"a\": [1]} {\"a\": [2]}\n"},
+	}
+
+	for _, tt := range tests {
+		output, err := runWithOptions(t, tt.input)
+		if err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		if output != tt.expected {
+			t.Errorf("wrong output for %q. expected=%q, got=%q", tt.input, tt.expected, output)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`var m = {"a": 1}; println(m["b"]);`, "1:28: key \"b\" not found in map"},
+		{"var m = {1: 1}; m[2];", "key 2 not found in map"},
+		{"var m = {[1]: 1};", "cannot use a value of type `ARRAY` as map key"},
+		{`var m = {"a": 1}; m[[1]] = 2;`, "cannot use a value of type `ARRAY` as map key"},
+		{"var a = [1]; delete(a, 0);", "cannot apply `delete` on a value of type `ARRAY`"},
+		{"keys(1);", "cannot apply `keys` on a value of type `UNSIGNED_INTEGER`"},
+	}
+	for _, tt := range errorTests {
+		_, err := runWithOptions(t, tt.input)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error for %q. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestFloats(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var f: float = 2.5; println(f * 2, f / 2, f - 0.5, -f);", "5.0 1.25 2.0 -2.5\n"},
+		{"println(1e3, 1.5e-3, 2.0, 0.1 + 0.2);", "1000.0 0.0015 2.0 0.30000000000000004\n"},
+		{"var f: float = 1; println(f / 4, 7 / 2);", "0.25 3\n"},
+		{"var a: []float = [1, 2.5]; var m = {\"x\": [0.5, 1 + 1]}; println(a, m);", "[1.0, 2.5] {\"x\": [0.5, 2.0]}\n"},
+		{"var f = 1.5; println(f < 2, f >= 1.5, f == 1.5, f != 1);", "true true true true\n"},
+		{"println(abs(-2.5), min(3.5, 1, 2), max(1.5, 2));", "2.5 1.0 2.0\n"},
+		{"fun half(x: float): float { return x / 2; } println(half(3));", "1.5\n"},
+		{"var f = 0.0; in f; println(f * 2);", "6.5\n"},
+		{"var i: int = 3; var f = 2.0; println(i + f, f * i, i / f, f > i, i == 3.0);", "5.0 6.0 1.5 false true\n"},
+		{"var f = 2.0; var i: int = 5; var u: uint = 4; println(min(f, i), max(u, f), u - f, max(0.5, i / 2));", "2.0 4.0 2.0 2.0\n"},
+	}
+
+	for _, tt := range tests {
+		output, err := runChecked(t, tt.input, WithInput(strings.NewReader("3.25")))
+		if err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		if output != tt.expected {
+			t.Errorf("wrong output for %q. expected=%q, got=%q", tt.input, tt.expected, output)
+		}
+	}
+
+	// Literals aside, integers are promoted to floats when mixed with them
+	promotions := []struct {
+		input    string
+		expected string
+	}{
+		{"println(1.5 + 2, 7 / 2.0, 3 * 0.5);", "3.5 3.5 1.5\n"},
+		{"var a = -1; println(a * 0.5, 2 > 1.5, 2 == 2.0, a < 0.5);", "-0.5 true true true\n"},
+		{"println(max(1, 2.5, -3), min(1, 2.5));", "2.5 1.0\n"},
+	}
+	for _, tt := range promotions {
+		output, err := runWithOptions(t, tt.input)
+		if err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		if output != tt.expected {
+			t.Errorf("wrong output for %q. expected=%q, got=%q", tt.input, tt.expected, output)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"var f = 1.5; println(f / 0);", "1:24: division by zero"},
+		{"var f = 1.5 & 1;", "cannot do bitwise operations on operands of type `FLOAT` and `UNSIGNED_INTEGER`"},
+		{"var f = ~1.5;", "cannot apply `~` operator on operand of type `FLOAT`"},
+		{"var m = {1.5: true};", "cannot use a value of type `FLOAT` as map key"},
+		{"var f = 1.5 + \"a\";", "cannot do binary operations on operands of type `FLOAT` and `STRING`"},
+	}
+	for _, tt := range errorTests {
+		_, err := runWithOptions(t, tt.input)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error for %q. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestConversions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var u: uint = 3; var i: int = 5; println(int(u) - i, uint(i) - u, i - 7);", "-2 2 -2\n"},
+		{"println(int(2.9), int(-2.9), uint(0.5), uint(-0.5), int(1e18));", "2 -2 0 0 1000000000000000000\n"},
+		{"var i = -3; println(float(i) / 2, float(7), float(true), int(false), uint(true));", "-1.5 7.0 1.0 0 1\n"},
+		{"var f = 0.5; println(bool(0), bool(-1), bool(f), bool(0.0), bool(true));", "false true true false true\n"},
+		{"var u: uint = 9223372036854775807; println(int(u), -int(u) - 1);", "9223372036854775807 -9223372036854775808\n"},
+		{"var m: map[int]int = {-1: 5}; m[2] = int(m[-1] * 2); println(m, keys(m)[0] < 0);", "{-1: 5, 2: 10} true\n"},
+		{"var f: float = -1; var x: int = ~5; var y: int = -9223372036854775808; println(f / 2, x, y);", "-0.5 -6 -9223372036854775808\n"},
+		{"var a = [-1, 2]; var b = -9223372036854775808; println(a[1] - 3, b, ~5);", "-1 -9223372036854775808 18446744073709551610\n"},
+		{"fun g(): int { var k = 3; return k; } var k = 5; var f: float = k; println(~g(), k / 2, ~3);", "-4 2.5 18446744073709551612\n"},
+	}
+
+	for _, tt := range tests {
+		output, err := runChecked(t, tt.input)
+		if err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		if output != tt.expected {
+			t.Errorf("wrong output for %q. expected=%q, got=%q", tt.input, tt.expected, output)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{"var u: uint = 18446744073709551615; var i = int(u);", "1:45: overflow error when converting `18446744073709551615` to a signed integer"},
+		{"var i = -1; var u = uint(i);", "overflow error when converting `-1` to an unsigned integer"},
+		{"var f = 1e19; var i = int(f);", "overflow error when converting `1e+19` to a signed integer"},
+		{"var f = -1.0; var u = uint(f);", "overflow error when converting `-1.0` to an unsigned integer"},
+		{"var f = 0.0; var i = int(f / f + 1);", "division by zero"},
+	}
+	for _, tt := range errorTests {
+		_, err := runChecked(t, tt.input)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error for %q. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+// Unsigned integers mixed with signed ones must fit them, they are never reinterpreted
+func TestMixedIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var a = -1; println(a < 18446744073709551615, a == 18446744073709551615, 18446744073709551615 > a);", "true false true\n"},
+		{"var a = -1; println(a + 3, 3 - a, a * 2, 7 / a, a & 6, a | 2, a ^ 1);", "2 4 -2 -7 6 -1 -2\n"},
+	}
+
+	for _, tt := range tests {
+		output, err := runWithOptions(t, tt.input)
+		if err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		if output != tt.expected {
+			t.Errorf("wrong output for %q. expected=%q, got=%q", tt.input, tt.expected, output)
+		}
+	}
+
+	errorTests := []string{
+		"var a = -1; var b = a + 18446744073709551615;",
+		"var a = -1; var b = 9223372036854775808 * a;",
+		"var a = -1; var b = a & 18446744073709551615;",
+		"var c = chan(18446744073709551615);",
+	}
+	for _, input := range errorTests {
+		_, err := runWithOptions(t, input)
+		if err == nil || !strings.Contains(err.Error(), "to a signed integer") {
+			t.Errorf("expected an overflow error for %q. got=%v", input, err)
+		}
+	}
+}
+
+func TestInput(t *testing.T) {
+	input := `var a: uint = 0; var b = -1; var c = false; var d = "";
+in a; in b; in c; in d;
+return a; return b; return c; return d;`
+	output, err := runWithOptions(t, input, WithInput(strings.NewReader("7 -3\ntrue\nword and more\n")))
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if output != "7\n-3\ntrue\nword\n" {
+		t.Errorf("wrong output. got=%q", output)
+	}
+
+	// Spawned tasks read from the input of the VM
+	input = `fun read(): uint { var n: uint = 0; in n; return n; }
+var a = spawn read(); var b = spawn read();
+return await a + await b;`
+	output, err = runWithOptions(t, input, WithInput(strings.NewReader("20 22")))
+	if err != nil || output != "42\n" {
+		t.Errorf("wrong output of the spawned reads. err=%v, output=%q", err, output)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", "1:18: could not read a `uint`: end of input"},
+		{"5", "1:24: could not read a `uint`: end of input"},
+		{"five", "1:18: could not read a `uint`: expected integer"},
+	}
+	for _, tt := range tests {
+		_, err := runWithOptions(t, "var a: uint = 0; in a; in a;", WithInput(strings.NewReader(tt.input)))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error reading %q. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+
+	// Without an input, nothing is read from the stdin of the process
+	_, err = runWithOptions(t, "var a: uint = 0; in a;")
+	if err == nil || err.Error() != "1:18: could not read a `uint`: end of input" {
+		t.Errorf("expected the end of input of a VM without one. got=%v", err)
+	}
+}